@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var anomaliesCmd = &cobra.Command{
+	Use:     "anomalies <collection>",
+	Short:   "List entries with more than one revision written since collection was created",
+	Example: `immudb-audit anomalies samplecollection`,
+	RunE:    anomalies,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(anomaliesCmd)
+}
+
+func anomalies(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	var jsonRepository interface {
+		Anomalies(fn func(immudb.Anomaly) error) error
+	}
+
+	switch cfg.Type {
+	case "kv":
+		jsonRepository, err = immudb.NewJsonKVRepository(immuCli, args[0])
+	case "sql":
+		jsonRepository, err = immudb.NewJsonSQLRepository(immuCli, args[0])
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create json repository, %w", err)
+	}
+
+	return jsonRepository.Anomalies(func(a immudb.Anomaly) error {
+		b, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+
+		return printJson(b)
+	})
+}
@@ -12,6 +12,7 @@ var auditCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(auditCmd)
+	addOutputFlags(auditCmd)
 }
 
 func audit(cmd *cobra.Command, args []string) error {
@@ -1,22 +1,32 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
 )
 
 var auditKVCmd = &cobra.Command{
-	Use:     "kv <collection> <primary key value>",
-	Short:   "Audit your kv collection entry",
-	Example: "immudb-audit audit kv samplecollection 100",
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    auditKv,
+	Use:   "kv <collection> <primary key value>",
+	Short: "Audit your kv collection entry",
+	Example: `immudb-audit audit kv samplecollection 100
+immudb-audit audit kv samplecollection --index user.username=admin
+immudb-audit audit kv samplecollection --since-tx 5000`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: auditKv,
 }
 
 func init() {
 	auditCmd.AddCommand(auditKVCmd)
+	auditKVCmd.Flags().String("index", "", "Audit all entries matching indexed field and value prefix, in format field=prefix")
+	auditKVCmd.Flags().Uint64("since-tx", 0, "Audit revisions since transaction")
+	auditKVCmd.Flags().Uint64("until-tx", 0, "Audit revisions until transaction")
+	auditKVCmd.Flags().Bool("verify", false, "If true, verify every revision with inclusion and consistency proofs against immudb state")
 }
 
 func auditKv(cmd *cobra.Command, args []string) error {
@@ -30,18 +40,85 @@ func auditKv(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("could not create json kv repository, %w", err)
 	}
 
-	pkValue := ""
-	if len(args) > 1 {
-		pkValue = args[1]
+	// entries are interpreted with config active when they were written
+	revisions, err := immudb.NewConfigs(immuCli).History(args[0])
+	if err != nil {
+		return fmt.Errorf("could not get collection definition history, %w", err)
 	}
 
-	history, err := jr.History(pkValue)
-	if err != nil {
-		return fmt.Errorf("could not get audit, %w", err)
+	verify, _ := cmd.Flags().GetBool("verify")
+	timestamps := map[uint64]time.Time{}
+	envelopeOf := func(h immudb.History) (envelope, error) {
+		e := envelope{TxID: h.TxID, Revision: h.Revision, Key: h.Key, Deleted: h.Deleted, Entry: immudb.EntryJSON(h.Entry)}
+		if h.Deleted {
+			e.Entry = immudb.EntryJSON(nil)
+		}
+
+		if active := immudb.ActiveConfig(revisions, h.TxID); active != nil {
+			e.ConfigVersion = active.Version
+		}
+
+		// revisions of many entries are often written in the same transaction
+		ts, ok := timestamps[h.TxID]
+		if !ok {
+			var err error
+			ts, err = immudb.TxTime(immuCli, h.TxID)
+			if err != nil {
+				return envelope{}, err
+			}
+			timestamps[h.TxID] = ts
+		}
+		e.Timestamp = &ts
+
+		if verify {
+			verified := true
+			err := jr.VerifyHistory(h)
+			if err != nil {
+				log.WithError(err).WithField("key", h.Key).WithField("tx_id", h.TxID).Error("Verification failed")
+				verified = false
+			}
+			e.Verified = &verified
+		}
+
+		return e, nil
 	}
 
-	for _, h := range history {
-		fmt.Printf("{\"tx_id\": %d, \"revision\": %d, \"entry\": %s}\n", h.TxID, h.Revision, string(h.Entry))
+	index, _ := cmd.Flags().GetString("index")
+	sinceTx, _ := cmd.Flags().GetUint64("since-tx")
+	untilTx, _ := cmd.Flags().GetUint64("until-tx")
+	err = printRecords(func(print func([]byte) error) error {
+		printHistory := func(h immudb.History) error {
+			e, err := envelopeOf(h)
+			if err != nil {
+				return err
+			}
+
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+
+			return print(b)
+		}
+
+		if len(args) > 1 {
+			return jr.KeyHistory(args[1], sinceTx, untilTx, printHistory)
+		}
+
+		if index != "" {
+			split := strings.SplitN(index, "=", 2)
+			prefix := ""
+			if len(split) > 1 {
+				prefix = split[1]
+			}
+
+			return jr.HistoryByIndex(split[0], prefix, sinceTx, untilTx, printHistory)
+		}
+
+		return jr.HistoryByTx(sinceTx, untilTx, printHistory)
+	})
+	if err != nil {
+		return fmt.Errorf("could not get audit, %w", err)
 	}
 
 	return nil
@@ -1,22 +1,41 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
 )
 
 var auditSQLCmd = &cobra.Command{
-	Use:     "sql <collection> <<temporal query range and condition>>",
-	Short:   "Audit your sql collection with temporal queries",
-	Example: "immudb-audit audit sql samplecollection \"SINCE '2022-01-06 11:38' UNTIL '2022-01-06 12:00' WHERE id=1\"",
-	Args:    cobra.MinimumNArgs(1),
-	RunE:    auditSQL,
+	Use:   "sql <collection>",
+	Short: "Audit your sql collection with temporal queries",
+	Long: `Audit your sql collection with temporal queries.
+
+Every row is printed with its primary key value as key. Temporal queries do not
+expose transactions of SQL rows, so tx_id, timestamp, config_version and
+verified are set only for rows which are the current version, read with
+their transaction. Revision is always omitted.`,
+	Example: `immudb-audit audit sql samplecollection --since "2022-01-06 11:38" --until "2022-01-06 12:00" --filter id=1
+immudb-audit audit sql samplecollection --since-tx 2000
+immudb-audit audit sql samplecollection --raw "SINCE '2022-01-06 11:38' UNTIL '2022-01-06 12:00' WHERE id=1"`,
+	Args: cobra.ExactArgs(1),
+	RunE: auditSQL,
 }
 
 func init() {
 	auditCmd.AddCommand(auditSQLCmd)
+	auditSQLCmd.Flags().StringArray("filter", nil, "Filter in format <column><operator><value>, where operator is one of =, !=, >, >=, <, <= or ~ (LIKE). Can be repeated, filters are combined with AND.")
+	auditSQLCmd.Flags().Uint64("since-tx", 0, "Audit since transaction")
+	auditSQLCmd.Flags().Uint64("until-tx", 0, "Audit until transaction")
+	auditSQLCmd.Flags().String("since", "", "Audit since time, RFC3339 or 2006-01-02 15:04:05 format")
+	auditSQLCmd.Flags().String("until", "", "Audit until time, RFC3339 or 2006-01-02 15:04:05 format")
+	auditSQLCmd.Flags().Bool("verify", false, "If true, verify every current row with inclusion and consistency proofs against immudb state")
+	auditSQLCmd.Flags().String("raw", "", "Raw temporal query, e.g. \"SINCE TX 100 WHERE id=1\". Its range cannot be combined with --since* and --until* flags. Use only with trusted input.")
 }
 
 func auditSQL(cmd *cobra.Command, args []string) error {
@@ -30,18 +49,88 @@ func auditSQL(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("could not create json sql repository, %w", err)
 	}
 
-	query := ""
-	if len(args) == 2 {
-		query = args[1]
+	filters, err := filtersFromFlags(cmd)
+	if err != nil {
+		return err
 	}
 
-	history, err := jr.History(query)
+	query := immudb.SQLQuery{Filters: filters}
+	query.Raw, _ = cmd.Flags().GetString("raw")
+	query.SinceTx, _ = cmd.Flags().GetUint64("since-tx")
+	query.UntilTx, _ = cmd.Flags().GetUint64("until-tx")
+	query.Since, err = timeFromFlag(cmd, "since")
 	if err != nil {
-		return fmt.Errorf("could not get audit, %w", err)
+		return err
+	}
+
+	query.Until, err = timeFromFlag(cmd, "until")
+	if err != nil {
+		return err
+	}
+
+	// rows are interpreted with config active when they were written
+	revisions, err := immudb.NewConfigs(immuCli).History(args[0])
+	if err != nil {
+		return fmt.Errorf("could not get collection definition history, %w", err)
+	}
+
+	verify, _ := cmd.Flags().GetBool("verify")
+	envelopeOf := func(object []byte) (envelope, error) {
+		e := envelope{Key: jr.PrimaryKey(object), Entry: immudb.EntryJSON(object)}
+
+		// transactions are known only for current versions of rows
+		txID, current, err := jr.CurrentTx(object)
+		if err != nil || !current {
+			return e, err
+		}
+
+		e.TxID = txID
+		if active := immudb.ActiveConfig(revisions, txID); active != nil {
+			e.ConfigVersion = active.Version
+		}
+
+		ts, err := immudb.TxTime(immuCli, txID)
+		if err != nil {
+			return envelope{}, err
+		}
+		e.Timestamp = &ts
+
+		if verify {
+			verified := true
+			stored, err := jr.VerifyRow(e.Key)
+			if err == nil && !bytes.Equal(stored, object) {
+				err = errors.New("row was modified")
+			}
+			if err != nil {
+				log.WithError(err).WithField("key", e.Key).WithField("tx_id", txID).Error("Verification failed")
+				verified = false
+			}
+			e.Verified = &verified
+		}
+
+		return e, nil
 	}
 
-	for _, h := range history {
-		fmt.Println(string(h))
+	err = printRecords(func(print func([]byte) error) error {
+		_, err := jr.History(query, immudb.ReadOptions{}, func(object []byte) error {
+			e, err := envelopeOf(object)
+			if err != nil {
+				return err
+			}
+
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+
+			return print(b)
+		})
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not get audit, %w", err)
 	}
+
 	return nil
 }
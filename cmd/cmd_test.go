@@ -0,0 +1,550 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/tidwall/gjson"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+	"github.com/tomekkolo/immudb-play/pkg/lineparser"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// execute runs command line against server, and returns its standard output.
+func execute(t *testing.T, srv *immudbtest.Server, args ...string) (string, error) {
+	t.Helper()
+
+	// commands are package globals, so flags set by previous run are reset
+	resetFlags(rootCmd)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	output := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		output <- string(b)
+	}()
+
+	// usage printed on failure is not needed, error is returned
+	rootCmd.SetErr(io.Discard)
+	rootCmd.SetArgs(append(args, srv.Args()...))
+	err = rootCmd.Execute()
+	w.Close()
+	return <-output, err
+}
+
+// mustExecute runs command line as execute, and fails test if it fails.
+func mustExecute(t *testing.T, srv *immudbtest.Server, args ...string) string {
+	t.Helper()
+
+	out, err := execute(t, srv, args...)
+	if err != nil {
+		t.Fatalf("%s failed, %s", strings.Join(args, " "), err)
+	}
+
+	return out
+}
+
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if s, ok := f.Value.(pflag.SliceValue); ok {
+			s.Replace(nil)
+		} else {
+			f.Value.Set(f.DefValue)
+		}
+		f.Changed = false
+	}
+
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
+	}
+}
+
+// lines returns non-empty lines of output.
+func lines(out string) []string {
+	result := []string{}
+	for _, l := range strings.Split(out, "\n") {
+		if strings.TrimSpace(l) != "" {
+			result = append(result, l)
+		}
+	}
+
+	return result
+}
+
+// readLines returns lines of sample log.
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	result := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		result = append(result, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestKVCollection(t *testing.T) {
+	srv := immudbtest.NewT(t)
+	log := "../test/k8s/k8s.log"
+
+	mustExecute(t, srv, "create", "kv", "k8s", "--indexes", "auditID+stage,kind,verb,objectRef.namespace", "--optional", "objectRef.namespace")
+	mustExecute(t, srv, "tail", "file", "k8s", log)
+
+	// entries are stored under primary key, so repeated ones are revisions
+	expected := map[string]bool{}
+	verbs := map[string]int{}
+	for _, l := range readLines(t, log) {
+		key := gjson.Get(l, "auditID").String() + gjson.Get(l, "stage").String()
+		if !expected[key] {
+			verbs[gjson.Get(l, "verb").String()]++
+		}
+		expected[key] = true
+	}
+
+	entries := lines(mustExecute(t, srv, "read", "kv", "k8s"))
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+
+	entries = lines(mustExecute(t, srv, "read", "kv", "k8s", "verb=get"))
+	if len(entries) != verbs["get"] {
+		t.Errorf("expected %d entries with verb get, got %d", verbs["get"], len(entries))
+	}
+
+	for _, e := range entries {
+		if gjson.Get(e, "verb").String() != "get" {
+			t.Fatalf("expected entry with verb get, got %s", e)
+		}
+	}
+
+	page := lines(mustExecute(t, srv, "read", "kv", "k8s", "--limit", "10"))
+	if len(page) != 10 {
+		t.Errorf("expected 10 entries with limit, got %d", len(page))
+	}
+
+	// primary key is composed of auditID and stage
+	first := gjson.Parse(entries[0])
+	key := first.Get("auditID").String() + first.Get("stage").String()
+	revisions := lines(mustExecute(t, srv, "audit", "kv", "k8s", key, "--verify"))
+	if len(revisions) == 0 {
+		t.Fatalf("expected revisions of %s", key)
+	}
+
+	for _, r := range revisions {
+		revision := gjson.Parse(r)
+		if revision.Get("tx_id").Uint() == 0 || revision.Get("key").String() != key || !revision.Get("verified").Bool() {
+			t.Errorf("expected verified revision of %s with transaction, got %s", key, r)
+		}
+
+		if revision.Get("entry.auditID").String() != first.Get("auditID").String() {
+			t.Errorf("expected entry of %s, got %s", key, r)
+		}
+	}
+}
+
+func TestSQLCollection(t *testing.T) {
+	srv := immudbtest.NewT(t)
+	log := "../test/pgaudit/pgaudit.log"
+
+	mustExecute(t, srv, "create", "sql", "pgaudit", "--parser", "pgaudit")
+	mustExecute(t, srv, "tail", "file", "pgaudit", log)
+
+	// lines which are not pgaudit entries, e.g. continued statements, are
+	// skipped, and statement_id is primary key
+	parser := lineparser.NewPGAuditLineParser()
+	expected := map[int64]string{}
+	for _, l := range readLines(t, log) {
+		b, err := parser.Parse(l)
+		if err != nil {
+			continue
+		}
+
+		expected[gjson.GetBytes(b, "statement_id").Int()] = gjson.GetBytes(b, "command").String()
+	}
+
+	writes := 0
+	for _, command := range expected {
+		if command == "INSERT" {
+			writes++
+		}
+	}
+
+	entries := lines(mustExecute(t, srv, "read", "sql", "pgaudit"))
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+
+	entries = lines(mustExecute(t, srv, "read", "sql", "pgaudit", "--filter", "command=INSERT"))
+	if len(entries) != writes {
+		t.Errorf("expected %d INSERT entries, got %d", writes, len(entries))
+	}
+
+	page := lines(mustExecute(t, srv, "read", "sql", "pgaudit", "--limit", "5", "--desc"))
+	if len(page) != 5 {
+		t.Fatalf("expected 5 entries with limit, got %d", len(page))
+	}
+
+	for i := 1; i < len(page); i++ {
+		if gjson.Get(page[i-1], "statement_id").Int() <= gjson.Get(page[i], "statement_id").Int() {
+			t.Fatalf("expected descending statement_id, got %s after %s", page[i], page[i-1])
+		}
+	}
+
+	audit := lines(mustExecute(t, srv, "audit", "sql", "pgaudit", "--filter", "statement_id=1", "--verify"))
+	if len(audit) != 1 {
+		t.Fatalf("expected audit of single row, got %v", audit)
+	}
+
+	row := gjson.Parse(audit[0])
+	if row.Get("key").String() != "1" || row.Get("entry.statement_id").Int() != 1 || row.Get("deleted").Bool() {
+		t.Errorf("expected audit of row 1, got %s", audit[0])
+	}
+
+	// current row is read with its transaction
+	if row.Get("tx_id").Uint() == 0 || row.Get("config_version").Uint() != 1 || !row.Get("timestamp").Exists() || !row.Get("verified").Bool() {
+		t.Errorf("expected transaction and verification of current row, got %s", audit[0])
+	}
+}
+
+func TestPrinters(t *testing.T) {
+	// records which are not valid json are printed as json strings
+	for format, expected := range map[string]string{
+		outputNDJSON: "{\"a\":1}\n\"not json\"\n",
+		outputPretty: "{\n  \"a\": 1\n}\n\"not json\"\n",
+		outputJSON:   "[\n{ \"a\": 1 },\n\"not json\"\n]\n",
+	} {
+		flagOutput = format
+		b := bytes.Buffer{}
+		p, err := newPrinter(&b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, record := range []string{`{ "a": 1 }`, "not json"} {
+			err = p.Print([]byte(record))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		err = p.Flush()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if b.String() != expected {
+			t.Errorf("expected %s output %q, got %q", format, expected, b.String())
+		}
+	}
+	flagOutput = outputNDJSON
+}
+
+func TestWrappedLines(t *testing.T) {
+	srv := immudbtest.NewT(t)
+	log := "../test/syslog/syslog"
+
+	mustExecute(t, srv, "create", "kv", "syslog", "--parser", "wrap")
+	mustExecute(t, srv, "tail", "file", "syslog", log)
+
+	expected := readLines(t, log)
+	entries := lines(mustExecute(t, srv, "read", "kv", "syslog"))
+	if len(entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(entries))
+	}
+
+	messages := map[string]bool{}
+	for _, e := range entries {
+		messages[gjson.Get(e, "message").String()] = true
+	}
+
+	for _, l := range expected {
+		if !messages[l] {
+			t.Fatalf("line %s was not stored", l)
+		}
+	}
+}
+
+func TestCollectionConfig(t *testing.T) {
+	srv := immudbtest.NewT(t)
+
+	mustExecute(t, srv, "create", "kv", "kv", "--indexes", "id,user")
+	mustExecute(t, srv, "create", "sql", "sql", "--columns", "id=INTEGER,user=VARCHAR[64]", "--primary-key", "id")
+
+	// creating the same definition again does nothing, different one
+	// requires force
+	mustExecute(t, srv, "create", "kv", "kv", "--indexes", "id,user")
+	_, err := execute(t, srv, "create", "kv", "kv", "--indexes", "id")
+	if err == nil {
+		t.Fatal("expected redefinition without force to fail")
+	}
+
+	_, err = execute(t, srv, "create", "sql", "sql", "--columns", "id=INTEGER", "--primary-key", "id")
+	if err == nil {
+		t.Fatal("expected redefinition without force to fail")
+	}
+
+	mustExecute(t, srv, "collections", "alter", "kv", "--add-index", "group", "--optional", "group")
+	mustExecute(t, srv, "collections", "alter", "sql", "--add-column", "group=VARCHAR[64]", "--optional", "group")
+
+	names := map[string]bool{}
+	for _, l := range lines(mustExecute(t, srv, "collections", "list")) {
+		names[strings.Fields(l)[0]] = true
+	}
+
+	if !names["kv"] || !names["sql"] {
+		t.Fatalf("expected kv and sql collections, got %v", names)
+	}
+
+	// key-value index is added as building before reindex, and built after
+	for collection, field := range map[string]string{"kv": "group", "sql": "group=VARCHAR[64]"} {
+		version := uint64(2)
+		if collection == "kv" {
+			version = 3
+		}
+
+		revisions := lines(mustExecute(t, srv, "collections", "history", collection))
+		if uint64(len(revisions)) != version {
+			t.Fatalf("expected %d definitions of %s, got %v", version, collection, revisions)
+		}
+
+		last := immudb.ConfigRevision{}
+		err := json.Unmarshal([]byte(revisions[version-1]), &last)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if last.Version != version || last.Tx == 0 || last.Indexes[len(last.Indexes)-1] != field || len(last.Building) != 0 {
+			t.Errorf("expected version %d of %s with %s, got %s", version, collection, field, revisions[version-1])
+		}
+
+		description := mustExecute(t, srv, "collections", "describe", collection)
+		if gjson.Get(description, "Version").Uint() != version {
+			t.Errorf("expected description of version %d of %s, got %s", version, collection, description)
+		}
+	}
+
+	// entries are written with the current definition, including fields
+	// added by alter
+	source := t.TempDir() + "/entries.log"
+	err = os.WriteFile(source, []byte("{\"id\":1,\"user\":\"a\",\"group\":\"g1\"}\n{\"id\":2,\"user\":\"b\"}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExecute(t, srv, "tail", "file", "kv", source)
+	mustExecute(t, srv, "tail", "file", "sql", source)
+
+	entries := lines(mustExecute(t, srv, "read", "kv", "kv", "group=g1"))
+	if len(entries) != 1 || gjson.Get(entries[0], "id").Int() != 1 {
+		t.Errorf("expected entry 1 by added index, got %v", entries)
+	}
+
+	entries = lines(mustExecute(t, srv, "read", "sql", "sql", "--filter", "group=g1"))
+	if len(entries) != 1 || gjson.Get(entries[0], "id").Int() != 1 {
+		t.Errorf("expected row 1 by added column, got %v", entries)
+	}
+
+	// dropped collection is not listed, and can be created again
+	mustExecute(t, srv, "collections", "drop", "kv")
+	if strings.Contains(mustExecute(t, srv, "collections", "list"), "kv") {
+		t.Error("expected dropped collection not to be listed")
+	}
+
+	mustExecute(t, srv, "create", "kv", "kv", "--indexes", "id")
+	entries = lines(mustExecute(t, srv, "read", "kv", "kv"))
+	if len(entries) != 0 {
+		t.Errorf("expected recreated collection to be empty, got %v", entries)
+	}
+
+	out := mustExecute(t, srv, "collections", "describe", "kv")
+	if gjson.Get(out, "Version").Uint() != 5 {
+		t.Errorf("expected version 5 after drop and create, got %s", fmt.Sprint(out))
+	}
+}
+
+func TestVerifyArchive(t *testing.T) {
+	srv := immudbtest.NewT(t)
+
+	mustExecute(t, srv, "create", "kv", "kv", "--indexes", "id")
+	source := t.TempDir() + "/entries.log"
+	err := os.WriteFile(source, []byte("{\"id\":1}\n{\"id\":2}\n{\"id\":1,\"v\":2}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExecute(t, srv, "tail", "file", "kv", source)
+	archive := t.TempDir() + "/kv.tar.gz"
+	mustExecute(t, srv, "export", "kv", "--out", archive, "--history")
+
+	// trusted state is obtained from immudb, not from the archive
+	state, err := srv.Client(t).CurrentState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txID := fmt.Sprint(state.TxId)
+	txHash := hex.EncodeToString(state.TxHash)
+	otherHash := hex.EncodeToString(make([]byte, len(state.TxHash)))
+	mustExecute(t, srv, "verify-archive", archive, "--tx-id", txID, "--tx-hash", txHash)
+	mustExecute(t, srv, "verify-archive", archive, "--tx-id", txID, "--tx-hash", strings.ToUpper(txHash), "--database", immudbtest.Database)
+
+	for _, args := range [][]string{
+		{"verify-archive", archive},
+		{"verify-archive", archive, "--tx-id", txID},
+		{"verify-archive", archive, "--tx-id", txID, "--tx-hash", otherHash},
+		{"verify-archive", archive, "--tx-id", fmt.Sprint(state.TxId - 1), "--tx-hash", txHash},
+		{"verify-archive", archive, "--tx-id", txID, "--tx-hash", txHash, "--database", "other"},
+	} {
+		_, err = execute(t, srv, args...)
+		if err == nil {
+			t.Errorf("expected %s to fail", strings.Join(args[2:], " "))
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	srv := immudbtest.NewT(t)
+
+	mustExecute(t, srv, "create", "kv", "kv", "--indexes", "id")
+	source := t.TempDir() + "/entries.log"
+	err := os.WriteFile(source, []byte("{\"id\":1}\n{\"id\":2}\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustExecute(t, srv, "tail", "file", "kv", source)
+	changes := lines(mustExecute(t, srv, "diff", "kv"))
+	if len(changes) != 2 || gjson.Get(changes[0], "Kind").String() != "added" {
+		t.Errorf("expected 2 added entries, got %v", changes)
+	}
+
+	// time before the first transaction does not resolve to current state
+	for _, flag := range []string{"--from", "--to"} {
+		_, err = execute(t, srv, "diff", "kv", flag, "2000-01-01 00:00:00")
+		if err == nil || !strings.Contains(err.Error(), "no transaction committed until") {
+			t.Errorf("expected %s before the first transaction to fail, got %v", flag, err)
+		}
+	}
+}
+
+// lostSessionRepository fails the first write with lost session.
+type lostSessionRepository struct {
+	writes int
+	err    error
+}
+
+func (r *lostSessionRepository) WriteBytes(b []byte) (uint64, error) {
+	r.writes++
+	if r.writes == 1 {
+		return 0, r.err
+	}
+
+	return 2, nil
+}
+
+// checkedRepository tells whether failed write was stored.
+type checkedRepository struct {
+	lostSessionRepository
+	stored bool
+}
+
+func (r *checkedRepository) Stored(b []byte) (uint64, bool, error) {
+	if r.stored {
+		return 1, true, nil
+	}
+
+	return 0, false, nil
+}
+
+func TestReconnectingRepository(t *testing.T) {
+	immuCli = immudbtest.NewT(t).Client(t)
+	lost := errors.New("could not store object: rpc error: code = Unavailable desc = connection error")
+
+	// write may have been committed, so it is not retried blindly
+	unchecked := &lostSessionRepository{err: lost}
+	_, err := (&reconnectingRepository{jsonRepository: unchecked}).WriteBytes([]byte(`{}`))
+	if err == nil || unchecked.writes != 1 {
+		t.Errorf("expected write not to be retried, got %d writes, %v", unchecked.writes, err)
+	}
+
+	stored := &checkedRepository{lostSessionRepository: lostSessionRepository{err: lost}, stored: true}
+	tx, err := (&reconnectingRepository{jsonRepository: stored}).WriteBytes([]byte(`{}`))
+	if err != nil || tx != 1 || stored.writes != 1 {
+		t.Errorf("expected transaction of stored write, got %d after %d writes, %v", tx, stored.writes, err)
+	}
+
+	notStored := &checkedRepository{lostSessionRepository: lostSessionRepository{err: lost}}
+	tx, err = (&reconnectingRepository{jsonRepository: notStored}).WriteBytes([]byte(`{}`))
+	if err != nil || tx != 2 || notStored.writes != 2 {
+		t.Errorf("expected write to be retried, got %d after %d writes, %v", tx, notStored.writes, err)
+	}
+
+	// other errors are returned without reconnecting
+	rejected := &checkedRepository{lostSessionRepository: lostSessionRepository{err: errors.New("invalid object")}}
+	_, err = (&reconnectingRepository{jsonRepository: rejected}).WriteBytes([]byte(`{}`))
+	if err == nil || rejected.writes != 1 {
+		t.Errorf("expected error without retry, got %d writes, %v", rejected.writes, err)
+	}
+}
+
+func TestServeGRPCWithoutToken(t *testing.T) {
+	srv := immudbtest.NewT(t)
+
+	// API writing to immudb is not exposed without authentication
+	_, err := execute(t, srv, "serve", "--addr", "127.0.0.1:0", "--grpc-addr", ":0")
+	if err == nil || !strings.Contains(err.Error(), "without authentication") {
+		t.Fatalf("expected gRPC API without token to be refused, got %v", err)
+	}
+
+	empty := t.TempDir() + "/token"
+	err = os.WriteFile(empty, []byte("\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = execute(t, srv, "serve", "--addr", "127.0.0.1:0", "--grpc-addr", ":0", "--grpc-token-file", empty)
+	if err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Fatalf("expected empty token to be refused, got %v", err)
+	}
+
+	for addr, loopback := range map[string]bool{"localhost:9090": true, "127.0.0.1:9090": true, "[::1]:9090": true, ":9090": false, "0.0.0.0:9090": false, "example.com:9090": false} {
+		if isLoopback(addr) != loopback {
+			t.Errorf("expected loopback of %s to be %v", addr, loopback)
+		}
+	}
+}
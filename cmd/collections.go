@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var collectionsCmd = &cobra.Command{
+	Use:   "collections",
+	Short: "Manage collections in immudb",
+	RunE:  collections,
+}
+
+func init() {
+	rootCmd.AddCommand(collectionsCmd)
+}
+
+func collections(cmd *cobra.Command, args []string) error {
+	if cmd.CalledAs() == "collections" {
+		return cmd.Help()
+	}
+
+	return runParentCmdE(cmd, args)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var collectionsAlterCmd = &cobra.Command{
+	Use:   "alter <collection>",
+	Short: "Add indexes or columns to collection, backfilling existing entries, or change its retention",
+	Example: `immudb-audit collections alter samplecollection --add-index field4,field5 --optional field5
+immudb-audit collections alter samplecollection --add-column "field4=INTEGER,field5=VARCHAR[256]" --default field4=0
+immudb-audit collections alter samplecollection --retain 400d`,
+	RunE: collectionsAlter,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	collectionsCmd.AddCommand(collectionsAlterCmd)
+	collectionsAlterCmd.Flags().StringSlice("add-index", nil, "List of JSON fields to index, for key-value collections")
+	collectionsAlterCmd.Flags().StringSlice("add-column", nil, "List of fields to add as columns, in format field=TYPE, for SQL collections. Added columns are not indexed.")
+	collectionsAlterCmd.Flags().StringSlice("optional", nil, "List of added fields which can be missing in json")
+	collectionsAlterCmd.Flags().StringArray("default", nil, "Default value for added field missing in json, in format field=value. Can be repeated.")
+	collectionsAlterCmd.Flags().String("retain", "", "Retention period of entries, e.g. 400d or 720h, applied by purge. Use 0 to keep entries forever.")
+}
+
+func collectionsAlter(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	policies, err := indexPoliciesFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	addIndexes, _ := cmd.Flags().GetStringSlice("add-index")
+	addColumns, _ := cmd.Flags().GetStringSlice("add-column")
+	if cmd.Flags().Changed("retain") {
+		err = alterRetention(args[0], *cfg, cmd)
+		if err != nil {
+			return err
+		}
+
+		if len(addIndexes) == 0 && len(addColumns) == 0 {
+			return nil
+		}
+	}
+
+	switch cfg.Type {
+	case "kv":
+		if len(addIndexes) == 0 || len(addColumns) > 0 {
+			return errors.New("key-value collection can be altered with --add-index only")
+		}
+
+		jr, err := immudb.NewJsonKVRepository(immuCli, args[0])
+		if err != nil {
+			return fmt.Errorf("could not create json kv repository, %w", err)
+		}
+
+		err = jr.AddIndexes(addIndexes, policies)
+		if err != nil {
+			return fmt.Errorf("could not add indexes, %w", err)
+		}
+	case "sql":
+		if len(addColumns) == 0 || len(addIndexes) > 0 {
+			return errors.New("SQL collection can be altered with --add-column only")
+		}
+
+		jr, err := immudb.NewJsonSQLRepository(immuCli, args[0])
+		if err != nil {
+			return fmt.Errorf("could not create json sql repository, %w", err)
+		}
+
+		err = jr.AddColumns(addColumns, policies)
+		if err != nil {
+			return fmt.Errorf("could not add columns, %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+
+	return nil
+}
+
+func alterRetention(collection string, cfg immudb.Config, cmd *cobra.Command) error {
+	retain, _ := cmd.Flags().GetString("retain")
+	if retain == "0" {
+		retain = ""
+	}
+
+	if retain != "" {
+		_, err := immudb.ParseRetention(retain)
+		if err != nil {
+			return err
+		}
+	}
+
+	cfg.Retention = retain
+	err := immudb.NewConfigs(immuCli).Write(collection, cfg)
+	if err != nil {
+		return fmt.Errorf("could not store collection definition, %w", err)
+	}
+
+	return nil
+}
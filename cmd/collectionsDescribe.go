@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var collectionsDescribeCmd = &cobra.Command{
+	Use:     "describe <collection>",
+	Short:   "Describe collection definition and content",
+	Example: `immudb-audit collections describe samplecollection`,
+	RunE:    collectionsDescribe,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	collectionsCmd.AddCommand(collectionsDescribeCmd)
+}
+
+type collectionDescription struct {
+	Name string
+	immudb.Config
+	ConfigTx uint64 // transaction collection was created in
+	immudb.CollectionStats
+}
+
+func collectionsDescribe(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	cfgs := immudb.NewConfigs(immuCli)
+	cfg, err := cfgs.Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	configTx, err := cfgs.ConfigTx(args[0])
+	if err != nil {
+		return fmt.Errorf("could not read collection definition history, %w", err)
+	}
+
+	description := collectionDescription{Name: args[0], Config: *cfg, ConfigTx: configTx}
+	if !cfg.Dropped {
+		description.CollectionStats, err = collectionStats(args[0], cfg.Type)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.MarshalIndent(description, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return printJson(b)
+}
+
+func collectionStats(collection string, collectionType string) (immudb.CollectionStats, error) {
+	var stats interface {
+		Stats() (immudb.CollectionStats, error)
+	}
+
+	var err error
+	switch collectionType {
+	case "kv":
+		stats, err = immudb.NewJsonKVRepository(immuCli, collection)
+	case "sql":
+		stats, err = immudb.NewJsonSQLRepository(immuCli, collection)
+	default:
+		return immudb.CollectionStats{}, fmt.Errorf("unknown collection type %s", collectionType)
+	}
+	if err != nil {
+		return immudb.CollectionStats{}, fmt.Errorf("could not create json repository, %w", err)
+	}
+
+	return stats.Stats()
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var collectionsDropCmd = &cobra.Command{
+	Use:     "drop <collection>",
+	Short:   "Drop collection, logically deleting its entries. History remains auditable.",
+	Example: `immudb-audit collections drop samplecollection`,
+	RunE:    collectionsDrop,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	collectionsCmd.AddCommand(collectionsDropCmd)
+}
+
+func collectionsDrop(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	var dropper interface {
+		Drop() error
+	}
+
+	switch cfg.Type {
+	case "kv":
+		dropper, err = immudb.NewJsonKVRepository(immuCli, args[0])
+	case "sql":
+		dropper, err = immudb.NewJsonSQLRepository(immuCli, args[0])
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create json repository, %w", err)
+	}
+
+	err = dropper.Drop()
+	if err != nil {
+		return fmt.Errorf("could not drop collection, %w", err)
+	}
+
+	return nil
+}
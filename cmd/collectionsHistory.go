@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var collectionsHistoryCmd = &cobra.Command{
+	Use:     "history <collection>",
+	Short:   "Show revisions of collection definition with transactions they became active in",
+	Example: `immudb-audit collections history samplecollection`,
+	RunE:    collectionsHistory,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	collectionsCmd.AddCommand(collectionsHistoryCmd)
+}
+
+func collectionsHistory(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := immudb.NewConfigs(immuCli).History(args[0])
+	if err != nil {
+		return fmt.Errorf("could not get collection definition history, %w", err)
+	}
+
+	for _, r := range revisions {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+
+		err = printJson(b)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
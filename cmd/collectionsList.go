@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var collectionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List collections",
+	Example: `immudb-audit collections list
+immudb-audit collections list --all`,
+	RunE: collectionsList,
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	collectionsCmd.AddCommand(collectionsListCmd)
+	collectionsListCmd.Flags().Bool("all", false, "If true, dropped collections are listed as well")
+}
+
+func collectionsList(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	all, _ := cmd.Flags().GetBool("all")
+	cfgs := immudb.NewConfigs(immuCli)
+	names, err := cfgs.List()
+	if err != nil {
+		return fmt.Errorf("could not list collections, %w", err)
+	}
+
+	for _, name := range names {
+		cfg, err := cfgs.Read(name)
+		if err != nil {
+			return fmt.Errorf("could not read collection %s definition, %w", name, err)
+		}
+
+		if cfg.Dropped && !all {
+			continue
+		}
+
+		status := ""
+		if cfg.Dropped {
+			status = "\tdropped"
+		}
+		fmt.Printf("%s\t%s%s\n", name, cfg.Type, status)
+	}
+
+	return nil
+}
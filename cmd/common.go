@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
 )
 
 func runParentCmdE(cmd *cobra.Command, args []string) error {
@@ -14,3 +19,64 @@ func runParentCmdE(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+func filtersFromFlags(cmd *cobra.Command) ([]immudb.Filter, error) {
+	flagFilters, _ := cmd.Flags().GetStringArray("filter")
+	filters := []immudb.Filter{}
+	for _, f := range flagFilters {
+		filter, err := immudb.ParseFilter(f)
+		if err != nil {
+			return nil, err
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
+
+func timeFromFlag(cmd *cobra.Command, name string) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := immudb.ParseTime(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s, %w", name, err)
+	}
+
+	return t, nil
+}
+
+// txFromFlag resolves flag given as transaction id or time to transaction id.
+// Time is resolved to the last transaction committed at or before it, with
+// second granularity, and rejected if nothing was committed until then, as
+// zero transaction means current state.
+func txFromFlag(cmd *cobra.Command, name string) (uint64, error) {
+	value, _ := cmd.Flags().GetString(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	tx, err := strconv.ParseUint(value, 10, 64)
+	if err == nil {
+		return tx, nil
+	}
+
+	t, err := immudb.ParseTime(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s, expected transaction id or time, %w", name, err)
+	}
+
+	tx, err = immudb.TxAt(immuCli, t)
+	if err != nil {
+		return 0, fmt.Errorf("could not resolve --%s to transaction, %w", name, err)
+	}
+
+	if tx == 0 {
+		return 0, fmt.Errorf("no transaction committed until --%s", name)
+	}
+
+	return tx, nil
+}
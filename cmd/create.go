@@ -1,10 +1,17 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
 )
 
 var flagParser string
+var flagForce bool
+var flagOverwrite string
+var flagRetain string
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "create collection in immudb",
@@ -14,6 +21,11 @@ var createCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(createCmd)
 	createCmd.PersistentFlags().StringVar(&flagParser, "parser", "", "Line parser to be used. When not specified, lines will be considered as jsons. Also available 'pgaudit', 'wrap'. For those, indexes are predefined.")
+	createCmd.PersistentFlags().StringSlice("optional", nil, "List of indexed fields which can be missing in json. For key-value, index entry is skipped, for SQL, NULL is stored.")
+	createCmd.PersistentFlags().StringArray("default", nil, "Default value for indexed field missing in json, in format field=value. Can be repeated.")
+	createCmd.PersistentFlags().BoolVar(&flagForce, "force", false, "If true, overwrite definition of existing collection. Entries already written keep the previous layout.")
+	createCmd.PersistentFlags().StringVar(&flagRetain, "retain", "", "Retention period of entries, e.g. 400d or 720h. Entries older than that are deleted by purge. When not specified, entries are kept forever.")
+	createCmd.PersistentFlags().StringVar(&flagOverwrite, "overwrite", immudb.OverwriteAllow, "Policy for writes of existing primary key, 'allow', 'warn' or 'reject'. Append-only sources should use 'warn' or 'reject', so existing entries cannot be silently replaced.")
 }
 
 func create(cmd *cobra.Command, args []string) error {
@@ -23,3 +35,31 @@ func create(cmd *cobra.Command, args []string) error {
 
 	return runParentCmdE(cmd, args)
 }
+
+func indexPoliciesFromFlags(cmd *cobra.Command) (map[string]immudb.IndexPolicy, error) {
+	policies := map[string]immudb.IndexPolicy{}
+	optional, _ := cmd.Flags().GetStringSlice("optional")
+	for _, field := range optional {
+		policies[field] = immudb.IndexPolicy{Mode: immudb.IndexOptional}
+	}
+
+	defaults, _ := cmd.Flags().GetStringArray("default")
+	for _, d := range defaults {
+		splitted := strings.SplitN(d, "=", 2)
+		if len(splitted) != 2 {
+			return nil, fmt.Errorf("invalid default %s, expected field=value", d)
+		}
+
+		if _, ok := policies[splitted[0]]; ok {
+			return nil, fmt.Errorf("field %s cannot be both optional and have default", splitted[0])
+		}
+
+		policies[splitted[0]] = immudb.IndexPolicy{Mode: immudb.IndexDefault, Default: splitted[1]}
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	return policies, nil
+}
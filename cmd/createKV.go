@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
 
 	log "github.com/sirupsen/logrus"
@@ -14,13 +13,17 @@ var createKVCmd = &cobra.Command{
 	Short: "Create collection in immudb with key-value",
 	Example: `immudb-audit create kv samplecollection --parser pgaudit
 immudb-audit create kv samplecollection --indexes unique_field1,field2,field3
-immudb-audit create kv samplecollection --indexes field1+field2,field2,field3`,
+immudb-audit create kv samplecollection --indexes field1+field2,field2,field3
+immudb-audit create kv samplecollection --indexes field1,field2,field3 --optional field2 --default field3=none
+immudb-audit create kv samplecollection --indexes field1,field2,timestamp --layout refs --scored timestamp`,
 	RunE: createKV,
 	Args: cobra.ExactArgs(1),
 }
 
 func init() {
 	createCmd.AddCommand(createKVCmd)
+	createKVCmd.Flags().String("layout", immudb.KVLayoutLinks, "Layout of key-value entries. With 'links', index values are payload keys. With 'refs', primary key is immudb reference to payload and other indexes are sorted sets, so reads do not need extra lookup per entry.")
+	createKVCmd.Flags().StringSlice("scored", nil, "List of indexed fields with numeric or time values, to be stored in sorted sets scored by value, so they can be read by range. Requires 'refs' layout.")
 	createKVCmd.Flags().StringSlice("indexes", nil, "List of JSON fields to create indexes for. First entry is considered as unique primary key. If needed, multiple fields can be used as primary key with syntax field1+field2...")
 }
 
@@ -35,26 +38,19 @@ func createKV(cmd *cobra.Command, args []string) error {
 		flagIndexes = []string{"statement_id", "log_timestamp", "timestamp", "audit_type", "class", "command"}
 		log.WithField("indexes", flagIndexes).Info("Using default indexes for pgaudit parser")
 	} else if flagParser == "wrap" {
-		flagIndexes = []string{"uid", "timestamp"}
+		flagIndexes = []string{"uid", "log_timestamp"}
 		log.WithField("indexes", flagIndexes).Info("Using default indexes for wrap parser")
 	} else if flagParser != "" {
 		return fmt.Errorf("unkown parser %s", flagParser)
 	}
 
-	if len(flagIndexes) == 0 {
-		return errors.New("at least primary key needs to be specified")
-	}
-
-	cfgs := immudb.NewConfigs(immuCli)
-	err = cfgs.Write(args[0], immudb.Config{Parser: flagParser, Type: "kv", Indexes: flagIndexes})
-	if err != nil {
-		return fmt.Errorf("collection does not exist, please create one first")
-	}
-
-	err = immudb.SetupJsonKVRepository(immuCli, args[0], flagIndexes)
+	policies, err := indexPoliciesFromFlags(cmd)
 	if err != nil {
-		return fmt.Errorf("could not create json repository, %w", err)
+		return err
 	}
 
-	return nil
+	layout, _ := cmd.Flags().GetString("layout")
+	scored, _ := cmd.Flags().GetStringSlice("scored")
+	cfg := immudb.Config{Parser: flagParser, Type: "kv", Indexes: flagIndexes, IndexPolicies: policies, Layout: layout, Scored: scored, Overwrite: flagOverwrite, Retention: flagRetain}
+	return immudb.CreateCollection(immuCli, args[0], cfg, nil, flagForce)
 }
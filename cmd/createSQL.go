@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"errors"
 	"fmt"
-	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -13,14 +11,18 @@ import (
 var createSQLCmd = &cobra.Command{
 	Use:   "sql <collection>",
 	Short: "Create collection in immudb with SQL",
-	RunE:  createSQL,
-	Args:  cobra.ExactArgs(1),
+	Example: `immudb-audit create sql samplecollection --parser wrap
+immudb-audit create sql samplecollection --columns "field1=INTEGER,field2=VARCHAR[256],field3=BLOB" --primary-key "field1,field2"
+immudb-audit create sql samplecollection --columns "id=UUID,active=BOOLEAN,group=JSON" --primary-key id --missing-fields null`,
+	RunE: createSQL,
+	Args: cobra.ExactArgs(1),
 }
 
 func init() {
 	createCmd.AddCommand(createSQLCmd)
 	createSQLCmd.Flags().StringSlice("primary-key", nil, "List of columns to be used as primary key")
-	createSQLCmd.Flags().StringSlice("columns", nil, "List of fields to be used as columns")
+	createSQLCmd.Flags().StringSlice("columns", nil, "List of fields to be used as columns, in format field=TYPE. Supported types are INTEGER, FLOAT[scale], BOOLEAN, VARCHAR[max length], BLOB[max length], TIMESTAMP, UUID and JSON.")
+	createSQLCmd.Flags().String("missing-fields", immudb.MissingFieldsError, "How to handle fields missing in json, 'error' fails the write, 'null' stores NULL. Can be overridden per field with --optional and --default. Primary key fields are always required.")
 }
 
 func createSQL(cmd *cobra.Command, args []string) error {
@@ -43,17 +45,12 @@ func createSQL(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unkown parser %s", flagParser)
 	}
 
-	if len(flagColumns) == 0 || len(primaryKey) == 0 {
-		return errors.New("at least one column and primary key needs to be specified")
-	}
-
-	cfgs := immudb.NewConfigs(immuCli)
-	err = cfgs.Write(args[0], immudb.Config{Parser: flagParser, Type: "sql", Indexes: flagColumns})
+	policies, err := indexPoliciesFromFlags(cmd)
 	if err != nil {
-		return fmt.Errorf("collection does not exist, please create one first")
+		return err
 	}
 
-	immudb.SetupJsonSQLRepository(immuCli, args[0], strings.Join(primaryKey, ","), flagColumns)
-
-	return nil
+	missingFields, _ := cmd.Flags().GetString("missing-fields")
+	cfg := immudb.Config{Parser: flagParser, Type: "sql", Indexes: flagColumns, MissingFields: missingFields, IndexPolicies: policies, Overwrite: flagOverwrite, Retention: flagRetain}
+	return immudb.CreateCollection(immuCli, args[0], cfg, primaryKey, flagForce)
 }
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <collection>",
+	Short: "Show entries added, modified and deleted between two points in time",
+	Example: `immudb-audit diff samplecollection --from 1000 --to 2000
+immudb-audit diff samplecollection --from "2022-01-06 11:38" --to "2022-01-06 12:00"`,
+	Args: cobra.ExactArgs(1),
+	RunE: diff,
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().String("from", "", "Transaction id or time, RFC3339 or 2006-01-02 15:04:05 format, of the first state. Time is resolved with second granularity. When not specified, the first state is empty.")
+	diffCmd.Flags().String("to", "", "Transaction id or time, RFC3339 or 2006-01-02 15:04:05 format, of the second state. Time is resolved with second granularity. When not specified, the current state is used.")
+}
+
+func diff(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	fromTx, err := txFromFlag(cmd, "from")
+	if err != nil {
+		return err
+	}
+
+	toTx, err := txFromFlag(cmd, "to")
+	if err != nil {
+		return err
+	}
+
+	if toTx > 0 && fromTx > toTx {
+		return fmt.Errorf("--from transaction %d is after --to transaction %d", fromTx, toTx)
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	var differ interface {
+		Diff(fromTx uint64, toTx uint64, fn func(immudb.Change) error) error
+	}
+
+	switch cfg.Type {
+	case "kv":
+		differ, err = immudb.NewJsonKVRepository(immuCli, args[0])
+	case "sql":
+		differ, err = immudb.NewJsonSQLRepository(immuCli, args[0])
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create json repository, %w", err)
+	}
+
+	err = differ.Diff(fromTx, toTx, func(c immudb.Change) error {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+
+		return printJson(b)
+	})
+	if err != nil {
+		return fmt.Errorf("could not diff collection, %w", err)
+	}
+
+	return nil
+}
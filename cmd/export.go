@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export <collection>",
+	Short: "Export collection with immudb proofs to archive, which can be verified offline",
+	Example: `immudb-audit export samplecollection --out archive.tar.gz
+immudb-audit export samplecollection --out archive.tar.gz --history`,
+	RunE: export,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().String("out", "", "Archive file to write")
+	exportCmd.Flags().Bool("history", false, "If true, all revisions of entries are exported, key-value collections only")
+	exportCmd.MarkFlagRequired("out")
+}
+
+func export(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	history, _ := cmd.Flags().GetBool("history")
+	var exportFn func(w io.Writer) (immudb.ArchiveManifest, error)
+	switch cfg.Type {
+	case "kv":
+		jsonRepository, err := immudb.NewJsonKVRepository(immuCli, args[0])
+		if err != nil {
+			return fmt.Errorf("could not create json repository, %w", err)
+		}
+
+		exportFn = func(w io.Writer) (immudb.ArchiveManifest, error) {
+			return jsonRepository.Export(w, history)
+		}
+	case "sql":
+		// SQL rows do not expose their revisions
+		if history {
+			return errors.New("--history is supported for key-value collections only")
+		}
+
+		jsonRepository, err := immudb.NewJsonSQLRepository(immuCli, args[0])
+		if err != nil {
+			return fmt.Errorf("could not create json repository, %w", err)
+		}
+
+		exportFn = jsonRepository.Export
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+
+	out, _ := cmd.Flags().GetString("out")
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("could not create archive, %w", err)
+	}
+
+	manifest, err := exportFn(f)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		return fmt.Errorf("could not export collection, %w", err)
+	}
+
+	log.WithField("entries", manifest.Entries).
+		WithField("tx_id", manifest.State.TxID).
+		WithField("tx_hash", manifest.State.TxHash).
+		Info("Exported collection")
+	return nil
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+	"github.com/tomekkolo/immudb-play/pkg/service"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <collection> <file>",
+	Short: "Import entries to collection from archive created with export, or from NDJSON file",
+	Example: `immudb-audit import samplecollection archive.tar.gz
+immudb-audit import samplecollection entries.ndjson --source legacy-immudb:3322
+immudb-audit import samplecollection entries.ndjson --skip 1000`,
+	RunE: importCollection,
+	Args: cobra.ExactArgs(2),
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().String("provenance-field", "_provenance", "Field to store origin of imported entries in, empty to not store it")
+	importCmd.Flags().String("source", "", "Source of NDJSON entries stored in provenance. When not specified, file name is used. Archives name their source.")
+	importCmd.Flags().Uint64("batch-size", 50, "Number of entries written in single transaction. Key-value entries with many indexes need smaller batches, to stay within immudb limit of entries per transaction.")
+	importCmd.Flags().Uint64("skip", 0, "Number of entries to skip, to resume interrupted import after the last batch stored")
+}
+
+func importCollection(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return fmt.Errorf("could not open %s, %w", args[1], err)
+	}
+	defer f.Close()
+
+	// archives are gzipped, NDJSON is not
+	magic := make([]byte, 2)
+	n, _ := io.ReadFull(f, magic)
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("could not read %s, %w", args[1], err)
+	}
+
+	if n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return importArchive(cmd, args[0], f)
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, create it before importing NDJSON, %w", err)
+	}
+
+	source, _ := cmd.Flags().GetString("source")
+	if source == "" {
+		source = args[1]
+	}
+
+	importedAt := time.Now().UTC()
+	return runImport(cmd, cfg.Type, args[0], func(write func([]byte, service.Provenance) error) error {
+		return readNDJSON(f, func(entry []byte) error {
+			return write(entry, service.Provenance{Source: source, ImportedAt: importedAt})
+		})
+	})
+}
+
+// importArchive recreates collection with definition from archive, and
+// imports its entries, with their original transactions as provenance.
+func importArchive(cmd *cobra.Command, collection string, f *os.File) error {
+	manifest, err := immudb.ReadArchiveManifest(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("could not read archive, %w", err)
+	}
+
+	err = immudb.SetupFromManifest(immuCli, collection, manifest)
+	if err != nil {
+		return fmt.Errorf("could not create collection, %w", err)
+	}
+
+	importedAt := time.Now().UTC()
+	return runImport(cmd, manifest.Config.Type, collection, func(write func([]byte, service.Provenance) error) error {
+		_, err := immudb.ReadArchive(f, func(immudb.ArchiveManifest) error {
+			return nil
+		}, func(ae immudb.ArchiveEntry) error {
+			return write(ae.Entry, service.Provenance{
+				Source:     manifest.Source,
+				Database:   manifest.State.Database,
+				Collection: manifest.Collection,
+				TxID:       ae.TxID,
+				Revision:   ae.Revision,
+				ImportedAt: importedAt,
+			})
+		})
+
+		return err
+	})
+}
+
+func runImport(cmd *cobra.Command, collectionType string, collection string, read func(write func([]byte, service.Provenance) error) error) error {
+	jsonRepository, err := newJsonRepository(collectionType, collection)
+	if err != nil {
+		return err
+	}
+
+	// both immudb repositories write batches
+	batchRepository := jsonRepository.(service.BatchRepository)
+
+	provenanceField, _ := cmd.Flags().GetString("provenance-field")
+	batchSize, _ := cmd.Flags().GetUint64("batch-size")
+	skip, _ := cmd.Flags().GetUint64("skip")
+	stats, err := service.NewImportService(batchRepository, provenanceField, batchSize, skip).Run(read)
+	if err != nil {
+		return fmt.Errorf("could not import, %w", err)
+	}
+
+	log.WithField("imported", stats.Imported).WithField("skipped", stats.Skipped).Info("Imported entries")
+	return nil
+}
+
+// readNDJSON streams json lines of r to fn, skipping empty ones.
+func readNDJSON(r io.Reader, fn func(entry []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		if !json.Valid(scanner.Bytes()) {
+			return fmt.Errorf("invalid json in line %d", line)
+		}
+
+		// scanner reuses its buffer
+		err := fn(append([]byte{}, scanner.Bytes()...))
+		if err != nil {
+			return err
+		}
+	}
+
+	if scanner.Err() != nil {
+		return fmt.Errorf("could not read line %d, %w", line+1, scanner.Err())
+	}
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/tidwall/gjson"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// Output formats of read and audit commands.
+const (
+	outputNDJSON = "ndjson"
+	outputJSON   = "json"
+	outputPretty = "pretty"
+	outputCSV    = "csv"
+	outputTable  = "table"
+)
+
+var flagOutput string
+var flagFields []string
+
+// addOutputFlags adds output flags shared by read and audit commands.
+func addOutputFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&flagOutput, "output", outputNDJSON, "Output format, one of ndjson, json (array), pretty, csv or table")
+	cmd.PersistentFlags().StringSliceVar(&flagFields, "fields", nil, "Fields of csv and table output, as gjson paths, e.g. tx_id,entry.user.username. When not specified, top-level fields of the first record are used.")
+}
+
+// envelope wraps audited entry with its immudb metadata. SQL rows have no
+// revisions, and their transaction is set only for current versions.
+type envelope struct {
+	TxID          uint64          `json:"tx_id,omitempty"`
+	Revision      uint64          `json:"revision,omitempty"`
+	Timestamp     *time.Time      `json:"timestamp,omitempty"`
+	Verified      *bool           `json:"verified,omitempty"`
+	ConfigVersion uint64          `json:"config_version,omitempty"`
+	Key           string          `json:"key,omitempty"`
+	Deleted       bool            `json:"deleted"`
+	Entry         json.RawMessage `json:"entry"`
+}
+
+// printer renders json records in output format. Flush needs to be called
+// after the last record.
+type printer interface {
+	Print(record []byte) error
+	Flush() error
+}
+
+func newPrinter(w io.Writer) (printer, error) {
+	switch flagOutput {
+	case outputNDJSON:
+		return &ndjsonPrinter{w: w}, nil
+	case outputJSON:
+		return &arrayPrinter{w: w}, nil
+	case outputPretty:
+		return &prettyPrinter{w: w}, nil
+	case outputCSV:
+		return &fieldsPrinter{fields: flagFields, writer: &csvRowWriter{w: csv.NewWriter(w)}}, nil
+	case outputTable:
+		return &fieldsPrinter{fields: flagFields, writer: &tableRowWriter{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}}, nil
+	}
+
+	return nil, fmt.Errorf("unknown output format %s", flagOutput)
+}
+
+// printRecords runs fn with printer writing to standard output, and flushes
+// the printer, also when fn fails, so partial output is complete.
+func printRecords(fn func(print func(record []byte) error) error) error {
+	p, err := newPrinter(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	err = fn(p.Print)
+	flushErr := p.Flush()
+	if err != nil {
+		return err
+	}
+
+	return flushErr
+}
+
+type ndjsonPrinter struct {
+	w io.Writer
+}
+
+func (p *ndjsonPrinter) Print(record []byte) error {
+	b := bytes.Buffer{}
+	err := json.Compact(&b, immudb.EntryJSON(record))
+	if err != nil {
+		return err
+	}
+	b.WriteString("\n")
+
+	_, err = p.w.Write(b.Bytes())
+	return err
+}
+
+func (p *ndjsonPrinter) Flush() error {
+	return nil
+}
+
+// arrayPrinter writes records as json array, streamed element by element.
+type arrayPrinter struct {
+	w io.Writer
+	n int
+}
+
+func (p *arrayPrinter) Print(record []byte) error {
+	separator := ",\n"
+	if p.n == 0 {
+		separator = "[\n"
+	}
+	p.n++
+
+	_, err := fmt.Fprintf(p.w, "%s%s", separator, immudb.EntryJSON(record))
+	return err
+}
+
+func (p *arrayPrinter) Flush() error {
+	if p.n == 0 {
+		_, err := fmt.Fprintln(p.w, "[]")
+		return err
+	}
+
+	_, err := fmt.Fprintln(p.w, "\n]")
+	return err
+}
+
+type prettyPrinter struct {
+	w io.Writer
+}
+
+func (p *prettyPrinter) Print(record []byte) error {
+	b := bytes.Buffer{}
+	err := json.Indent(&b, immudb.EntryJSON(record), "", "  ")
+	if err != nil {
+		return err
+	}
+	b.WriteString("\n")
+
+	_, err = p.w.Write(b.Bytes())
+	return err
+}
+
+func (p *prettyPrinter) Flush() error {
+	return nil
+}
+
+// rowWriter writes rows of fields printer.
+type rowWriter interface {
+	Write(row []string) error
+	Flush() error
+}
+
+// fieldsPrinter writes selected fields of records as rows, with header row.
+type fieldsPrinter struct {
+	fields []string
+	writer rowWriter
+	header bool
+}
+
+func (p *fieldsPrinter) Print(record []byte) error {
+	if !p.header {
+		if len(p.fields) == 0 {
+			gjson.ParseBytes(record).ForEach(func(key, _ gjson.Result) bool {
+				p.fields = append(p.fields, key.String())
+				return true
+			})
+		}
+
+		err := p.writer.Write(p.fields)
+		if err != nil {
+			return err
+		}
+		p.header = true
+	}
+
+	row := make([]string, len(p.fields))
+	for i, f := range p.fields {
+		v := gjson.GetBytes(record, f)
+		if v.Type == gjson.String {
+			row[i] = v.Str
+		} else {
+			row[i] = v.Raw
+		}
+	}
+
+	return p.writer.Write(row)
+}
+
+func (p *fieldsPrinter) Flush() error {
+	return p.writer.Flush()
+}
+
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (w *csvRowWriter) Write(row []string) error {
+	return w.w.Write(row)
+}
+
+func (w *csvRowWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type tableRowWriter struct {
+	w *tabwriter.Writer
+}
+
+func (w *tableRowWriter) Write(row []string) error {
+	// cells cannot span lines or columns
+	cells := make([]string, len(row))
+	for i, c := range row {
+		cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(c)
+	}
+
+	_, err := fmt.Fprintln(w.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (w *tableRowWriter) Flush() error {
+	return w.w.Flush()
+}
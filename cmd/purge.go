@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/user"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge <collection>",
+	Short: "Delete entries older than retention period of collection, recording tombstones",
+	Example: `immudb-audit purge samplecollection
+immudb-audit purge samplecollection --dry-run`,
+	RunE: purge,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(purgeCmd)
+	purgeCmd.Flags().Bool("dry-run", false, "If true, only show tombstones of entries which would be deleted")
+	purgeCmd.Flags().String("by", "", "Who applies retention, recorded in tombstones. When not specified, current user is used.")
+}
+
+func purge(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	by, _ := cmd.Flags().GetString("by")
+	if by == "" {
+		u, err := user.Current()
+		if err != nil {
+			return fmt.Errorf("could not get current user, use --by, %w", err)
+		}
+		by = u.Username
+	}
+
+	cfg, err := immudb.NewConfigs(immuCli).Read(args[0])
+	if err != nil {
+		return fmt.Errorf("collection is missing definition, %w", err)
+	}
+
+	var purger interface {
+		Purge(by string, dryRun bool, fn func(immudb.Tombstone) error) error
+	}
+
+	switch cfg.Type {
+	case "kv":
+		purger, err = immudb.NewJsonKVRepository(immuCli, args[0])
+	case "sql":
+		purger, err = immudb.NewJsonSQLRepository(immuCli, args[0])
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("could not create json repository, %w", err)
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	err = purger.Purge(by, dryRun, printTombstone)
+	if err != nil {
+		return fmt.Errorf("could not purge collection, %w", err)
+	}
+
+	return nil
+}
+
+func printTombstone(t immudb.Tombstone) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return printJson(b)
+}
@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
 )
 
+var flagLimit uint64
+var flagCursor string
+var flagDesc bool
+var flagAsOfTx uint64
+
 var readCmd = &cobra.Command{
 	Use:   "read",
 	Short: "Read audit data from immudb.",
@@ -12,6 +22,12 @@ var readCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(readCmd)
+	readCmd.PersistentFlags().Uint64Var(&flagLimit, "limit", 0, "Maximum number of entries to read. When not specified, all entries are read.")
+	readCmd.PersistentFlags().StringVar(&flagCursor, "cursor", "", "Cursor returned by previous read, to continue reading from.")
+	readCmd.PersistentFlags().BoolVar(&flagDesc, "desc", false, "If true, read entries in descending order.")
+	readCmd.PersistentFlags().Uint64Var(&flagAsOfTx, "as-of-tx", 0, "Read entries as they were at given transaction.")
+	addOutputFlags(readCmd)
+	readCmd.PersistentFlags().String("as-of-time", "", "Read entries as they were at given time, in RFC3339 or '2006-01-02 15:04:05' format. It is resolved to the last transaction committed until then, with second granularity, as immudb records commit time in seconds, so it includes all transactions committed within that second.")
 }
 
 func read(cmd *cobra.Command, args []string) error {
@@ -24,5 +40,46 @@ func read(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if cmd.Flags().Changed("as-of-time") {
+		if flagAsOfTx > 0 {
+			return errors.New("--as-of-tx and --as-of-time cannot be combined")
+		}
+
+		asOf, err := timeFromFlag(cmd, "as-of-time")
+		if err != nil {
+			return err
+		}
+
+		flagAsOfTx, err = immudb.TxAt(immuCli, asOf)
+		if err != nil {
+			return fmt.Errorf("could not resolve --as-of-time to transaction, %w", err)
+		}
+
+		// nothing was committed until then, so no entries are read
+		if flagAsOfTx == 0 {
+			return errors.New("no transaction committed until --as-of-time")
+		}
+	}
+
+	return nil
+}
+
+func readOptions() immudb.ReadOptions {
+	return immudb.ReadOptions{
+		Limit:  flagLimit,
+		Cursor: flagCursor,
+		Desc:   flagDesc,
+		AsOfTx: flagAsOfTx,
+	}
+}
+
+func printJson(j []byte) error {
+	fmt.Println(string(j))
 	return nil
 }
+
+func logNextCursor(cursor string) {
+	if cursor != "" {
+		log.WithField("cursor", cursor).Info("Limit reached, use --cursor to read next entries")
+	}
+}
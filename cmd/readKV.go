@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -13,13 +14,18 @@ var readKVCmd = &cobra.Command{
 	Short: "Read audit data from immudb key-value collection.",
 	Example: `immudb-audit read kv samplecollection
 immudb-audit read kv samplecollection indexed_field1=prefix1
-immudb-audit read kv samplecollection indexed_field2=prefix2`,
+immudb-audit read kv samplecollection indexed_field2=prefix2
+immudb-audit read kv samplecollection --limit 100 --desc
+immudb-audit read kv samplecollection scored_field=100..200
+immudb-audit read kv samplecollection --since "2023-03-16 10:00" --until "2023-03-16 11:00"`,
 	RunE: readKV,
 	Args: cobra.MinimumNArgs(1),
 }
 
 func init() {
 	readCmd.AddCommand(readKVCmd)
+	readKVCmd.Flags().String("since", "", "Read entries ingested since given time, in RFC3339 or '2006-01-02 15:04:05' format. Cannot be combined with indexed field.")
+	readKVCmd.Flags().String("until", "", "Read entries ingested until given time, in RFC3339 or '2006-01-02 15:04:05' format. Cannot be combined with indexed field.")
 }
 
 func readKV(cmd *cobra.Command, args []string) error {
@@ -44,14 +50,36 @@ func readKV(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	jsons, err := jr.Read(key, prefix)
+	since, err := timeFromFlag(cmd, "since")
 	if err != nil {
-		return fmt.Errorf("could not read, %w", err)
+		return err
 	}
 
-	for _, j := range jsons {
-		fmt.Println(string(j))
+	until, err := timeFromFlag(cmd, "until")
+	if err != nil {
+		return err
+	}
+
+	ingested := !since.IsZero() || !until.IsZero()
+	if ingested && len(args) > 1 {
+		return errors.New("ingestion time range cannot be combined with indexed field")
+	}
+
+	var cursor string
+	err = printRecords(func(print func([]byte) error) error {
+		var err error
+		if ingested {
+			cursor, err = jr.ReadIngested(since, until, readOptions(), print)
+		} else {
+			cursor, err = jr.Read(key, prefix, readOptions(), print)
+		}
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not read, %w", err)
 	}
 
+	logNextCursor(cursor)
 	return nil
 }
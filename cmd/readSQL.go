@@ -8,14 +8,20 @@ import (
 )
 
 var readSQLCmd = &cobra.Command{
-	Use:   "sql <collection> <<SQL query conditions>>",
+	Use:   "sql <collection>",
 	Short: "Read audit data from immudb SQL collection.",
-	RunE:  readSQL,
-	Args:  cobra.MinimumNArgs(1),
+	Example: `immudb-audit read sql samplecollection
+immudb-audit read sql samplecollection --filter "field1>=100" --filter "field2=abc"
+immudb-audit read sql samplecollection --filter "field2~^ab.*"
+immudb-audit read sql samplecollection --raw "field1 >= 100 OR field2 = 'abc'"`,
+	RunE: readSQL,
+	Args: cobra.ExactArgs(1),
 }
 
 func init() {
 	readCmd.AddCommand(readSQLCmd)
+	readSQLCmd.Flags().StringArray("filter", nil, "Filter in format <column><operator><value>, where operator is one of =, !=, >, >=, <, <= or ~ (LIKE). Can be repeated, filters are combined with AND.")
+	readSQLCmd.Flags().String("raw", "", "Raw SQL condition, as after WHERE clause. Use only with trusted input.")
 }
 
 func readSQL(cmd *cobra.Command, args []string) error {
@@ -29,19 +35,22 @@ func readSQL(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("could not create json kv repository, %w", err)
 	}
 
-	query := ""
-	if len(args) == 2 {
-		query = args[1]
+	filters, err := filtersFromFlags(cmd)
+	if err != nil {
+		return err
 	}
 
-	jsons, err := jr.Read(query)
+	raw, _ := cmd.Flags().GetString("raw")
+	var cursor string
+	err = printRecords(func(print func([]byte) error) error {
+		var err error
+		cursor, err = jr.Read(immudb.SQLQuery{Filters: filters, Raw: raw}, readOptions(), print)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("could not read, %w", err)
 	}
 
-	for _, j := range jsons {
-		fmt.Println(string(j))
-	}
-
+	logNextCursor(cursor)
 	return nil
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex <collection>",
+	Short: "Write index entries for existing entries of key-value collection",
+	Example: `immudb-audit reindex samplecollection --add field4
+immudb-audit reindex samplecollection --add field4,field5 --optional field5
+immudb-audit reindex samplecollection --status`,
+	RunE: reindex,
+	Args: cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+	reindexCmd.Flags().StringSlice("add", nil, "List of JSON fields to index. Fields not indexed yet are added to collection definition, already indexed ones are rebuilt.")
+	reindexCmd.Flags().StringSlice("optional", nil, "List of fields which can be missing in json")
+	reindexCmd.Flags().StringArray("default", nil, "Default value for field missing in json, in format field=value. Can be repeated.")
+	reindexCmd.Flags().Bool("status", false, "If true, show history of reindex operations instead")
+}
+
+func reindex(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	jr, err := immudb.NewJsonKVRepository(immuCli, args[0])
+	if err != nil {
+		return fmt.Errorf("could not create json kv repository, %w", err)
+	}
+
+	status, _ := cmd.Flags().GetBool("status")
+	if status {
+		events, err := jr.ReindexHistory()
+		if err != nil {
+			return fmt.Errorf("could not get reindex history, %w", err)
+		}
+
+		for _, e := range events {
+			b, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+
+			err = printJson(b)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	fields, _ := cmd.Flags().GetStringSlice("add")
+	if len(fields) == 0 {
+		return errors.New("at least one field needs to be specified with --add")
+	}
+
+	policies, err := indexPoliciesFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	err = jr.Reindex(fields, policies)
+	if err != nil {
+		return fmt.Errorf("could not reindex, %w", err)
+	}
+
+	return nil
+}
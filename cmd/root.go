@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/codenotary/immudb/pkg/client"
 	log "github.com/sirupsen/logrus"
@@ -45,6 +46,7 @@ func init() {
 	rootCmd.SetUsageTemplate(usageTemplate)
 	rootCmd.PersistentFlags().String("immudb-host", "localhost", "immudb host")
 	rootCmd.PersistentFlags().Int("immudb-port", 3322, "immudb port")
+	rootCmd.PersistentFlags().String("immudb-state-dir", ".", "Directory of immudb client state files, .identity-* and .state-*, used to verify immudb")
 	rootCmd.PersistentFlags().String("log-level", "info", "Log level (trace, debug, info, warn, error)")
 
 }
@@ -54,24 +56,52 @@ func root(cmd *cobra.Command, args []string) error {
 		return cmd.Help()
 	}
 
-	logLevelString, _ := cmd.Flags().GetString("log-level")
-	logLevel, err := log.ParseLevel(logLevelString)
+	err := setLogLevel(cmd)
 	if err != nil {
 		return err
 	}
 
-	log.SetLevel(logLevel)
-
 	immudbHost, _ := cmd.Flags().GetString("immudb-host")
 	immudbPort, _ := cmd.Flags().GetInt("immudb-port")
-	opts := client.DefaultOptions().WithAddress(immudbHost).WithPort(immudbPort)
+	immudbStateDir, _ := cmd.Flags().GetString("immudb-state-dir")
+	opts := client.DefaultOptions().WithAddress(immudbHost).WithPort(immudbPort).WithDir(immudbStateDir)
 	immuCli = client.NewClient().WithOptions(opts)
 
-	err = immuCli.OpenSession(context.TODO(), []byte(`immudb`), []byte(`immudb`), "defaultdb")
+	return openSession()
+}
+
+func openSession() error {
+	return immuCli.OpenSession(context.TODO(), []byte(`immudb`), []byte(`immudb`), "defaultdb")
+}
+
+// sessionMu guards reopening of session against its concurrent health checks.
+var sessionMu sync.RWMutex
+
+func reopenSession() error {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	immuCli.CloseSession(context.TODO())
+	return openSession()
+}
+
+// checkSession checks session is open and database is usable.
+func checkSession(ctx context.Context) error {
+	sessionMu.RLock()
+	defer sessionMu.RUnlock()
+
+	_, err := immuCli.Health(ctx)
+	return err
+}
+
+func setLogLevel(cmd *cobra.Command) error {
+	logLevelString, _ := cmd.Flags().GetString("log-level")
+	logLevel, err := log.ParseLevel(logLevelString)
 	if err != nil {
 		return err
 	}
 
+	log.SetLevel(logLevel)
 	return nil
 }
 
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/grpcapi"
+	"github.com/tomekkolo/immudb-play/pkg/health"
+	"github.com/tomekkolo/immudb-play/pkg/rest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve read-only HTTP JSON API over collections, and optionally gRPC API for ingestion and query",
+	Example: `immudb-audit serve --addr :8080
+curl "localhost:8080/collections/samplecollection/entries?field=user&value=adm&limit=10"
+immudb-audit serve --addr :8080 --grpc-addr localhost:9090
+immudb-audit serve --addr :8080 --grpc-addr :9090 --grpc-token-file token --grpc-tls-cert cert.pem --grpc-tls-key key.pem`,
+	RunE: serve,
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().String("addr", ":8080", "Address to listen on")
+	serveCmd.Flags().String("grpc-addr", "", "Address to serve gRPC API on, see pkg/grpcapi/auditpb/audit.proto. Disabled if empty. API creates collections and ingests entries, so addresses other than loopback require --grpc-token-file")
+	serveCmd.Flags().String("grpc-token-file", "", "File with token, which gRPC calls must send as \"authorization: Bearer <token>\" metadata")
+	serveCmd.Flags().String("grpc-tls-cert", "", "Certificate file of gRPC server, enables TLS together with --grpc-tls-key")
+	serveCmd.Flags().String("grpc-tls-key", "", "Private key file of gRPC server")
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	addr, _ := cmd.Flags().GetString("addr")
+	restServer := rest.NewServer(immuCli)
+	health.NewChecker(checkSession, health.DefaultStuckAfter).Register(restServer)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           restServer,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var grpcServer *grpc.Server
+	grpcAddr, _ := cmd.Flags().GetString("grpc-addr")
+	if grpcAddr != "" {
+		opts, err := grpcServerOptions(cmd, grpcAddr)
+		if err != nil {
+			return err
+		}
+
+		grpcServer = grpc.NewServer(opts...)
+		grpcapi.NewServer(immuCli).Register(grpcServer)
+	}
+
+	return listenAndServe(server, grpcServer, grpcAddr)
+}
+
+// grpcServerOptions configures token authentication and TLS of gRPC server.
+// Serving without token is allowed on loopback address only, as the API
+// writes to immudb.
+func grpcServerOptions(cmd *cobra.Command, grpcAddr string) ([]grpc.ServerOption, error) {
+	opts := []grpc.ServerOption{}
+	tokenFile, _ := cmd.Flags().GetString("grpc-token-file")
+	if tokenFile != "" {
+		b, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read gRPC token, %w", err)
+		}
+
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return nil, fmt.Errorf("gRPC token file %s is empty", tokenFile)
+		}
+
+		opts = append(opts, grpcapi.TokenAuth(token)...)
+	} else if !isLoopback(grpcAddr) {
+		return nil, fmt.Errorf("gRPC API on %s would be exposed without authentication, use --grpc-token-file or loopback address, e.g. localhost:9090", grpcAddr)
+	}
+
+	certFile, _ := cmd.Flags().GetString("grpc-tls-cert")
+	keyFile, _ := cmd.Flags().GetString("grpc-tls-key")
+	if certFile != "" || keyFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load gRPC TLS certificate, %w", err)
+		}
+
+		opts = append(opts, grpc.Creds(creds))
+	} else if tokenFile != "" && !isLoopback(grpcAddr) {
+		log.WithField("addr", grpcAddr).Warn("Serving gRPC without TLS, token is sent in plain text")
+	}
+
+	return opts, nil
+}
+
+// isLoopback tells if address listens on loopback interface only.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// listenAndServe serves until interrupted, and then shuts servers down
+// gracefully. gRPC server is optional.
+func listenAndServe(server *http.Server, grpcServer *grpc.Server, grpcAddr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 2)
+	go func() {
+		log.WithField("addr", server.Addr).Info("Serving")
+		errCh <- server.ListenAndServe()
+	}()
+
+	if grpcServer != nil {
+		lis, err := net.Listen("tcp", grpcAddr)
+		if err != nil {
+			return fmt.Errorf("could not listen on %s, %w", grpcAddr, err)
+		}
+
+		go func() {
+			log.WithField("addr", grpcAddr).Info("Serving gRPC")
+			errCh <- grpcServer.Serve(lis)
+		}()
+		defer grpcServer.GracefulStop()
+	}
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("could not serve, %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("could not shut down, %w", err)
+	}
+
+	return nil
+}
@@ -2,14 +2,26 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/health"
 	"github.com/tomekkolo/immudb-play/pkg/lineparser"
+	"github.com/tomekkolo/immudb-play/pkg/metrics"
 	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
 	"github.com/tomekkolo/immudb-play/pkg/service"
 )
 
 var flagFollow bool
+var flagMetricsAddr string
+var flagHealthAddr string
+var flagWriteStuckAfter time.Duration
+var flagHealthLinger time.Duration
+var flagWriteIdleAfter time.Duration
 
 var tailCmd = &cobra.Command{
 	Use:   "tail",
@@ -20,6 +32,11 @@ var tailCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(tailCmd)
 	tailCmd.PersistentFlags().BoolVar(&flagFollow, "follow", false, "If True, follow data stream. The follower supports file rotation.")
+	tailCmd.PersistentFlags().StringVar(&flagMetricsAddr, "metrics-addr", "", "If set, expose Prometheus metrics on this address, e.g. :9090, at /metrics")
+	tailCmd.PersistentFlags().StringVar(&flagHealthAddr, "health-addr", "", "If set, serve /healthz and /readyz probes on this address, can be the same as --metrics-addr")
+	tailCmd.PersistentFlags().DurationVar(&flagWriteStuckAfter, "write-stuck-after", health.DefaultStuckAfter, "Readiness fails when write to immudb takes longer")
+	tailCmd.PersistentFlags().DurationVar(&flagWriteIdleAfter, "write-idle-after", 0, "If set, readiness fails also when there is no successful write for longer while source is open. Meant for sources producing entries continuously, as quiet ones fail it too")
+	tailCmd.PersistentFlags().DurationVar(&flagHealthLinger, "health-linger", 30*time.Second, "When tail fails, keep serving probes for this long before exit, so failing liveness can be observed")
 }
 
 func tail(cmd *cobra.Command, args []string) error {
@@ -70,3 +87,116 @@ func newJsonRepository(rType string, collection string) (service.JsonRepository,
 	}
 	return jsonRepository, nil
 }
+
+// newAuditService creates audit service of collection, recording its
+// metrics and health and reconnecting to immudb, and starts metrics and
+// health servers if enabled.
+func newAuditService(collection string, lp service.LineProvider, parser service.LineParser, jsonRepository service.JsonRepository) *service.AuditService {
+	checker := health.NewChecker(checkSession, flagWriteStuckAfter).WithIdleAfter(flagWriteIdleAfter)
+
+	// metrics and probes share server when addresses are the same
+	muxes := map[string]*http.ServeMux{}
+	muxOf := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if flagMetricsAddr != "" {
+		muxOf(flagMetricsAddr).Handle("/metrics", promhttp.Handler())
+	}
+
+	if flagHealthAddr != "" {
+		checker.Register(muxOf(flagHealthAddr))
+	}
+
+	for addr, mux := range muxes {
+		go serveMonitoring(addr, mux)
+	}
+
+	jsonRepository = &reconnectingRepository{jsonRepository: jsonRepository}
+	return service.NewAuditService(lp, parser, jsonRepository).
+		WithMetrics(metrics.NewPipeline(collection)).
+		WithHealth(checker)
+}
+
+// runAuditService runs service till its source ends. When it fails while
+// probes are served, they keep being served for --health-linger, so failing
+// liveness can be observed before the process exits.
+func runAuditService(s *service.AuditService) error {
+	err := s.Run()
+	if err != nil && flagHealthAddr != "" && flagHealthLinger > 0 {
+		log.WithError(err).WithField("linger", flagHealthLinger).Error("Tail failed, serving probes before exit")
+		time.Sleep(flagHealthLinger)
+	}
+
+	return err
+}
+
+func serveMonitoring(addr string, mux *http.ServeMux) {
+	log.WithField("addr", addr).Info("Serving monitoring endpoints")
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		log.WithError(err).Error("Monitoring server stopped")
+	}
+}
+
+// reconnectingRepository reopens immudb session, when session was lost, e.g.
+// immudb was restarted during long running tail. Write which failed with it
+// may have been committed, so it is retried once, only if repository tells
+// the entry is not stored. Otherwise the error is returned.
+type reconnectingRepository struct {
+	jsonRepository service.JsonRepository
+}
+
+// storedChecker is implemented by repositories which can tell if entry is
+// already stored.
+type storedChecker interface {
+	Stored(b []byte) (uint64, bool, error)
+}
+
+func (rr *reconnectingRepository) WriteBytes(b []byte) (uint64, error) {
+	id, err := rr.jsonRepository.WriteBytes(b)
+	if err == nil || !isSessionLost(err) {
+		return id, err
+	}
+
+	log.WithError(err).Warn("Lost immudb session, reconnecting")
+	rerr := reopenSession()
+	if rerr != nil {
+		return 0, fmt.Errorf("could not reconnect to immudb, %w", rerr)
+	}
+
+	metrics.Reconnected()
+	checker, ok := rr.jsonRepository.(storedChecker)
+	if !ok {
+		return 0, err
+	}
+
+	id, stored, serr := checker.Stored(b)
+	if serr != nil {
+		return 0, fmt.Errorf("could not check if entry was stored before session was lost, %w", serr)
+	}
+
+	if stored {
+		log.WithField("txID", id).Info("Entry was stored before session was lost")
+		return id, nil
+	}
+
+	return rr.jsonRepository.WriteBytes(b)
+}
+
+// isSessionLost tells if error is caused by closed connection or session
+// expired on server. Errors are matched by message, as repositories wrap
+// them.
+func isSessionLost(err error) bool {
+	msg := err.Error()
+	for _, lost := range []string{"no session found", "session not found", "not connected", "connection error", "connection refused", "code = Unavailable"} {
+		if strings.Contains(msg, lost) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -6,7 +6,6 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
-	"github.com/tomekkolo/immudb-play/pkg/service"
 	"github.com/tomekkolo/immudb-play/pkg/source"
 )
 
@@ -50,8 +49,8 @@ func tailDocker(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalide source: %w", err)
 	}
 
-	s := service.NewAuditService(dockerTail, lp, jsonRepository)
-	return s.Run()
+	s := newAuditService(args[0], dockerTail, lp, jsonRepository)
+	return runAuditService(s)
 }
 
 func init() {
@@ -5,7 +5,6 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
-	"github.com/tomekkolo/immudb-play/pkg/service"
 	"github.com/tomekkolo/immudb-play/pkg/source"
 )
 
@@ -44,8 +43,8 @@ func tailFile(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid source: %w", err)
 	}
 
-	s := service.NewAuditService(fileTail, lp, jsonRepository)
-	return s.Run()
+	s := newAuditService(args[0], fileTail, lp, jsonRepository)
+	return runAuditService(s)
 }
 
 func init() {
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var tombstonesCmd = &cobra.Command{
+	Use:     "tombstones <collection>",
+	Short:   "List tombstones of entries deleted by retention",
+	Example: `immudb-audit tombstones samplecollection`,
+	RunE:    tombstones,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(tombstonesCmd)
+}
+
+func tombstones(cmd *cobra.Command, args []string) error {
+	err := runParentCmdE(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	err = immudb.ReadTombstones(immuCli, args[0], printTombstone)
+	if err != nil {
+		return fmt.Errorf("could not read tombstones, %w", err)
+	}
+
+	return nil
+}
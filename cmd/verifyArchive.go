@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+var verifyArchiveCmd = &cobra.Command{
+	Use:   "verify-archive <file>",
+	Short: "Verify archive created with export, without connecting to immudb",
+	Long: `Verify archive created with export, without connecting to immudb.
+Archive proves entries against immudb state stored in it, so that state must
+match the trusted one given with --tx-id and --tx-hash, obtained independently,
+e.g. from immudb or a previous audit.`,
+	Example: `immudb-audit verify-archive archive.tar.gz --tx-id 1234 --tx-hash 5e2f...`,
+	RunE:    verifyArchive,
+	Args:    cobra.ExactArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(verifyArchiveCmd)
+	verifyArchiveCmd.Flags().Uint64("tx-id", 0, "Transaction of trusted immudb state archive must be proven against")
+	verifyArchiveCmd.Flags().String("tx-hash", "", "Hex encoded hash of trusted immudb state archive must be proven against")
+	verifyArchiveCmd.Flags().String("database", "", "If set, database of trusted immudb state")
+	verifyArchiveCmd.MarkFlagRequired("tx-id")
+	verifyArchiveCmd.MarkFlagRequired("tx-hash")
+}
+
+// archiveFailure is printed for every entry of archive which failed
+// verification.
+type archiveFailure struct {
+	Key   string
+	TxID  uint64
+	Error string
+}
+
+func verifyArchive(cmd *cobra.Command, args []string) error {
+	// archive is verified offline, so immudb session is not opened
+	err := setLogLevel(cmd)
+	if err != nil {
+		return err
+	}
+
+	txID, _ := cmd.Flags().GetUint64("tx-id")
+	txHash, _ := cmd.Flags().GetString("tx-hash")
+	database, _ := cmd.Flags().GetString("database")
+	trusted := immudb.ArchiveState{Database: database, TxID: txID, TxHash: txHash}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("could not open archive, %w", err)
+	}
+	defer f.Close()
+
+	failed := 0
+	manifest, err := immudb.VerifyArchive(f, trusted, func(ae immudb.ArchiveEntry, verifyErr error) error {
+		if verifyErr == nil {
+			return nil
+		}
+
+		failed++
+		b, err := json.Marshal(archiveFailure{Key: ae.Key, TxID: ae.TxID, Error: verifyErr.Error()})
+		if err != nil {
+			return err
+		}
+
+		return printJson(b)
+	})
+	if err != nil {
+		return fmt.Errorf("could not verify archive, %w", err)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d entries failed verification", failed, manifest.Entries)
+	}
+
+	log.WithField("collection", manifest.Collection).
+		WithField("entries", manifest.Entries).
+		WithField("database", manifest.State.Database).
+		WithField("tx_id", manifest.State.TxID).
+		WithField("tx_hash", manifest.State.TxHash).
+		Info("All entries verified against trusted state")
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package auditclient lets applications write audit entries directly to
+// collections created with immudb-audit, and read and verify them back,
+// without dealing with immudb sessions, collection definitions, or whether
+// collection is key-value or SQL.
+//
+//	c, err := auditclient.Open(ctx, auditclient.Options{Address: "immudb"})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close(ctx)
+//
+//	events, err := c.Collection(ctx, "events")
+//	if err != nil {
+//		return err
+//	}
+//
+//	txID, err := events.Write(ctx, Event{ID: "1", User: "adm"})
+//
+// Client and collections are safe for concurrent use. Batches of SQL
+// collections are written in transactions of client session, which allows
+// only one of them at once, so they are serialized by client. Client created
+// with New does not serialize them with transactions of the application
+// sharing its session.
+package auditclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	immudbclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// BatchSize is maximum number of entries WriteBatch stores in single
+// transaction, larger batches are split. It keeps transactions of indexed
+// collections within immudb limit of entries per transaction.
+const BatchSize = 50
+
+var (
+	// ErrOverwriteRejected is returned by Write of existing primary key into
+	// collection with reject overwrite policy.
+	ErrOverwriteRejected = immudb.ErrOverwriteRejected
+	// ErrNotFound is returned for collections or entries which do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrNotVerified is returned by Verify if any revision failed
+	// verification.
+	ErrNotVerified = errors.New("entry not verified")
+)
+
+// Options of connection to immudb. Zero values default to the same values
+// as immudb-audit flags.
+type Options struct {
+	Address  string // localhost
+	Port     int    // 3322
+	Username string // immudb
+	Password string // immudb
+	Database string // defaultdb
+	StateDir string // directory of immudb client state, working directory if empty
+}
+
+type Client struct {
+	cli        immudbclient.ImmuClient
+	ownSession bool
+	txMu       *sync.Mutex // serializes read write transactions of session
+}
+
+// Open opens immudb session, which is closed with Close.
+func Open(ctx context.Context, opts Options) (*Client, error) {
+	if opts.Address == "" {
+		opts.Address = "localhost"
+	}
+	if opts.Port == 0 {
+		opts.Port = 3322
+	}
+	if opts.Username == "" {
+		opts.Username = "immudb"
+	}
+	if opts.Password == "" {
+		opts.Password = "immudb"
+	}
+	if opts.Database == "" {
+		opts.Database = "defaultdb"
+	}
+
+	clientOpts := immudbclient.DefaultOptions().WithAddress(opts.Address).WithPort(opts.Port)
+	if opts.StateDir != "" {
+		clientOpts = clientOpts.WithDir(opts.StateDir)
+	}
+
+	cli := immudbclient.NewClient().WithOptions(clientOpts)
+	err := cli.OpenSession(ctx, []byte(opts.Username), []byte(opts.Password), opts.Database)
+	if err != nil {
+		return nil, fmt.Errorf("could not open immudb session, %w", err)
+	}
+
+	return &Client{cli: cli, ownSession: true, txMu: &sync.Mutex{}}, nil
+}
+
+// New creates client using immudb client with already opened session, which
+// is not closed by Close.
+func New(cli immudbclient.ImmuClient) *Client {
+	return &Client{cli: cli, txMu: &sync.Mutex{}}
+}
+
+// Close closes immudb session opened by Open.
+func (c *Client) Close(ctx context.Context) error {
+	if !c.ownSession {
+		return nil
+	}
+
+	return c.cli.CloseSession(ctx)
+}
+
+// Collections lists names of existing collections.
+func (c *Client) Collections(ctx context.Context) ([]string, error) {
+	cfgs := immudb.NewConfigs(immudb.WithContext(ctx, c.cli))
+	names, err := cfgs.List()
+	if err != nil {
+		return nil, err
+	}
+
+	collections := []string{}
+	for _, name := range names {
+		cfg, err := cfgs.Read(name)
+		if err != nil {
+			return nil, fmt.Errorf("could not read definition of %s, %w", name, err)
+		}
+
+		if !cfg.Dropped {
+			collections = append(collections, name)
+		}
+	}
+
+	return collections, nil
+}
+
+// Collection opens existing collection by name. Collection keeps definition
+// it was opened with, so it should be opened again after collection is
+// altered.
+func (c *Client) Collection(ctx context.Context, name string) (*Collection, error) {
+	cli := immudb.WithContext(ctx, c.cli)
+	cfg, err := immudb.NewConfigs(cli).Read(name)
+	if err != nil {
+		if immudb.IsNotFound(err) {
+			return nil, fmt.Errorf("collection %s %w", name, ErrNotFound)
+		}
+
+		return nil, fmt.Errorf("could not read definition of %s, %w", name, err)
+	}
+
+	if cfg.Dropped {
+		return nil, fmt.Errorf("collection %s was dropped, %w", name, ErrNotFound)
+	}
+
+	collection := &Collection{name: name, cfg: cfg, txMu: c.txMu}
+	switch cfg.Type {
+	case "kv":
+		collection.kv, err = immudb.NewJsonKVRepository(cli, name)
+	case "sql":
+		collection.sql, err = immudb.NewJsonSQLRepository(cli, name)
+	default:
+		return nil, fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open collection %s, %w", name, err)
+	}
+
+	return collection, nil
+}
@@ -0,0 +1,151 @@
+package auditclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// newClient opens client to server with kv and sql collections, storing
+// client state in dir.
+func newClient(t *testing.T, dir string) *Client {
+	t.Helper()
+
+	srv := immudbtest.NewT(t)
+	cli := srv.Client(t)
+	err := immudb.CreateCollection(cli, "kv", immudb.Config{Type: "kv", Indexes: []string{"id"}}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = immudb.CreateCollection(cli, "sql", immudb.Config{Type: "sql", Indexes: []string{"id=INTEGER"}, MissingFields: immudb.MissingFieldsError}, []string{"id"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Open(context.Background(), Options{Address: srv.Host, Port: srv.Port, StateDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		c.Close(context.Background())
+	})
+	return c
+}
+
+func TestCancelledContext(t *testing.T) {
+	c := newClient(t, t.TempDir())
+	for _, name := range []string{"kv", "sql"} {
+		collection, err := c.Collection(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err = collection.Write(ctx, map[string]interface{}{"id": 1})
+		if !isCanceled(err) {
+			t.Errorf("%s: expected write to fail with cancelled context, got %v", name, err)
+		}
+
+		_, err = collection.Read(ctx, Query{}, func(json.RawMessage) error { return nil })
+		if !isCanceled(err) {
+			t.Errorf("%s: expected read to fail with cancelled context, got %v", name, err)
+		}
+
+		// collection is still usable with live context
+		_, err = collection.Write(context.Background(), map[string]interface{}{"id": 1})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+}
+
+// isCanceled matches cancellation returned by grpc, which does not wrap
+// context error.
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || err != nil && strings.Contains(err.Error(), "context canceled")
+}
+
+func TestConcurrentSQLBatches(t *testing.T) {
+	c := newClient(t, t.TempDir())
+	collection, err := c.Collection(context.Background(), "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 8)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			entries := []interface{}{}
+			for i := 0; i < 10; i++ {
+				entries = append(entries, map[string]interface{}{"id": w*10 + i})
+			}
+
+			_, err := collection.WriteBatch(context.Background(), entries)
+			errs <- err
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 0
+	_, err = collection.Read(context.Background(), Query{}, func(json.RawMessage) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 80 {
+		t.Fatalf("expected 80 entries, got %d", n)
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	dir := t.TempDir()
+	c := newClient(t, dir)
+	collection, err := c.Collection(context.Background(), "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = collection.Write(context.Background(), map[string]interface{}{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// verification stores verified state of client
+	_, err = collection.Verify(context.Background(), "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("expected client state in state dir")
+	}
+}
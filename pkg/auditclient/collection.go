@@ -0,0 +1,308 @@
+package auditclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// Collection writes and reads entries of single collection, of either type.
+type Collection struct {
+	name string
+	cfg  *immudb.Config
+	kv   *immudb.JsonKVRepository
+	sql  *immudb.JsonSQLRepository
+	txMu *sync.Mutex
+}
+
+// Query narrows down Read. Field, Value, Since and Until apply to key-value
+// collections, Filters to SQL ones.
+type Query struct {
+	Field string // indexed field, primary key if empty
+	Value string // value prefix of field
+
+	// ingestion time range, cannot be combined with Field
+	Since time.Time
+	Until time.Time
+
+	Filters []string // e.g. "user=adm", "age>=18"
+
+	Limit  uint64 // maximum number of entries, 0 means all
+	Cursor string // cursor returned by previous Read, to continue from
+	Desc   bool
+	AsOfTx uint64 // read entries as they were at transaction
+}
+
+// Revision of entry. Transaction and revision are known for key-value
+// entries only.
+type Revision struct {
+	Key      string
+	TxID     uint64
+	Revision uint64
+	Deleted  bool
+	Entry    json.RawMessage
+
+	// set by Verify only
+	Verified bool
+	Error    string
+}
+
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Type of collection, kv or sql.
+func (c *Collection) Type() string {
+	return c.cfg.Type
+}
+
+// Write stores entry, and returns transaction it was stored in. Entry is
+// marshalled to json, unless it already is []byte or json.RawMessage.
+func (c *Collection) Write(ctx context.Context, entry interface{}) (uint64, error) {
+	b, err := marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.kv != nil {
+		return c.kv.WithContext(ctx).WriteBytes(b)
+	}
+
+	return c.sql.WithContext(ctx).WriteBytes(b)
+}
+
+// WriteBatch stores entries in transactions of up to BatchSize entries, and
+// returns transaction of each of them. Entries rejected by overwrite policy
+// get 0 transaction id. If context is cancelled between transactions, ids of
+// entries already stored are returned with context error.
+func (c *Collection) WriteBatch(ctx context.Context, entries []interface{}) ([]uint64, error) {
+	objects := make([][]byte, len(entries))
+	for i, entry := range entries {
+		b, err := marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %d, %w", i+1, err)
+		}
+
+		objects[i] = b
+	}
+
+	txIDs := []uint64{}
+	for len(objects) > 0 {
+		if err := ctx.Err(); err != nil {
+			return txIDs, err
+		}
+
+		n := len(objects)
+		if n > BatchSize {
+			n = BatchSize
+		}
+
+		ids, err := c.writeBatch(ctx, objects[:n])
+		txIDs = append(txIDs, ids...)
+		if err != nil {
+			return txIDs, err
+		}
+
+		objects = objects[n:]
+	}
+
+	return txIDs, nil
+}
+
+func (c *Collection) writeBatch(ctx context.Context, objects [][]byte) ([]uint64, error) {
+	if c.kv != nil {
+		return c.kv.WithContext(ctx).WriteBytesBatch(objects)
+	}
+
+	// session allows only one read write transaction at once
+	c.txMu.Lock()
+	defer c.txMu.Unlock()
+
+	return c.sql.WithContext(ctx).WriteBytesBatch(objects)
+}
+
+// Read streams entries matching query to fn. If limit is reached, it returns
+// cursor to continue reading from, otherwise empty string.
+func (c *Collection) Read(ctx context.Context, q Query, fn func(entry json.RawMessage) error) (string, error) {
+	opts := immudb.ReadOptions{Limit: q.Limit, Cursor: q.Cursor, Desc: q.Desc, AsOfTx: q.AsOfTx}
+	read := func(object []byte) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		return fn(object)
+	}
+
+	if c.kv != nil {
+		kv := c.kv.WithContext(ctx)
+		if len(q.Filters) > 0 {
+			return "", fmt.Errorf("filters are not supported by key-value collection %s", c.name)
+		}
+
+		if !q.Since.IsZero() || !q.Until.IsZero() {
+			if q.Field != "" {
+				return "", errors.New("ingestion time range cannot be combined with field")
+			}
+
+			return kv.ReadIngested(q.Since, q.Until, opts, read)
+		}
+
+		return kv.Read(q.Field, q.Value, opts, read)
+	}
+
+	if q.Field != "" || q.Value != "" || !q.Since.IsZero() || !q.Until.IsZero() {
+		return "", fmt.Errorf("SQL collection %s is read with filters only", c.name)
+	}
+
+	filters := []immudb.Filter{}
+	for _, f := range q.Filters {
+		filter, err := immudb.ParseFilter(f)
+		if err != nil {
+			return "", err
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return c.sql.WithContext(ctx).Read(immudb.SQLQuery{Filters: filters}, opts, read)
+}
+
+// History streams revisions of entry with primary key value to fn, from the
+// oldest. Composite primary key of SQL collection is given as json array.
+func (c *Collection) History(ctx context.Context, key string, fn func(Revision) error) error {
+	found := false
+	var err error
+	if c.kv != nil {
+		err = c.kv.WithContext(ctx).KeyHistory(key, 0, 0, func(h immudb.History) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			found = true
+			return fn(revisionOf(h))
+		})
+	} else {
+		sql := c.sql.WithContext(ctx)
+		var filters []immudb.Filter
+		filters, err = sql.PrimaryKeyFilters(key)
+		if err != nil {
+			return err
+		}
+
+		_, err = sql.History(immudb.SQLQuery{Filters: filters}, immudb.ReadOptions{}, func(object []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			found = true
+			return fn(Revision{Key: key, Entry: object})
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("entry %s %w", key, ErrNotFound)
+	}
+
+	return nil
+}
+
+// Verify verifies all revisions of key-value entry, or current SQL row,
+// against immudb state. Revisions are returned with result of their
+// verification, and ErrNotVerified if any of them failed.
+func (c *Collection) Verify(ctx context.Context, key string) ([]Revision, error) {
+	revisions := []Revision{}
+	if c.kv != nil {
+		kv := c.kv.WithContext(ctx)
+		err := kv.KeyHistory(key, 0, 0, func(h immudb.History) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			r := revisionOf(h)
+			verifyErr := kv.VerifyHistory(h)
+			r.Verified = verifyErr == nil
+			if verifyErr != nil {
+				r.Error = verifyErr.Error()
+			}
+
+			revisions = append(revisions, r)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		sql := c.sql.WithContext(ctx)
+		filters, err := sql.PrimaryKeyFilters(key)
+		if err != nil {
+			return nil, err
+		}
+
+		// row is read separately, as failed verification does not return it
+		_, err = sql.Read(immudb.SQLQuery{Filters: filters}, immudb.ReadOptions{Limit: 1}, func(object []byte) error {
+			r := Revision{Key: key, Entry: object}
+			_, verifyErr := sql.VerifyRow(key)
+			r.Verified = verifyErr == nil
+			if verifyErr != nil {
+				r.Error = verifyErr.Error()
+			}
+
+			revisions = append(revisions, r)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("entry %s %w", key, ErrNotFound)
+	}
+
+	for _, r := range revisions {
+		if !r.Verified {
+			return revisions, fmt.Errorf("%w, revision %d, %s", ErrNotVerified, r.Revision, r.Error)
+		}
+	}
+
+	return revisions, nil
+}
+
+func revisionOf(h immudb.History) Revision {
+	r := Revision{Key: h.Key, TxID: h.TxID, Revision: h.Revision, Deleted: h.Deleted}
+	if !h.Deleted {
+		r.Entry = h.Entry
+	}
+
+	return r
+}
+
+func marshal(entry interface{}) ([]byte, error) {
+	var b []byte
+	switch e := entry.(type) {
+	case []byte:
+		b = e
+	case json.RawMessage:
+		b = e
+	default:
+		var err error
+		b, err = json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal entry, %w", err)
+		}
+	}
+
+	if !json.Valid(b) {
+		return nil, errors.New("entry is not valid json")
+	}
+
+	return b, nil
+}
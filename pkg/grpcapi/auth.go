@@ -0,0 +1,46 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/subtle"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// TokenAuth returns server options, which reject calls without bearer
+// token in authorization metadata, e.g. "authorization: Bearer <token>".
+func TokenAuth(token string) []grpc.ServerOption {
+	expected := []byte("Bearer " + token)
+	authorize := func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			if subtle.ConstantTimeCompare([]byte(v), expected) == 1 {
+				return nil
+			}
+		}
+
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			err := authorize(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			err := authorize(ss.Context())
+			if err != nil {
+				return err
+			}
+
+			return handler(srv, ss)
+		}),
+	}
+}
@@ -0,0 +1,362 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	immudbclient "github.com/codenotary/immudb/pkg/client"
+	"github.com/tomekkolo/immudb-play/pkg/grpcapi/auditpb"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+	"github.com/tomekkolo/immudb-play/pkg/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements auditpb.AuditServiceServer over collections, see
+// audit.proto.
+type Server struct {
+	auditpb.UnimplementedAuditServiceServer
+	client immudbclient.ImmuClient
+
+	// writeMu serializes writes of concurrent streams, as immudb fails SQL
+	// writes conflicting with concurrent ones
+	writeMu sync.Mutex
+}
+
+func NewServer(cli immudbclient.ImmuClient) *Server {
+	return &Server{client: cli}
+}
+
+// Register registers server with grpc server.
+func (s *Server) Register(gs *grpc.Server) {
+	auditpb.RegisterAuditServiceServer(gs, s)
+}
+
+func (s *Server) ListCollections(ctx context.Context, req *auditpb.ListCollectionsRequest) (*auditpb.ListCollectionsResponse, error) {
+	cfgs := immudb.NewConfigs(s.client)
+	names, err := cfgs.List()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	response := &auditpb.ListCollectionsResponse{}
+	for _, name := range names {
+		cfg, err := cfgs.Read(name)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "could not read definition of %s, %s", name, err)
+		}
+
+		if !cfg.Dropped {
+			response.Collections = append(response.Collections, &auditpb.Collection{Name: name, Type: cfg.Type})
+		}
+	}
+
+	return response, nil
+}
+
+func (s *Server) GetCollection(ctx context.Context, req *auditpb.GetCollectionRequest) (*auditpb.Collection, error) {
+	cfg, err := s.config(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectionOf(req.Name, cfg)
+}
+
+func (s *Server) CreateCollection(ctx context.Context, req *auditpb.CreateCollectionRequest) (*auditpb.Collection, error) {
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+
+	cfg := immudb.Config{
+		Parser:        req.Parser,
+		Type:          req.Type,
+		Indexes:       req.Indexes,
+		Layout:        req.Layout,
+		Scored:        req.Scored,
+		MissingFields: req.MissingFields,
+		Overwrite:     req.Overwrite,
+		Retention:     req.Retention,
+	}
+	if cfg.Type == "sql" && cfg.MissingFields == "" {
+		cfg.MissingFields = immudb.MissingFieldsError
+	}
+
+	if len(req.IndexPolicies) > 0 {
+		cfg.IndexPolicies = map[string]immudb.IndexPolicy{}
+		for _, p := range req.IndexPolicies {
+			cfg.IndexPolicies[p.Field] = immudb.IndexPolicy{Mode: p.Mode, Default: p.Default}
+		}
+	}
+
+	err := immudb.CreateCollection(s.client, req.Name, cfg, req.PrimaryKey, req.Force)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return s.GetCollection(ctx, &auditpb.GetCollectionRequest{Name: req.Name})
+}
+
+// Ingest writes entries one by one, so entries received before a failure
+// are stored. Writes rejected by overwrite policy are skipped. Writes of
+// concurrent streams are serialized.
+func (s *Server) Ingest(stream auditpb.AuditService_IngestServer) error {
+	response := &auditpb.IngestResponse{}
+	var collection string
+	var jsonRepository service.JsonRepository
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+
+		if jsonRepository == nil {
+			collection = req.Collection
+			cfg, err := s.config(collection)
+			if err != nil {
+				return err
+			}
+
+			jsonRepository, err = s.jsonRepository(collection, cfg)
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+		} else if req.Collection != "" && req.Collection != collection {
+			return status.Errorf(codes.InvalidArgument, "stream is bound to collection %s", collection)
+		}
+
+		if !json.Valid(req.Entry) {
+			return status.Errorf(codes.InvalidArgument, "entry %d is not valid json", len(response.TxIds)+1)
+		}
+
+		s.writeMu.Lock()
+		txID, err := jsonRepository.WriteBytes(req.Entry)
+		s.writeMu.Unlock()
+		if errors.Is(err, immudb.ErrOverwriteRejected) {
+			response.Skipped++
+		} else if err != nil {
+			return status.Errorf(codes.Internal, "could not write entry %d, %s", len(response.TxIds)+1, err)
+		}
+
+		response.TxIds = append(response.TxIds, txID)
+	}
+}
+
+// Read streams entries of key-value collection by field and value prefix, or
+// by ingestion time, and of SQL collection with filters.
+func (s *Server) Read(req *auditpb.ReadRequest, stream auditpb.AuditService_ReadServer) error {
+	cfg, err := s.config(req.Collection)
+	if err != nil {
+		return err
+	}
+
+	opts := immudb.ReadOptions{Limit: req.Limit, Cursor: req.Cursor, Desc: req.Desc, AsOfTx: req.AsOfTx}
+	send := func(object []byte) error {
+		return stream.Send(&auditpb.ReadResponse{Entry: object})
+	}
+
+	var cursor string
+	switch cfg.Type {
+	case "kv":
+		jr, err := immudb.NewJsonKVRepository(s.client, req.Collection)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		since, err := timeParam("since", req.Since)
+		if err != nil {
+			return err
+		}
+
+		until, err := timeParam("until", req.Until)
+		if err != nil {
+			return err
+		}
+
+		if !since.IsZero() || !until.IsZero() {
+			if req.Field != "" {
+				return status.Error(codes.InvalidArgument, "ingestion time range cannot be combined with field")
+			}
+
+			cursor, err = jr.ReadIngested(since, until, opts, send)
+		} else {
+			cursor, err = jr.Read(req.Field, req.Value, opts, send)
+		}
+		if err != nil {
+			return readStatus(err)
+		}
+	case "sql":
+		jr, err := immudb.NewJsonSQLRepository(s.client, req.Collection)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		filters := []immudb.Filter{}
+		for _, f := range req.Filters {
+			filter, err := immudb.ParseFilter(f)
+			if err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+
+			filters = append(filters, filter)
+		}
+
+		cursor, err = jr.Read(immudb.SQLQuery{Filters: filters}, opts, send)
+		if err != nil {
+			return readStatus(err)
+		}
+	default:
+		return status.Errorf(codes.Internal, "unknown collection type %s", cfg.Type)
+	}
+
+	if cursor != "" {
+		return stream.Send(&auditpb.ReadResponse{Cursor: cursor})
+	}
+
+	return nil
+}
+
+// History streams revisions of key-value entry, optionally verified, or of
+// SQL row.
+func (s *Server) History(req *auditpb.HistoryRequest, stream auditpb.AuditService_HistoryServer) error {
+	cfg, err := s.config(req.Collection)
+	if err != nil {
+		return err
+	}
+
+	sent := 0
+	switch cfg.Type {
+	case "kv":
+		jr, err := immudb.NewJsonKVRepository(s.client, req.Collection)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		err = jr.KeyHistory(req.Key, req.SinceTx, req.UntilTx, func(h immudb.History) error {
+			revision := &auditpb.Revision{Key: h.Key, TxId: h.TxID, Revision: h.Revision, Deleted: h.Deleted}
+			if !h.Deleted {
+				revision.Entry = h.Entry
+			}
+
+			if req.Verify {
+				verifyErr := jr.VerifyHistory(h)
+				revision.Verified = verifyErr == nil
+				if verifyErr != nil {
+					revision.VerificationError = verifyErr.Error()
+				}
+			}
+
+			sent++
+			return stream.Send(revision)
+		})
+		if err != nil && immudb.IsNotFound(err) {
+			return status.Errorf(codes.NotFound, "entry %s does not exist", req.Key)
+		}
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	case "sql":
+		if req.Verify {
+			return status.Error(codes.InvalidArgument, "history of SQL collection cannot be verified, use verify of current row")
+		}
+
+		jr, err := immudb.NewJsonSQLRepository(s.client, req.Collection)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		filters, err := jr.PrimaryKeyFilters(req.Key)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		_, err = jr.History(immudb.SQLQuery{Filters: filters, SinceTx: req.SinceTx, UntilTx: req.UntilTx}, immudb.ReadOptions{}, func(object []byte) error {
+			sent++
+			return stream.Send(&auditpb.Revision{Key: req.Key, Entry: object})
+		})
+		if err != nil {
+			return readStatus(err)
+		}
+	default:
+		return status.Errorf(codes.Internal, "unknown collection type %s", cfg.Type)
+	}
+
+	if sent == 0 && req.SinceTx == 0 && req.UntilTx == 0 {
+		return status.Errorf(codes.NotFound, "entry %s does not exist", req.Key)
+	}
+
+	return nil
+}
+
+// readStatus returns InvalidArgument for errors caused by query, e.g.
+// invalid filter or cursor, and Internal for others.
+func readStatus(err error) error {
+	if errors.Is(err, immudb.ErrInvalidQuery) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) config(collection string) (*immudb.Config, error) {
+	if collection == "" {
+		return nil, status.Error(codes.InvalidArgument, "collection is required")
+	}
+
+	cfg, err := immudb.NewConfigs(s.client).Read(collection)
+	if err != nil {
+		if immudb.IsNotFound(err) {
+			return nil, status.Errorf(codes.NotFound, "collection %s does not exist", collection)
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	if cfg.Dropped {
+		return nil, status.Errorf(codes.NotFound, "collection %s was dropped", collection)
+	}
+
+	return cfg, nil
+}
+
+func (s *Server) jsonRepository(collection string, cfg *immudb.Config) (service.JsonRepository, error) {
+	switch cfg.Type {
+	case "kv":
+		return immudb.NewJsonKVRepository(s.client, collection)
+	case "sql":
+		return immudb.NewJsonSQLRepository(s.client, collection)
+	default:
+		return nil, fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+}
+
+func collectionOf(name string, cfg *immudb.Config) (*auditpb.Collection, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &auditpb.Collection{Name: name, Type: cfg.Type, Config: b}, nil
+}
+
+func timeParam(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := immudb.ParseTime(value)
+	if err != nil {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, "invalid %s, %s", name, err)
+	}
+
+	return t, nil
+}
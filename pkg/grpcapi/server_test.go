@@ -0,0 +1,278 @@
+package grpcapi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/tomekkolo/immudb-play/pkg/grpcapi/auditpb"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestClient serves API over immudb started for test, with key-value
+// collection kv and SQL collection sql.
+func newTestClient(t *testing.T) auditpb.AuditServiceClient {
+	t.Helper()
+
+	cli := immudbtest.NewT(t).Client(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gs := grpc.NewServer()
+	NewServer(cli).Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := auditpb.NewAuditServiceClient(conn)
+	_, err = client.CreateCollection(context.Background(), &auditpb.CreateCollectionRequest{Name: "kv", Type: "kv", Indexes: []string{"id", "user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.CreateCollection(context.Background(), &auditpb.CreateCollectionRequest{Name: "sql", Type: "sql", Indexes: []string{"id=INTEGER", "user=VARCHAR[64]"}, PrimaryKey: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func ingest(client auditpb.AuditServiceClient, collection string, from int, to int) (*auditpb.IngestResponse, error) {
+	stream, err := client.Ingest(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	for i := from; i <= to; i++ {
+		err = stream.Send(&auditpb.IngestRequest{Collection: collection, Entry: []byte(fmt.Sprintf(`{"id":%d,"user":"user%d"}`, i, i))})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// read returns number of entries read, or error of the stream.
+func read(client auditpb.AuditServiceClient, req *auditpb.ReadRequest) (int, error) {
+	stream, err := client.Read(context.Background(), req)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		r, err := stream.Recv()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		if r.Entry != nil {
+			n++
+		}
+	}
+}
+
+func history(client auditpb.AuditServiceClient, req *auditpb.HistoryRequest) (int, error) {
+	stream, err := client.History(context.Background(), req)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		n++
+	}
+}
+
+func TestServerCodes(t *testing.T) {
+	client := newTestClient(t)
+	for _, collection := range []string{"kv", "sql"} {
+		response, err := ingest(client, collection, 1, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(response.TxIds) != 3 {
+			t.Fatalf("expected 3 entries ingested into %s, got %v", collection, response.TxIds)
+		}
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		code codes.Code
+	}{
+		{name: "kv read", code: codes.OK, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "kv", Field: "user", Value: "user"})
+			return err
+		}},
+		{name: "sql read", code: codes.OK, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "sql", Filters: []string{"id>=2"}})
+			return err
+		}},
+		{name: "kv verified history", code: codes.OK, call: func() error {
+			_, err := history(client, &auditpb.HistoryRequest{Collection: "kv", Key: "1", Verify: true})
+			return err
+		}},
+		{name: "missing collection", code: codes.NotFound, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "missing"})
+			return err
+		}},
+		{name: "kv history of missing key", code: codes.NotFound, call: func() error {
+			_, err := history(client, &auditpb.HistoryRequest{Collection: "kv", Key: "100"})
+			return err
+		}},
+		{name: "sql history of missing key", code: codes.NotFound, call: func() error {
+			_, err := history(client, &auditpb.HistoryRequest{Collection: "sql", Key: "100"})
+			return err
+		}},
+		{name: "kv read of not indexed field", code: codes.InvalidArgument, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "kv", Field: "unknown"})
+			return err
+		}},
+		{name: "sql read of unknown column", code: codes.InvalidArgument, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "sql", Filters: []string{"unknown=1"}})
+			return err
+		}},
+		{name: "sql read with invalid cursor", code: codes.InvalidArgument, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "sql", Cursor: "!"})
+			return err
+		}},
+		{name: "kv read with relative time", code: codes.InvalidArgument, call: func() error {
+			_, err := read(client, &auditpb.ReadRequest{Collection: "kv", Since: "24h"})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if status.Code(err) != tt.code {
+				t.Errorf("expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+// TestServerConcurrentCalls checks calls sharing immudb session do not fail
+// each other.
+func TestServerConcurrentCalls(t *testing.T) {
+	client := newTestClient(t)
+	_, err := ingest(client, "sql", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wg := sync.WaitGroup{}
+	failed := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			_, err := ingest(client, "sql", 100+10*i, 109+10*i)
+			if err != nil {
+				failed <- fmt.Errorf("ingest, %w", err)
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			_, err := read(client, &auditpb.ReadRequest{Collection: "sql"})
+			if err != nil {
+				failed <- fmt.Errorf("read, %w", err)
+			}
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+			_, err := history(client, &auditpb.HistoryRequest{Collection: "sql", Key: fmt.Sprint(i + 1)})
+			if err != nil {
+				failed <- fmt.Errorf("history, %w", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(failed)
+	for err := range failed {
+		t.Error(err)
+	}
+
+	n, err := read(client, &auditpb.ReadRequest{Collection: "sql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 110 {
+		t.Errorf("expected 110 rows, got %d", n)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gs := grpc.NewServer(TokenAuth("secret")...)
+	NewServer(cli).Register(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	client := auditpb.NewAuditServiceClient(conn)
+	for token, code := range map[string]codes.Code{"": codes.Unauthenticated, "other": codes.Unauthenticated, "secret": codes.OK} {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+
+		_, err := client.ListCollections(ctx, &auditpb.ListCollectionsRequest{})
+		if status.Code(err) != code {
+			t.Errorf("expected %s for token %q, got %v", code, token, err)
+		}
+
+		// streams are authorized too
+		stream, err := client.Ingest(ctx)
+		if err == nil {
+			_, err = stream.CloseAndRecv()
+		}
+		if code != codes.OK && status.Code(err) != code {
+			t.Errorf("expected %s of stream for token %q, got %v", code, token, err)
+		}
+	}
+}
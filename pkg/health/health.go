@@ -0,0 +1,239 @@
+// Package health tracks state of ingestion pipeline and immudb session, and
+// serves it as liveness and readiness probes:
+//
+//	GET /healthz fails when source failed
+//	GET /readyz fails also when immudb session is unhealthy, or write is stuck
+//
+// Readiness can also fail when open source has no successful write for too
+// long, see WithIdleAfter.
+//
+// Both respond with Status as json, with 503 when failing.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultStuckAfter is how long write can take before it is considered stuck.
+const DefaultStuckAfter = time.Minute
+
+// immudbTimeout bounds immudb check, so readiness responds within default
+// probe timeout of Kubernetes.
+const immudbTimeout = 900 * time.Millisecond
+
+type SourceState string
+
+const (
+	SourceOpen  SourceState = "open"
+	SourceEOF   SourceState = "eof"
+	SourceError SourceState = "error"
+)
+
+// Checker records state of pipeline. Nil Checker records nothing. It is safe
+// for concurrent use.
+type Checker struct {
+	immudbCheck func(ctx context.Context) error
+	stuckAfter  time.Duration
+	idleAfter   time.Duration // 0 when idle source does not fail readiness
+
+	mu           sync.Mutex
+	source       SourceState // empty when there is no source, e.g. in serve
+	sourceErr    error
+	sourceOpened time.Time
+	lastWrite    time.Time
+	writeStarted time.Time // zero when no write is in progress
+}
+
+// NewChecker creates checker of immudb session with immudbCheck, which
+// considers writes taking longer than stuckAfter stuck.
+func NewChecker(immudbCheck func(ctx context.Context) error, stuckAfter time.Duration) *Checker {
+	return &Checker{immudbCheck: immudbCheck, stuckAfter: stuckAfter}
+}
+
+// WithIdleAfter makes readiness fail when source is open, and there was no
+// successful write for longer than idleAfter since the last one, or since
+// source was opened. Quiet sources, or ones with all lines skipped, are idle
+// too, so it is meant for sources which are expected to produce entries
+// continuously. 0 disables the check.
+func (c *Checker) WithIdleAfter(idleAfter time.Duration) *Checker {
+	c.idleAfter = idleAfter
+	return c
+}
+
+func (c *Checker) SourceOpened() {
+	c.setSource(SourceOpen, nil)
+}
+
+// SourceEOF records source was read till the end, without following it.
+func (c *Checker) SourceEOF() {
+	c.setSource(SourceEOF, nil)
+}
+
+func (c *Checker) SourceFailed(err error) {
+	c.setSource(SourceError, err)
+}
+
+func (c *Checker) setSource(state SourceState, err error) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.source = state
+	c.sourceErr = err
+	if state == SourceOpen {
+		c.sourceOpened = time.Now()
+	}
+}
+
+func (c *Checker) WriteStarted() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeStarted = time.Now()
+}
+
+// WriteDone records end of write, which was successful if err is nil.
+func (c *Checker) WriteDone(err error) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeStarted = time.Time{}
+	if err == nil {
+		c.lastWrite = time.Now()
+	}
+}
+
+// Status is state reported by probes. Fields of writes are set once there
+// was one, readiness and immudb only by readiness probe.
+type Status struct {
+	Live                   bool        `json:"live"`
+	Ready                  *bool       `json:"ready,omitempty"`
+	Immudb                 string      `json:"immudb,omitempty"` // ok, or error of session check
+	Source                 SourceState `json:"source,omitempty"`
+	SourceError            string      `json:"source_error,omitempty"`
+	LastWriteAt            *time.Time  `json:"last_write_at,omitempty"`
+	LastWriteAgeSeconds    *float64    `json:"last_write_age_seconds,omitempty"`
+	WriteInProgressSeconds *float64    `json:"write_in_progress_seconds,omitempty"`
+	Errors                 []string    `json:"errors,omitempty"` // reasons of failing probes
+}
+
+// Status checks immudb session, and returns it together with recorded state
+// of pipeline.
+func (c *Checker) Status(ctx context.Context) Status {
+	ctx, cancel := context.WithTimeout(ctx, immudbTimeout)
+	defer cancel()
+
+	s, ready := c.state()
+	s.Immudb = "ok"
+	err := c.immudbCheck(ctx)
+	if err != nil {
+		ready = false
+		s.Immudb = err.Error()
+		s.Errors = append(s.Errors, fmt.Sprintf("immudb session is unhealthy, %s", err))
+	}
+
+	s.Ready = &ready
+	return s
+}
+
+// state returns recorded state of pipeline, and if it is ready, without
+// checking immudb.
+func (c *Checker) state() (Status, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Status{Live: true, Source: c.source}
+	ready := true
+	if c.sourceErr != nil {
+		s.Live = false
+		ready = false
+		s.SourceError = c.sourceErr.Error()
+		s.Errors = append(s.Errors, fmt.Sprintf("source failed, %s", c.sourceErr))
+	}
+
+	if !c.lastWrite.IsZero() {
+		lastWrite := c.lastWrite
+		age := time.Since(lastWrite).Seconds()
+		s.LastWriteAt = &lastWrite
+		s.LastWriteAgeSeconds = &age
+	}
+
+	if c.idleAfter > 0 && c.source == SourceOpen {
+		since := c.sourceOpened
+		if c.lastWrite.After(since) {
+			since = c.lastWrite
+		}
+
+		idle := time.Since(since)
+		if idle > c.idleAfter {
+			ready = false
+			s.Errors = append(s.Errors, fmt.Sprintf("no write for %s", idle.Round(time.Second)))
+		}
+	}
+
+	if !c.writeStarted.IsZero() {
+		inProgress := time.Since(c.writeStarted)
+		seconds := inProgress.Seconds()
+		s.WriteInProgressSeconds = &seconds
+		if inProgress > c.stuckAfter {
+			ready = false
+			s.Errors = append(s.Errors, fmt.Sprintf("write is stuck for %s", inProgress.Round(time.Second)))
+		}
+	}
+
+	return s, ready
+}
+
+// Liveness serves /healthz. It does not check immudb, so its outage does not
+// restart pipelines.
+func (c *Checker) Liveness() http.Handler {
+	return probe(func(r *http.Request) (Status, bool) {
+		s, _ := c.state()
+		return s, s.Live
+	})
+}
+
+// Readiness serves /readyz.
+func (c *Checker) Readiness() http.Handler {
+	return probe(func(r *http.Request) (Status, bool) {
+		s := c.Status(r.Context())
+		return s, *s.Ready
+	})
+}
+
+func probe(check func(r *http.Request) (Status, bool)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s, ok := check(r)
+		b, _ := json.Marshal(s)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write(b)
+	})
+}
+
+// Register registers /healthz and /readyz on mux.
+func (c *Checker) Register(mux interface {
+	Handle(pattern string, handler http.Handler)
+}) {
+	mux.Handle("/healthz", c.Liveness())
+	mux.Handle("/readyz", c.Readiness())
+}
@@ -0,0 +1,100 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const stuckAfter = 50 * time.Millisecond
+
+func probeCodes(t *testing.T, c *Checker) (int, int) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	c.Register(mux)
+
+	codes := []int{}
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		codes = append(codes, rec.Code)
+	}
+
+	return codes[0], codes[1]
+}
+
+func TestProbes(t *testing.T) {
+	healthy := func(ctx context.Context) error { return nil }
+
+	tests := []struct {
+		name      string
+		check     func(ctx context.Context) error
+		idleAfter time.Duration
+		pipeline  func(c *Checker)
+		live      int
+		ready     int
+	}{
+		{name: "no source", check: healthy, pipeline: func(c *Checker) { time.Sleep(2 * stuckAfter) }, live: http.StatusOK, ready: http.StatusOK},
+		{name: "open source", check: healthy, pipeline: func(c *Checker) { c.SourceOpened() }, live: http.StatusOK, ready: http.StatusOK},
+		{name: "recent write", check: healthy, idleAfter: stuckAfter, live: http.StatusOK, ready: http.StatusOK, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			time.Sleep(2 * stuckAfter)
+			c.WriteStarted()
+			c.WriteDone(nil)
+		}},
+		{name: "quiet source", check: healthy, live: http.StatusOK, ready: http.StatusOK, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			c.WriteStarted()
+			c.WriteDone(nil)
+			time.Sleep(2 * stuckAfter)
+		}},
+		{name: "no write since source opened", check: healthy, idleAfter: stuckAfter, live: http.StatusOK, ready: http.StatusServiceUnavailable, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			time.Sleep(2 * stuckAfter)
+		}},
+		{name: "no write since last one", check: healthy, idleAfter: stuckAfter, live: http.StatusOK, ready: http.StatusServiceUnavailable, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			c.WriteStarted()
+			c.WriteDone(nil)
+			time.Sleep(2 * stuckAfter)
+		}},
+		{name: "failed write", check: healthy, idleAfter: stuckAfter, live: http.StatusOK, ready: http.StatusServiceUnavailable, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			time.Sleep(2 * stuckAfter)
+			c.WriteStarted()
+			c.WriteDone(errors.New("failed"))
+		}},
+		{name: "source at EOF", check: healthy, idleAfter: stuckAfter, live: http.StatusOK, ready: http.StatusOK, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			c.SourceEOF()
+			time.Sleep(2 * stuckAfter)
+		}},
+		{name: "stuck write", check: healthy, live: http.StatusOK, ready: http.StatusServiceUnavailable, pipeline: func(c *Checker) {
+			c.WriteStarted()
+			time.Sleep(2 * stuckAfter)
+		}},
+		{name: "failed source", check: healthy, live: http.StatusServiceUnavailable, ready: http.StatusServiceUnavailable, pipeline: func(c *Checker) {
+			c.SourceOpened()
+			c.SourceFailed(errors.New("failed"))
+		}},
+		{name: "unhealthy immudb", check: func(ctx context.Context) error { return errors.New("no session found") }, live: http.StatusOK, ready: http.StatusServiceUnavailable, pipeline: func(c *Checker) {
+			c.SourceOpened()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(tt.check, stuckAfter).WithIdleAfter(tt.idleAfter)
+			tt.pipeline(c)
+
+			live, ready := probeCodes(t, c)
+			if live != tt.live || ready != tt.ready {
+				t.Errorf("expected liveness %d and readiness %d, got %d and %d", tt.live, tt.ready, live, ready)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+// Package immudbtest runs in-process immudb server on temporary directory,
+// so collections can be integration tested without external immudb:
+//
+//	func TestCollection(t *testing.T) {
+//		cli := immudbtest.NewT(t).Client(t)
+//		err := immudb.SetupJsonKVRepository(cli, "test", []string{"id"})
+//		...
+//	}
+//
+// Commands connect to it with --immudb-host, --immudb-port and
+// --immudb-state-dir set to Host, Port and StateDir of the server.
+package immudbtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/logger"
+	"github.com/codenotary/immudb/pkg/server"
+)
+
+// Default credentials and database of started server.
+const (
+	Username = "immudb"
+	Password = "immudb"
+	Database = "defaultdb"
+)
+
+type Server struct {
+	Host string
+	Port int
+
+	// StateDir stores immudb client state of Connect and commands run with
+	// Args, temporary directory of system if empty.
+	StateDir string
+
+	srv *server.ImmuServer
+}
+
+// Start starts server storing data in dir, listening on random port of
+// localhost.
+func Start(dir string) (*Server, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("could not listen, %w", err)
+	}
+
+	// json log format keeps server from printing its banner to stdout
+	opts := server.DefaultOptions().
+		WithDir(dir).
+		WithListener(lis).
+		WithMetricsServer(false).
+		WithWebServer(false).
+		WithPgsqlServer(false).
+		WithLogFormat(logger.LogFormatJSON)
+
+	srv := server.DefaultServer().WithOptions(opts).WithLogger(logger.NewSimpleLogger("immudb ", io.Discard)).(*server.ImmuServer)
+	err = srv.Initialize()
+	if err != nil {
+		lis.Close()
+		return nil, fmt.Errorf("could not initialize immudb, %w", err)
+	}
+
+	// server is not started with Start, as it blocks and handles signals
+	go srv.GrpcServer.Serve(lis)
+	err = srv.SessManager.StartSessionsGuard()
+	if err != nil {
+		srv.GrpcServer.Stop()
+		srv.CloseDatabases()
+		return nil, fmt.Errorf("could not start sessions guard, %w", err)
+	}
+
+	addr := lis.Addr().(*net.TCPAddr)
+	return &Server{Host: addr.IP.String(), Port: addr.Port, srv: srv}, nil
+}
+
+// NewT starts server in temporary directory of test, with client state in
+// another one, and stops it when test finishes.
+func NewT(tb testing.TB) *Server {
+	tb.Helper()
+
+	s, err := Start(tb.TempDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s.StateDir = tb.TempDir()
+	tb.Cleanup(s.Stop)
+	return s
+}
+
+// Connect opens session to default database of server.
+func (s *Server) Connect(ctx context.Context) (client.ImmuClient, error) {
+	opts := client.DefaultOptions().WithAddress(s.Host).WithPort(s.Port).WithDir(s.stateDir())
+	cli := client.NewClient().WithOptions(opts)
+	err := cli.OpenSession(ctx, []byte(Username), []byte(Password), Database)
+	if err != nil {
+		return nil, fmt.Errorf("could not open session, %w", err)
+	}
+
+	return cli, nil
+}
+
+// Client opens session to default database of server, and closes it when
+// test finishes.
+func (s *Server) Client(tb testing.TB) client.ImmuClient {
+	tb.Helper()
+
+	cli, err := s.Connect(context.Background())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	tb.Cleanup(func() {
+		cli.CloseSession(context.Background())
+	})
+	return cli
+}
+
+// Args returns immudb connection flags of commands, to run them against
+// server.
+func (s *Server) Args() []string {
+	return []string{"--immudb-host", s.Host, "--immudb-port", fmt.Sprint(s.Port), "--immudb-state-dir", s.stateDir()}
+}
+
+func (s *Server) stateDir() string {
+	if s.StateDir == "" {
+		return os.TempDir()
+	}
+
+	return s.StateDir
+}
+
+// Stop stops server and closes its databases.
+func (s *Server) Stop() {
+	s.srv.SessManager.StopSessionsGuard()
+	s.srv.GrpcServer.Stop()
+	s.srv.CloseDatabases()
+}
@@ -0,0 +1,165 @@
+// Package metrics defines Prometheus metrics of ingestion pipelines and
+// repositories, registered with the default registry.
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "immudb_audit"
+
+// Reasons of skipped lines.
+const (
+	SkipInvalidLine       = "invalid_line"       // rejected by line parser
+	SkipOverwriteRejected = "overwrite_rejected" // rejected by overwrite policy
+)
+
+var (
+	linesRead = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lines_read_total",
+		Help:      "Lines read from source.",
+	}, []string{"collection"})
+
+	linesParsed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lines_parsed_total",
+		Help:      "Lines successfully parsed into json entries.",
+	}, []string{"collection"})
+
+	linesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "lines_skipped_total",
+		Help:      "Lines not stored, by reason.",
+	}, []string{"collection", "reason"})
+
+	entriesStored = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entries_stored_total",
+		Help:      "Entries stored in collection.",
+	}, []string{"collection"})
+
+	lastTxID = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_stored_tx_id",
+		Help:      "Transaction of the last entry stored in collection.",
+	}, []string{"collection"})
+
+	lastStored = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_stored_timestamp_seconds",
+		Help:      "Unix time of the last entry stored in collection.",
+	}, []string{"collection"})
+
+	sourceLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "source_lag_bytes",
+		Help:      "Bytes of source not read yet, for sources which know it.",
+	}, []string{"collection"})
+
+	writeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "write_duration_seconds",
+		Help:      "Latency of writes to immudb, including retries of overwrite policy.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"collection", "type"})
+
+	batchSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "batch_size",
+		Help:      "Number of entries written in single batch.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"collection", "type"})
+
+	reconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "immudb_reconnects_total",
+		Help:      "Sessions reopened after immudb connection was lost.",
+	})
+)
+
+// Pipeline records metrics of ingestion pipeline into collection. Nil
+// Pipeline records nothing.
+type Pipeline struct {
+	linesRead     prometheus.Counter
+	linesParsed   prometheus.Counter
+	invalidLines  prometheus.Counter
+	rejected      prometheus.Counter
+	entriesStored prometheus.Counter
+	lastTxID      prometheus.Gauge
+	lastStored    prometheus.Gauge
+	sourceLag     prometheus.Gauge
+}
+
+func NewPipeline(collection string) *Pipeline {
+	return &Pipeline{
+		linesRead:     linesRead.WithLabelValues(collection),
+		linesParsed:   linesParsed.WithLabelValues(collection),
+		invalidLines:  linesSkipped.WithLabelValues(collection, SkipInvalidLine),
+		rejected:      linesSkipped.WithLabelValues(collection, SkipOverwriteRejected),
+		entriesStored: entriesStored.WithLabelValues(collection),
+		lastTxID:      lastTxID.WithLabelValues(collection),
+		lastStored:    lastStored.WithLabelValues(collection),
+		sourceLag:     sourceLag.WithLabelValues(collection),
+	}
+}
+
+func (p *Pipeline) LineRead() {
+	if p != nil {
+		p.linesRead.Inc()
+	}
+}
+
+func (p *Pipeline) LineParsed() {
+	if p != nil {
+		p.linesParsed.Inc()
+	}
+}
+
+// LineSkipped counts line not stored for reason, SkipInvalidLine or
+// SkipOverwriteRejected.
+func (p *Pipeline) LineSkipped(reason string) {
+	if p == nil {
+		return
+	}
+
+	if reason == SkipOverwriteRejected {
+		p.rejected.Inc()
+	} else {
+		p.invalidLines.Inc()
+	}
+}
+
+func (p *Pipeline) EntryStored(txID uint64) {
+	if p != nil {
+		p.entriesStored.Inc()
+		p.lastTxID.Set(float64(txID))
+		p.lastStored.SetToCurrentTime()
+	}
+}
+
+func (p *Pipeline) SourceLag(bytes int64) {
+	if p != nil {
+		p.sourceLag.Set(float64(bytes))
+	}
+}
+
+// ObserveWrite records latency of write started at start into collection of
+// type kv or sql.
+func ObserveWrite(collection string, collectionType string, start time.Time) {
+	writeDuration.WithLabelValues(collection, collectionType).Observe(time.Since(start).Seconds())
+}
+
+// ObserveBatch records size of batch written into collection of type kv or
+// sql.
+func ObserveBatch(collection string, collectionType string, size int) {
+	batchSize.WithLabelValues(collection, collectionType).Observe(float64(size))
+}
+
+// Reconnected counts reopened immudb session.
+func Reconnected() {
+	reconnects.Inc()
+}
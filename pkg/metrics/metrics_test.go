@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPipeline(t *testing.T) {
+	p := NewPipeline("pipeline")
+	p.LineRead()
+	p.LineRead()
+	p.LineRead()
+	p.LineParsed()
+	p.LineParsed()
+	p.LineSkipped(SkipInvalidLine)
+	p.LineSkipped(SkipOverwriteRejected)
+	p.EntryStored(41)
+	p.EntryStored(42)
+	p.SourceLag(100)
+
+	tests := []struct {
+		name     string
+		value    float64
+		expected float64
+	}{
+		{"lines read", testutil.ToFloat64(linesRead.WithLabelValues("pipeline")), 3},
+		{"lines parsed", testutil.ToFloat64(linesParsed.WithLabelValues("pipeline")), 2},
+		{"invalid lines", testutil.ToFloat64(linesSkipped.WithLabelValues("pipeline", SkipInvalidLine)), 1},
+		{"rejected lines", testutil.ToFloat64(linesSkipped.WithLabelValues("pipeline", SkipOverwriteRejected)), 1},
+		{"entries stored", testutil.ToFloat64(entriesStored.WithLabelValues("pipeline")), 2},
+		{"last transaction", testutil.ToFloat64(lastTxID.WithLabelValues("pipeline")), 42},
+		{"source lag", testutil.ToFloat64(sourceLag.WithLabelValues("pipeline")), 100},
+	}
+
+	for _, tt := range tests {
+		if tt.value != tt.expected {
+			t.Errorf("expected %s %v, got %v", tt.name, tt.expected, tt.value)
+		}
+	}
+
+	stored := testutil.ToFloat64(lastStored.WithLabelValues("pipeline"))
+	if time.Since(time.Unix(int64(stored), 0)) > time.Minute {
+		t.Errorf("expected last stored time to be now, got %v", stored)
+	}
+
+	// metrics of other collections are separate
+	if n := testutil.ToFloat64(linesRead.WithLabelValues("other")); n != 0 {
+		t.Errorf("expected no lines read of other collection, got %v", n)
+	}
+}
+
+func TestNilPipeline(t *testing.T) {
+	var p *Pipeline
+	p.LineRead()
+	p.LineParsed()
+	p.LineSkipped(SkipInvalidLine)
+	p.EntryStored(1)
+	p.SourceLag(1)
+}
+
+func TestRepositoryMetrics(t *testing.T) {
+	ObserveWrite("repository", "kv", time.Now().Add(-time.Second))
+	ObserveBatch("repository", "sql", 10)
+	ObserveBatch("repository", "sql", 20)
+
+	if n := testutil.CollectAndCount(writeDuration); n != 1 {
+		t.Errorf("expected 1 write duration series, got %d", n)
+	}
+
+	if n := testutil.CollectAndCount(batchSize); n != 1 {
+		t.Errorf("expected 1 batch size series, got %d", n)
+	}
+
+	before := testutil.ToFloat64(reconnects)
+	Reconnected()
+	if n := testutil.ToFloat64(reconnects); n != before+1 {
+		t.Errorf("expected reconnects to grow by 1, got %v after %v", n, before)
+	}
+}
@@ -0,0 +1,136 @@
+package immudb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// Anomaly describes entry of collection written more than once. For
+// append-only sources, it means either duplicated ingest or collision of
+// primary keys.
+type Anomaly struct {
+	Key       string // primary key value
+	Revisions uint64 // number of revisions written since collection was created, deletions excluded
+	TxID      uint64 // transaction of the latest revision
+}
+
+// Anomalies streams all entries of key-value collection with more than one
+// revision written since the collection was created. Deletions, and
+// revisions written before collection was dropped and created again, are not
+// counted.
+func (jr *JsonKVRepository) Anomalies(fn func(Anomaly) error) error {
+	createdTx, err := NewConfigs(jr.client).CreatedTx(jr.collection)
+	if err != nil {
+		return fmt.Errorf("could not read collection definition history, %w", err)
+	}
+
+	return jr.scanPayloads(nil, func(pk string, e *schema.Entry) error {
+		// revision counts also deletions and earlier collections
+		if e.Revision <= 1 {
+			return nil
+		}
+
+		revisions := uint64(0)
+		err := jr.KeyHistory(pk, createdTx, 0, func(h History) error {
+			if !h.Deleted {
+				revisions++
+			}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not get history of %s, %w", pk, err)
+		}
+
+		if revisions <= 1 {
+			return nil
+		}
+
+		return fn(Anomaly{Key: pk, Revisions: revisions, TxID: e.Tx})
+	})
+}
+
+// Anomalies streams all rows of SQL collection with more than one revision
+// written since the collection was created, in primary key order. Rows do
+// not expose their revisions, so they are counted from transactions written
+// since, with deletions excluded.
+func (jr *JsonSQLRepository) Anomalies(fn func(Anomaly) error) error {
+	createdTx, err := NewConfigs(jr.client).CreatedTx(jr.collection)
+	if err != nil {
+		return fmt.Errorf("could not read collection definition history, %w", err)
+	}
+
+	// raw keys of current rows, to match them in transactions
+	keys := []string{}
+	rows := map[string]*Anomaly{}
+	_, err = jr.selectPaged(jr.collection, "", map[string]interface{}{}, ReadOptions{}, func(object []byte) error {
+		key, primaryKey := jr.primaryKeyOf(object)
+		entry, err := jr.sqlEntry(primaryKey)
+		if err != nil {
+			return fmt.Errorf("could not get row %s, %w", key, err)
+		}
+
+		keys = append(keys, string(entry.Key))
+		rows[string(entry.Key)] = &Anomaly{Key: key, TxID: entry.Tx}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not read rows, %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	state, err := jr.client.CurrentState(context.TODO())
+	if err != nil {
+		return fmt.Errorf("could not get current state, %w", err)
+	}
+
+	for initialTx := createdTx; initialTx <= state.TxId; {
+		limit := uint64(999)
+		if state.TxId-initialTx+1 < limit {
+			limit = state.TxId - initialTx + 1
+		}
+
+		txs, err := jr.client.TxScan(context.TODO(), &schema.TxScanRequest{
+			InitialTx: initialTx,
+			Limit:     uint32(limit),
+			EntriesSpec: &schema.EntriesSpec{
+				SqlEntriesSpec: &schema.EntryTypeSpec{Action: schema.EntryTypeAction_ONLY_DIGEST},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not scan transactions, %w", err)
+		}
+
+		for _, tx := range txs.Txs {
+			for _, e := range tx.Entries {
+				row, ok := rows[string(e.Key)]
+				if ok && !e.Metadata.GetDeleted() {
+					row.Revisions++
+				}
+			}
+		}
+
+		if uint64(len(txs.Txs)) < limit {
+			break
+		}
+		initialTx += limit
+	}
+
+	for _, key := range keys {
+		if rows[key].Revisions <= 1 {
+			continue
+		}
+
+		err = fn(*rows[key])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
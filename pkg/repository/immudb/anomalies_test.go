@@ -0,0 +1,121 @@
+package immudb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+type anomalyLister interface {
+	WriteBytes([]byte) (uint64, error)
+	Drop() error
+	Anomalies(fn func(Anomaly) error) error
+}
+
+func newAnomaliesCollection(t *testing.T, cli immudb.ImmuClient, typ string) anomalyLister {
+	t.Helper()
+
+	cfg := Config{Type: "kv", Indexes: []string{"id"}}
+	var pk []string
+	if typ == "sql" {
+		cfg = Config{Type: "sql", Indexes: []string{"id=VARCHAR[16]"}, MissingFields: MissingFieldsError}
+		pk = []string{"id"}
+	}
+
+	err := CreateCollection(cli, "anomalies", cfg, pk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var repo anomalyLister
+	if typ == "sql" {
+		repo, err = NewJsonSQLRepository(cli, "anomalies")
+	} else {
+		repo, err = NewJsonKVRepository(cli, "anomalies")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return repo
+}
+
+// deleteEntry deletes entry with id, as retention does.
+func deleteEntry(t *testing.T, cli immudb.ImmuClient, repo anomalyLister, id string) {
+	t.Helper()
+
+	object := []byte(fmt.Sprintf(`{"id":"%s"}`, id))
+	if sql, ok := repo.(*JsonSQLRepository); ok {
+		_, err := sql.client.SQLExec(context.Background(), "DELETE FROM anomalies WHERE id = @id;", map[string]interface{}{"id": id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	ops, err := repo.(*JsonKVRepository).deleteOps(id, object)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cli.ExecAll(context.Background(), &schema.ExecAllRequest{Operations: ops})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnomalies(t *testing.T) {
+	for _, typ := range []string{"kv", "sql"} {
+		t.Run(typ, func(t *testing.T) {
+			cli := immudbtest.NewT(t).Client(t)
+			repo := newAnomaliesCollection(t, cli, typ)
+			write := func(ids ...string) map[string]uint64 {
+				txs := map[string]uint64{}
+				for _, id := range ids {
+					tx, err := repo.WriteBytes([]byte(fmt.Sprintf(`{"id":"%s"}`, id)))
+					if err != nil {
+						t.Fatal(err)
+					}
+					txs[id] = tx
+				}
+				return txs
+			}
+
+			// revisions written before drop are not counted
+			write("1", "1", "2")
+			err := repo.Drop()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			repo = newAnomaliesCollection(t, cli, typ)
+			// deletion of 3 is not counted, and deleted 4 is not listed
+			write("1", "2", "3")
+			deleteEntry(t, cli, repo, "3")
+			txs := write("2", "3", "4", "4")
+			deleteEntry(t, cli, repo, "4")
+
+			anomalies := []Anomaly{}
+			err = repo.Anomalies(func(a Anomaly) error {
+				anomalies = append(anomalies, a)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []Anomaly{
+				{Key: "2", Revisions: 2, TxID: txs["2"]},
+				{Key: "3", Revisions: 2, TxID: txs["3"]},
+			}
+			if !reflect.DeepEqual(anomalies, expected) {
+				t.Fatalf("expected anomalies %+v, got %+v", expected, anomalies)
+			}
+		})
+	}
+}
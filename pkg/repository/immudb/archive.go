@@ -0,0 +1,686 @@
+package immudb
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/codenotary/immudb/embedded/sql"
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+	"github.com/codenotary/immudb/pkg/database"
+)
+
+// Archive is a gzipped tar with manifest.json, followed by entries.ndjson
+// with one ArchiveEntry per line. Every entry carries immudb proof of its
+// inclusion in a transaction, and of consistency of that transaction with
+// the state in manifest, so archive can be verified without immudb.
+const (
+	ArchiveFormat = 1
+
+	archiveManifest = "manifest.json"
+	archiveEntries  = "entries.ndjson"
+)
+
+// ArchiveState is immudb state all entries of archive are proven against.
+// Its hash should be compared with one obtained independently, e.g. from
+// immudb or a previous audit, as archive can only prove consistency with it.
+type ArchiveState struct {
+	Database string
+	TxID     uint64
+	TxHash   string // hex encoded
+}
+
+type ArchiveManifest struct {
+	Format     int
+	Collection string
+	Config     Config
+	PrimaryKey []string `json:",omitempty"` // SQL only, columns are in config
+	Source     string   // immudb instance archive was exported from
+	ExportedAt time.Time
+	History    bool // all revisions were exported, not just current ones
+	Entries    uint64
+	State      ArchiveState
+}
+
+// ArchiveEntry is exported entry with its proof, VerifiableEntry for
+// key-value collections or VerifiableSQLEntry for SQL ones, as protobuf json.
+type ArchiveEntry struct {
+	Key      string // primary key value, json array for composite SQL primary key
+	TxID     uint64
+	Revision uint64 `json:",omitempty"` // key-value only
+	Entry    json.RawMessage
+	Proof    json.RawMessage
+}
+
+// archiveWriter collects entries in temporary file, so manifest with their
+// count can be written first.
+type archiveWriter struct {
+	client   immudb.ImmuClient
+	manifest ArchiveManifest
+	file     *os.File
+	buf      *bufio.Writer
+	enc      *json.Encoder
+}
+
+func newArchiveWriter(cli immudb.ImmuClient, collection string, cfg *Config, history bool) (*archiveWriter, error) {
+	state, err := cli.CurrentState(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("could not get immudb state, %w", err)
+	}
+
+	f, err := os.CreateTemp("", "immudb-audit-export-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary file, %w", err)
+	}
+
+	buf := bufio.NewWriter(f)
+	return &archiveWriter{
+		client: cli,
+		manifest: ArchiveManifest{
+			Format:     ArchiveFormat,
+			Collection: collection,
+			Config:     *cfg,
+			Source:     cli.GetOptions().Bind(),
+			ExportedAt: time.Now().UTC(),
+			History:    history,
+			State: ArchiveState{
+				Database: state.Db,
+				TxID:     state.TxId,
+				TxHash:   hex.EncodeToString(state.TxHash),
+			},
+		},
+		file: f,
+		buf:  buf,
+		enc:  json.NewEncoder(buf),
+	}, nil
+}
+
+// fillProof adds linear advance proof, which immudb omits, to dual proof of
+// transaction, as it cannot be requested offline.
+func (aw *archiveWriter) fillProof(vtx *schema.VerifiableTx) error {
+	if vtx.GetDualProof() == nil {
+		return errors.New("missing dual proof")
+	}
+
+	dualProof := schema.DualProofFromProto(vtx.DualProof)
+	err := schema.FillMissingLinearAdvanceProof(
+		context.TODO(),
+		dualProof,
+		dualProof.SourceTxHeader.ID,
+		dualProof.TargetTxHeader.ID,
+		aw.client.GetServiceClient(),
+	)
+	if err != nil {
+		return fmt.Errorf("could not get linear advance proof, %w", err)
+	}
+
+	vtx.DualProof = schema.DualProofToProto(dualProof)
+	return nil
+}
+
+func (aw *archiveWriter) write(ae ArchiveEntry) error {
+	err := aw.enc.Encode(ae)
+	if err != nil {
+		return fmt.Errorf("could not write entry %s, %w", ae.Key, err)
+	}
+
+	aw.manifest.Entries++
+	return nil
+}
+
+// close writes archive to w.
+func (aw *archiveWriter) close(w io.Writer) error {
+	err := aw.buf.Flush()
+	if err != nil {
+		return fmt.Errorf("could not write entries, %w", err)
+	}
+
+	size, err := aw.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	_, err = aw.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := json.MarshalIndent(aw.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal manifest, %w", err)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err = tw.WriteHeader(&tar.Header{Name: archiveManifest, Mode: 0644, Size: int64(len(manifest)), ModTime: aw.manifest.ExportedAt})
+	if err == nil {
+		_, err = tw.Write(manifest)
+	}
+	if err == nil {
+		err = tw.WriteHeader(&tar.Header{Name: archiveEntries, Mode: 0644, Size: size, ModTime: aw.manifest.ExportedAt})
+	}
+	if err == nil {
+		_, err = io.Copy(tw, aw.file)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("could not write archive, %w", err)
+	}
+
+	return nil
+}
+
+func (aw *archiveWriter) discard() {
+	aw.file.Close()
+	os.Remove(aw.file.Name())
+}
+
+// Export writes archive of key-value collection entries to w, with current
+// revisions only or with full history. Deleted revisions are not exported,
+// as immudb does not prove deletions by inclusion.
+func (jr *JsonKVRepository) Export(w io.Writer, history bool) (ArchiveManifest, error) {
+	aw, err := newArchiveWriter(jr.client, jr.collection, jr.cfg, history)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	defer aw.discard()
+
+	stateTx := aw.manifest.State.TxID
+	err = jr.scanPayloads(nil, func(pk string, e *schema.Entry) error {
+		if !history && e.Tx <= stateTx {
+			return jr.exportEntry(aw, pk, e.Key, e.Tx, e.Revision)
+		}
+
+		// revisions written during export are not proven by the state, so
+		// current revision is the last one before it
+		last := History{}
+		err := jr.KeyHistory(pk, 0, stateTx, func(h History) error {
+			if history && !h.Deleted {
+				return jr.exportEntry(aw, pk, e.Key, h.TxID, h.Revision)
+			}
+
+			last = h
+			return nil
+		})
+		if err != nil || history || last.TxID == 0 || last.Deleted {
+			return err
+		}
+
+		return jr.exportEntry(aw, pk, e.Key, last.TxID, last.Revision)
+	})
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+
+	return aw.manifest, aw.close(w)
+}
+
+func (jr *JsonKVRepository) exportEntry(aw *archiveWriter, pk string, key []byte, txID uint64, revision uint64) error {
+	vEntry, err := jr.client.GetServiceClient().VerifiableGet(context.TODO(), &schema.VerifiableGetRequest{
+		KeyRequest:   &schema.KeyRequest{Key: key, AtTx: txID},
+		ProveSinceTx: aw.manifest.State.TxID,
+	})
+	if err != nil {
+		return fmt.Errorf("could not get proof of %s at transaction %d, %w", pk, txID, err)
+	}
+
+	err = aw.fillProof(vEntry.GetVerifiableTx())
+	if err != nil {
+		return fmt.Errorf("could not get proof of %s at transaction %d, %w", pk, txID, err)
+	}
+
+	proof, err := protojson.Marshal(vEntry)
+	if err != nil {
+		return fmt.Errorf("could not marshal proof of %s, %w", pk, err)
+	}
+
+	ae := ArchiveEntry{Key: pk, TxID: txID, Revision: revision, Entry: vEntry.Entry.Value, Proof: proof}
+	err = verifyArchiveEntry(aw.manifest, ae)
+	if err != nil {
+		return fmt.Errorf("could not verify %s at transaction %d, %w", pk, txID, err)
+	}
+
+	return aw.write(ae)
+}
+
+// Export writes archive of SQL collection rows to w. SQL rows do not expose
+// their revisions, so only current rows are exported.
+func (jr *JsonSQLRepository) Export(w io.Writer) (ArchiveManifest, error) {
+	aw, err := newArchiveWriter(jr.client, jr.collection, jr.cfg, false)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	defer aw.discard()
+
+	for _, c := range jr.primaryKey {
+		aw.manifest.PrimaryKey = append(aw.manifest.PrimaryKey, c.name)
+	}
+
+	_, err = jr.selectPaged(jr.collection, "", map[string]interface{}{}, ReadOptions{}, func(object []byte) error {
+		return jr.exportRow(aw, object)
+	})
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+
+	return aw.manifest, aw.close(w)
+}
+
+func (jr *JsonSQLRepository) exportRow(aw *archiveWriter, object []byte) error {
+	key, primaryKey := jr.primaryKeyOf(object)
+	pkValues, err := jr.primaryKeyValues(primaryKey)
+	if err != nil {
+		return fmt.Errorf("invalid primary key %s, %w", key, err)
+	}
+
+	vEntry, err := jr.client.GetServiceClient().VerifiableSQLGet(context.TODO(), &schema.VerifiableSQLGetRequest{
+		SqlGetRequest: &schema.SQLGetRequest{Table: jr.collection, PkValues: pkValues},
+		ProveSinceTx:  aw.manifest.State.TxID,
+	})
+	if err != nil {
+		return fmt.Errorf("could not get proof of %s, %w", key, err)
+	}
+
+	// rows are not read at the state, so one changed since is not proven
+	if vEntry.SqlEntry.Tx > aw.manifest.State.TxID {
+		log.WithField("key", key).Warn("Row written during export, skipping")
+		return nil
+	}
+
+	err = aw.fillProof(vEntry.GetVerifiableTx())
+	if err != nil {
+		return fmt.Errorf("could not get proof of %s, %w", key, err)
+	}
+
+	proof, err := protojson.Marshal(vEntry)
+	if err != nil {
+		return fmt.Errorf("could not marshal proof of %s, %w", key, err)
+	}
+
+	ae := ArchiveEntry{Key: key, TxID: vEntry.SqlEntry.Tx, Entry: object, Proof: proof}
+	err = verifyArchiveEntry(aw.manifest, ae)
+	if err != nil {
+		return fmt.Errorf("could not verify %s, %w", key, err)
+	}
+
+	return aw.write(ae)
+}
+
+// ReadArchive reads archive, passing its manifest to manifestFn before its
+// entries are streamed to fn.
+func ReadArchive(r io.Reader, manifestFn func(ArchiveManifest) error, fn func(ArchiveEntry) error) (ArchiveManifest, error) {
+	manifest := ArchiveManifest{}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, fmt.Errorf("invalid archive, %w", err)
+	}
+
+	tr := tar.NewReader(gr)
+	hasManifest := false
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("invalid archive, %w", err)
+		}
+
+		switch h.Name {
+		case archiveManifest:
+			err = json.NewDecoder(tr).Decode(&manifest)
+			if err != nil {
+				return manifest, fmt.Errorf("invalid manifest, %w", err)
+			}
+
+			err = validateManifest(manifest)
+			if err != nil {
+				return manifest, err
+			}
+			hasManifest = true
+
+			err = manifestFn(manifest)
+			if err != nil {
+				return manifest, err
+			}
+		case archiveEntries:
+			if !hasManifest {
+				return manifest, errors.New("invalid archive, entries before manifest")
+			}
+
+			count := uint64(0)
+			scanner := bufio.NewScanner(tr)
+			scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+			for scanner.Scan() {
+				ae := ArchiveEntry{}
+				err = json.Unmarshal(scanner.Bytes(), &ae)
+				if err != nil {
+					return manifest, fmt.Errorf("invalid entry %d, %w", count+1, err)
+				}
+				count++
+
+				err = fn(ae)
+				if err != nil {
+					return manifest, err
+				}
+			}
+			if scanner.Err() != nil {
+				return manifest, fmt.Errorf("could not read entries, %w", scanner.Err())
+			}
+
+			if count != manifest.Entries {
+				return manifest, fmt.Errorf("archive has %d entries, manifest lists %d", count, manifest.Entries)
+			}
+
+			return manifest, nil
+		}
+	}
+
+	if !hasManifest {
+		return manifest, errors.New("invalid archive, missing manifest")
+	}
+
+	return manifest, errors.New("invalid archive, missing entries")
+}
+
+// validateManifest checks manifest read from archive, which is untrusted
+// input, has everything its entries are verified and imported with.
+func validateManifest(m ArchiveManifest) error {
+	if m.Format != ArchiveFormat {
+		return fmt.Errorf("unsupported archive format %d", m.Format)
+	}
+
+	if m.Collection == "" {
+		return errors.New("invalid manifest, missing collection")
+	}
+
+	if m.Config.Type != "kv" && m.Config.Type != "sql" {
+		return fmt.Errorf("invalid manifest, unknown collection type %s", m.Config.Type)
+	}
+
+	if len(m.Config.Indexes) == 0 {
+		return errors.New("invalid manifest, missing indexes")
+	}
+
+	if m.Config.Type == "sql" && len(m.PrimaryKey) == 0 {
+		return errors.New("invalid manifest, missing primary key")
+	}
+
+	stateHash, err := hex.DecodeString(m.State.TxHash)
+	if m.State.TxID == 0 || err != nil || len(stateHash) != sha256.Size {
+		return errors.New("invalid manifest, invalid state")
+	}
+
+	return nil
+}
+
+// errManifestRead stops reading archive after its manifest.
+var errManifestRead = errors.New("manifest read")
+
+// ReadArchiveManifest reads manifest of archive, without its entries.
+func ReadArchiveManifest(r io.Reader) (ArchiveManifest, error) {
+	manifest, err := ReadArchive(r, func(ArchiveManifest) error {
+		return errManifestRead
+	}, nil)
+	if errors.Is(err, errManifestRead) {
+		return manifest, nil
+	}
+	if err == nil {
+		err = errors.New("invalid archive, missing manifest")
+	}
+
+	return manifest, err
+}
+
+// ErrUntrustedState is returned by VerifyArchive when state of archive
+// differs from the trusted one.
+var ErrUntrustedState = errors.New("archive state differs from trusted one")
+
+// VerifyArchive verifies every entry of archive against state in its
+// manifest, without connection to immudb. Archive state must be the trusted
+// one, obtained independently, as archive proves entries against its own
+// state only. Database of trusted state is compared only if set. Results of
+// entries are streamed to fn, with nil error for verified ones.
+func VerifyArchive(r io.Reader, trusted ArchiveState, fn func(ArchiveEntry, error) error) (ArchiveManifest, error) {
+	if trusted.TxID == 0 || trusted.TxHash == "" {
+		return ArchiveManifest{}, errors.New("trusted state transaction and hash are required")
+	}
+
+	manifest := ArchiveManifest{}
+	return ReadArchive(r, func(m ArchiveManifest) error {
+		if m.State.TxID != trusted.TxID || !strings.EqualFold(m.State.TxHash, trusted.TxHash) ||
+			(trusted.Database != "" && m.State.Database != trusted.Database) {
+			return fmt.Errorf("%w, archive is proven against transaction %d with hash %s of database %s",
+				ErrUntrustedState, m.State.TxID, m.State.TxHash, m.State.Database)
+		}
+
+		manifest = m
+		return nil
+	}, func(ae ArchiveEntry) error {
+		return fn(ae, verifyArchiveEntry(manifest, ae))
+	})
+}
+
+func verifyArchiveEntry(m ArchiveManifest, ae ArchiveEntry) error {
+	if m.Config.Type == "sql" {
+		return verifySQLArchiveEntry(m, ae)
+	}
+
+	vEntry := &schema.VerifiableEntry{}
+	err := protojson.Unmarshal(ae.Proof, vEntry)
+	if err != nil {
+		return fmt.Errorf("invalid proof, %w", err)
+	}
+
+	if vEntry.GetEntry() == nil || vEntry.Entry.ReferencedBy != nil {
+		return errors.New("invalid proof, missing entry")
+	}
+
+	key := []byte(fmt.Sprintf("%s.payload.%s.{%s}", m.Collection, m.Config.Indexes[0], ae.Key))
+	if !bytes.Equal(vEntry.Entry.Key, key) {
+		return fmt.Errorf("proof is for key %s", vEntry.Entry.Key)
+	}
+
+	if vEntry.Entry.Tx != ae.TxID {
+		return fmt.Errorf("proof is for transaction %d", vEntry.Entry.Tx)
+	}
+
+	if compactJSON(string(ae.Entry)) != compactJSON(string(vEntry.Entry.Value)) {
+		return errors.New("entry differs from proven value")
+	}
+
+	e := database.EncodeEntrySpec(key, schema.KVMetadataFromProto(vEntry.Entry.Metadata), vEntry.Entry.Value)
+	return verifyEntryProof(m.State, ae.TxID, e, vEntry.VerifiableTx, vEntry.InclusionProof)
+}
+
+func verifySQLArchiveEntry(m ArchiveManifest, ae ArchiveEntry) error {
+	vEntry := &schema.VerifiableSQLEntry{}
+	err := protojson.Unmarshal(ae.Proof, vEntry)
+	if err != nil {
+		return fmt.Errorf("invalid proof, %w", err)
+	}
+
+	if vEntry.GetSqlEntry() == nil {
+		return errors.New("invalid proof, missing entry")
+	}
+
+	if vEntry.SqlEntry.Tx != ae.TxID {
+		return fmt.Errorf("proof is for transaction %d", vEntry.SqlEntry.Tx)
+	}
+
+	row, err := decodeSQLRow(vEntry.SqlEntry.Value, vEntry.ColTypesById)
+	if err != nil {
+		return fmt.Errorf("invalid proof, %w", err)
+	}
+
+	// the key is built from proven row, so the row is bound to its primary key
+	pk := bytes.Buffer{}
+	for _, id := range vEntry.PKIDs {
+		v, ok := row[id]
+		if !ok {
+			return errors.New("invalid proof, missing primary key value")
+		}
+
+		encoded, err := sql.EncodeAsKey(v.Value(), vEntry.ColTypesById[id], int(vEntry.ColLenById[id]))
+		if err != nil {
+			return fmt.Errorf("invalid proof, %w", err)
+		}
+		pk.Write(encoded)
+	}
+
+	key := sql.MapKey(
+		[]byte{immudb.SQLPrefix},
+		sql.PIndexPrefix,
+		sql.EncodeID(vEntry.DatabaseId),
+		sql.EncodeID(vEntry.TableId),
+		sql.EncodeID(sql.PKIndexID),
+		pk.Bytes())
+
+	var value sql.TypedValue
+	for id, name := range vEntry.ColNamesById {
+		if name == "__value__" {
+			value = row[id]
+		}
+	}
+
+	if value == nil || value.Type() != sql.BLOBType {
+		return errors.New("invalid proof, missing value column")
+	}
+
+	if compactJSON(string(ae.Entry)) != compactJSON(string(value.Value().([]byte))) {
+		return errors.New("entry differs from proven value")
+	}
+
+	e := &store.EntrySpec{Key: key, Value: vEntry.SqlEntry.Value}
+	return verifyEntryProof(m.State, ae.TxID, e, vEntry.VerifiableTx, vEntry.InclusionProof)
+}
+
+// decodeSQLRow decodes row encoded by immudb SQL engine into values by
+// column id.
+func decodeSQLRow(encoded []byte, colTypes map[uint32]string) (map[uint32]sql.TypedValue, error) {
+	if len(encoded) < sql.EncLenLen {
+		return nil, sql.ErrCorruptedData
+	}
+
+	count := binary.BigEndian.Uint32(encoded)
+	off := sql.EncLenLen
+	row := make(map[uint32]sql.TypedValue, count)
+	for i := uint32(0); i < count; i++ {
+		if len(encoded) < off+sql.EncIDLen {
+			return nil, sql.ErrCorruptedData
+		}
+
+		id := binary.BigEndian.Uint32(encoded[off:])
+		off += sql.EncIDLen
+
+		colType, ok := colTypes[id]
+		if !ok {
+			return nil, sql.ErrCorruptedData
+		}
+
+		v, n, err := sql.DecodeValue(encoded[off:], colType)
+		if err != nil {
+			return nil, err
+		}
+
+		row[id] = v
+		off += n
+	}
+
+	return row, nil
+}
+
+// verifyEntryProof verifies inclusion of entry in transaction txID, and
+// consistency of the transaction with state.
+func verifyEntryProof(state ArchiveState, txID uint64, e *store.EntrySpec, vtx *schema.VerifiableTx, inclusion *schema.InclusionProof) error {
+	if vtx.GetDualProof() == nil || vtx.GetTx().GetHeader() == nil || inclusion == nil {
+		return errors.New("invalid proof, missing transaction proofs")
+	}
+
+	if txID > state.TxID {
+		return fmt.Errorf("transaction %d is after state %d", txID, state.TxID)
+	}
+
+	stateHash, err := hex.DecodeString(state.TxHash)
+	if err != nil || len(stateHash) != sha256.Size {
+		return errors.New("invalid state hash")
+	}
+	stateAlh := schema.DigestFromProto(stateHash)
+
+	digest, err := store.EntrySpecDigestFor(int(vtx.Tx.Header.Version))
+	if err != nil {
+		return err
+	}
+
+	dualProof := schema.DualProofFromProto(vtx.DualProof)
+	if dualProof.SourceTxHeader == nil || dualProof.TargetTxHeader == nil {
+		return errors.New("invalid proof, missing transaction headers")
+	}
+
+	// proofs are requested since state, so the transaction is the source
+	// unless it is the state itself
+	var eh, sourceAlh, targetAlh [sha256.Size]byte
+	sourceID, targetID := txID, state.TxID
+	if txID == state.TxID {
+		eh = dualProof.TargetTxHeader.Eh
+		sourceAlh, targetAlh = stateAlh, dualProof.TargetTxHeader.Alh()
+	} else {
+		eh = dualProof.SourceTxHeader.Eh
+		sourceAlh, targetAlh = dualProof.SourceTxHeader.Alh(), stateAlh
+	}
+
+	if !store.VerifyInclusion(schema.InclusionProofFromProto(inclusion), digest(e), eh) {
+		return errors.New("entry is not included in transaction")
+	}
+
+	if !store.VerifyDualProof(dualProof, sourceID, targetID, sourceAlh, targetAlh) {
+		return fmt.Errorf("transaction %d is not consistent with state", txID)
+	}
+
+	return nil
+}
+
+// SetupFromManifest creates collection with definition of archived one. If
+// collection exists, it must have the same definition.
+func SetupFromManifest(cli immudb.ImmuClient, collection string, m ArchiveManifest) error {
+	cfg := m.Config
+	cfg.Version = 0
+	cfg.Dropped = false
+
+	return NewConfigs(cli).Create(collection, cfg, false, func() error {
+		switch cfg.Type {
+		case "kv":
+			return SetupJsonKVRepository(cli, collection, cfg.Indexes)
+		case "sql":
+			if len(m.PrimaryKey) == 0 {
+				return errors.New("archive is missing primary key of SQL collection")
+			}
+
+			return SetupJsonSQLRepository(cli, collection, strings.Join(m.PrimaryKey, ","), cfg.Indexes)
+		}
+
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	})
+}
@@ -0,0 +1,90 @@
+package immudb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// archiveOf returns archive with manifest and single entry.
+func archiveOf(t *testing.T, m ArchiveManifest) *bytes.Buffer {
+	t.Helper()
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{archiveManifest, manifest},
+		{archiveEntries, []byte(`{"Key":"1","TxID":1,"Entry":{"id":"1"},"Proof":{}}` + "\n")},
+	} {
+		err = tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o600, Size: int64(len(f.content))})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tw.Write(f.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tw.Close()
+	gw.Close()
+	return buf
+}
+
+func TestReadArchiveInvalidManifest(t *testing.T) {
+	state := ArchiveState{Database: "defaultdb", TxID: 1, TxHash: strings.Repeat("ab", 32)}
+	valid := ArchiveManifest{Format: ArchiveFormat, Collection: "test", Config: Config{Type: "kv", Indexes: []string{"id"}}, Entries: 1, State: state}
+
+	tests := map[string]func(m *ArchiveManifest){
+		"format":            func(m *ArchiveManifest) { m.Format = 0 },
+		"collection":        func(m *ArchiveManifest) { m.Collection = "" },
+		"type":              func(m *ArchiveManifest) { m.Config.Type = "other" },
+		"kv indexes":        func(m *ArchiveManifest) { m.Config.Indexes = nil },
+		"sql indexes":       func(m *ArchiveManifest) { m.Config.Type, m.Config.Indexes, m.PrimaryKey = "sql", nil, []string{"id"} },
+		"sql primary key":   func(m *ArchiveManifest) { m.Config.Type, m.Config.Indexes = "sql", []string{"id=INTEGER"} },
+		"state transaction": func(m *ArchiveManifest) { m.State.TxID = 0 },
+		"state hash":        func(m *ArchiveManifest) { m.State.TxHash = "x" },
+		"state hash length": func(m *ArchiveManifest) { m.State.TxHash = "abab" },
+	}
+
+	for name, invalidate := range tests {
+		t.Run(name, func(t *testing.T) {
+			m := valid
+			m.Config.Indexes = append([]string{}, valid.Config.Indexes...)
+			invalidate(&m)
+
+			_, err := ReadArchive(archiveOf(t, m), func(ArchiveManifest) error { return nil }, func(ArchiveEntry) error {
+				t.Fatal("expected entries not to be read")
+				return nil
+			})
+			if err == nil || !strings.Contains(err.Error(), "manifest") && !strings.Contains(err.Error(), "format") {
+				t.Errorf("expected invalid manifest error, got %v", err)
+			}
+		})
+	}
+
+	// entry of valid manifest is verified, and fails on its missing proof
+	failed := 0
+	_, err := VerifyArchive(archiveOf(t, valid), state, func(ae ArchiveEntry, err error) error {
+		if err != nil {
+			failed++
+		}
+		return nil
+	})
+	if err != nil || failed != 1 {
+		t.Errorf("expected entry to fail verification, got %d failures and %v", failed, err)
+	}
+}
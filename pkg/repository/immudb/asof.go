@@ -0,0 +1,157 @@
+package immudb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// Reads as of transaction scan index entries existing now, and resolve every
+// entry to the object version at transaction. Index entries are kept for
+// every value an object ever had, so entry is returned only if the object
+// version would create exactly this entry. Entries deleted since are not
+// scanned, so reads as of transaction before purge or drop of collection
+// fail, instead of returning incomplete state.
+
+// checkAsOf fails with invalid query if entries of collection were deleted
+// after transaction, by purge or drop.
+func (jr *JsonKVRepository) checkAsOf(asOfTx uint64) error {
+	purged, err := jr.client.Get(context.TODO(), []byte(fmt.Sprintf("%s.%s", jr.collection, purgedKey)))
+	if err != nil && !isKeyNotFound(err) {
+		return fmt.Errorf("could not read purge of collection, %w", err)
+	}
+
+	if err == nil && purged.Tx > asOfTx {
+		return invalidQuery(fmt.Errorf("collection was purged in transaction %d, so it cannot be read as of transaction %d", purged.Tx, asOfTx))
+	}
+
+	revisions, err := NewConfigs(jr.client).History(jr.collection)
+	if err != nil {
+		return fmt.Errorf("could not read collection definition history, %w", err)
+	}
+
+	for _, r := range revisions {
+		if r.Dropped && r.Tx > asOfTx {
+			return invalidQuery(fmt.Errorf("collection was dropped in transaction %d, so it cannot be read as of transaction %d", r.Tx, asOfTx))
+		}
+	}
+
+	return nil
+}
+
+// indexedObjectAt resolves scanned entry of field index to object as of
+// transaction, or nil if the entry did not point to the object then.
+func (jr *JsonKVRepository) indexedObjectAt(field string, e *schema.Entry, asOfTx uint64) ([]byte, error) {
+	// ingestion index references versions of objects written with it
+	if field == ingestedIndex {
+		if e.ReferencedBy == nil || e.ReferencedBy.Tx > asOfTx {
+			return nil, nil
+		}
+
+		return e.Value, nil
+	}
+
+	payloadKey := e.Value
+	indexKey := e.Key
+	if e.ReferencedBy != nil {
+		payloadKey, indexKey = e.Key, e.ReferencedBy.Key
+	}
+
+	object, err := jr.objectAt(payloadKey, asOfTx)
+	if err != nil || object == nil || field == jr.indexedKeys[0] {
+		return object, err
+	}
+
+	op, err := jr.indexOf(field, object)
+	if err != nil || op == nil || !bytes.Equal(op.GetKv().GetKey(), indexKey) {
+		return nil, err
+	}
+
+	return object, nil
+}
+
+// zMemberObjectAt resolves sorted set member of field index to object as of
+// transaction, or nil if the object was not the member then.
+func (jr *JsonKVRepository) zMemberObjectAt(field string, e *schema.ZEntry, asOfTx uint64) ([]byte, error) {
+	object, err := jr.objectAt(e.Key, asOfTx)
+	if err != nil || object == nil {
+		return nil, err
+	}
+
+	isMember, err := jr.isMemberOf(field, e, object)
+	if err != nil || !isMember {
+		return nil, err
+	}
+
+	return object, nil
+}
+
+// isMemberOf reports whether object is indexed by sorted set member, which
+// is not the case once field of object was updated, or collection was
+// dropped and object written again, as members cannot be removed.
+func (jr *JsonKVRepository) isMemberOf(field string, e *schema.ZEntry, object []byte) (bool, error) {
+	op, err := jr.indexOf(field, object)
+	if err != nil || op == nil {
+		return false, err
+	}
+
+	zAdd := op.GetZAdd()
+	return zAdd != nil && bytes.Equal(zAdd.Set, e.Set) && zAdd.Score == e.Score, nil
+}
+
+// indexOf returns index operation object would be written with, or nil if the
+// object is not indexed by field.
+func (jr *JsonKVRepository) indexOf(field string, object []byte) (*schema.Op, error) {
+	gjsonObject := gjson.ParseBytes(object)
+	pk, err := jr.primaryKeyValue(gjsonObject)
+	if err != nil {
+		return nil, err
+	}
+
+	// versions missing required field could not be written, so they are
+	// not in the index
+	op, err := jr.secondaryIndex(field, gjsonObject, pk)
+	if err != nil {
+		return nil, nil
+	}
+
+	return op, nil
+}
+
+// objectAt returns value of payload key as of transaction, or nil if it did
+// not exist or was deleted then.
+func (jr *JsonKVRepository) objectAt(payloadKey []byte, asOfTx uint64) ([]byte, error) {
+	offset := uint64(0)
+	for {
+		entries, err := jr.client.History(context.TODO(), &schema.HistoryRequest{
+			Key:    payloadKey,
+			Offset: offset,
+			Limit:  999,
+			Desc:   true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not get history of %s, %w", payloadKey, err)
+		}
+
+		for _, e := range entries.Entries {
+			if e.Tx > asOfTx {
+				offset++
+				continue
+			}
+
+			if e.Metadata.GetDeleted() {
+				return nil, nil
+			}
+
+			return e.Value, nil
+		}
+
+		if len(entries.Entries) < 999 {
+			return nil, nil
+		}
+	}
+}
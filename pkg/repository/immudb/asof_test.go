@@ -0,0 +1,125 @@
+package immudb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+func TestAsOfAfterPurge(t *testing.T) {
+	cli, repo := newExpiringCollection(t, "kv")
+	jr := repo.(*JsonKVRepository)
+
+	state, err := cli.CurrentState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	beforePurge := state.TxId
+
+	readAsOf := func(asOfTx uint64) ([]string, error) {
+		objects := []string{}
+		_, err := jr.Read("user", "", ReadOptions{AsOfTx: asOfTx}, func(object []byte) error {
+			objects = append(objects, string(object))
+			return nil
+		})
+		return objects, err
+	}
+
+	objects, err := readAsOf(beforePurge)
+	if err != nil || len(objects) != 3 {
+		t.Fatalf("expected 3 entries before purge, got %v, %v", objects, err)
+	}
+
+	err = jr.Purge("test", false, func(Tombstone) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// purged entries are no longer scanned, so state before purge is not
+	// complete
+	_, err = readAsOf(beforePurge)
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected read as of transaction before purge to fail, got %v", err)
+	}
+
+	_, err = jr.ReadIngested(time.Time{}, time.Time{}, ReadOptions{AsOfTx: beforePurge}, func([]byte) error { return nil })
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected ingestion read as of transaction before purge to fail, got %v", err)
+	}
+
+	// ingestion index entries are purged with entries
+	ingested := 0
+	_, err = jr.ReadIngested(time.Time{}, time.Time{}, ReadOptions{}, func([]byte) error {
+		ingested++
+		return nil
+	})
+	if err != nil || ingested != 1 {
+		t.Fatalf("expected ingestion entry kept by purge, got %d, %v", ingested, err)
+	}
+
+	state, err = cli.CurrentState(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err = readAsOf(state.TxId)
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("expected entry kept by purge, got %v, %v", objects, err)
+	}
+}
+
+func TestAsOfAfterDrop(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	cfg := Config{Type: "kv", Indexes: []string{"id"}}
+	err := CreateCollection(cli, "dropped", cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonKVRepository(cli, "dropped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	beforeDrop, err := jr.WriteBytes([]byte(`{"id":"1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = jr.Drop()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CreateCollection(cli, "dropped", cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err = NewJsonKVRepository(cli, "dropped")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	afterCreate, err := jr.WriteBytes([]byte(`{"id":"2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jr.Read("", "", ReadOptions{AsOfTx: beforeDrop}, func([]byte) error { return nil })
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected read as of transaction before drop to fail, got %v", err)
+	}
+
+	ids := readIDs(t, func(fn func([]byte) error) error {
+		_, err := jr.Read("", "", ReadOptions{AsOfTx: afterCreate}, fn)
+		return err
+	})
+	if !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Fatalf("expected entry of recreated collection, got %v", ids)
+	}
+}
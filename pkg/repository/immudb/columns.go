@@ -0,0 +1,291 @@
+package immudb
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tidwall/gjson"
+)
+
+// Missing fields handling for SQL collections.
+const (
+	MissingFieldsError = "error" // fail the write, default
+	MissingFieldsNull  = "null"  // store NULL in the column
+)
+
+// defaultFloatScale is number of decimal digits FLOAT values are stored
+// with, when not given in column type.
+const defaultFloatScale = 6
+
+type column struct {
+	name  string
+	cType string
+}
+
+// columnTypeRegexp matches column type with optional max length, e.g. VARCHAR[256]
+var columnTypeRegexp = regexp.MustCompile(`^([A-Z]+)(\[([0-9]+)\])?$`)
+
+// parseColumn parses column definition in format <name>=<type>. Besides types
+// native to immudb SQL, that is INTEGER, BOOLEAN, VARCHAR, BLOB and TIMESTAMP,
+// following types are supported:
+//   - UUID, stored as VARCHAR[36] in canonical form
+//   - JSON, stored as BLOB with json of any type, including objects and arrays
+//   - FLOAT[scale], stored as INTEGER of value multiplied by 10^scale, 6 by
+//     default, as immudb SQL has no floating point type. Values are rounded
+//     to scale decimal digits, which keeps their order, and limited to about
+//     ±9.2*10^(18-scale).
+func parseColumn(definition string) (column, error) {
+	splitted := strings.Split(definition, "=")
+	if len(splitted) != 2 {
+		return column{}, fmt.Errorf("invalid column definition, %s", definition)
+	}
+
+	err := ValidateIdentifier(splitted[0])
+	if err != nil {
+		return column{}, fmt.Errorf("invalid column, %w", err)
+	}
+
+	c := column{name: splitted[0], cType: strings.ToUpper(strings.TrimSpace(splitted[1]))}
+	m := columnTypeRegexp.FindStringSubmatch(c.cType)
+	if m == nil {
+		return column{}, fmt.Errorf("invalid column type %s", splitted[1])
+	}
+
+	switch m[1] {
+	case "INTEGER", "BOOLEAN", "TIMESTAMP", "UUID", "JSON":
+		if m[2] != "" {
+			return column{}, fmt.Errorf("column type %s does not support max length", m[1])
+		}
+	case "VARCHAR", "BLOB":
+	case "FLOAT":
+		if c.scale() > 15 {
+			return column{}, errors.New("FLOAT scale can be at most 15")
+		}
+	default:
+		return column{}, fmt.Errorf("unsupported column type %s", m[1])
+	}
+
+	return c, nil
+}
+
+// parseColumns parses column definitions in format <name>=<type>.
+func parseColumns(definitions []string) ([]column, error) {
+	columns := []column{}
+	for _, d := range definitions {
+		c, err := parseColumn(d)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, c)
+	}
+
+	return columns, nil
+}
+
+// ValidateSQLColumns validates SQL collection definition, so it can be
+// checked before the collection is created.
+func ValidateSQLColumns(definitions []string, primaryKey []string, policies map[string]IndexPolicy) error {
+	columns, err := parseColumns(definitions)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+
+	err = ValidateIndexPolicies(policies, names, primaryKey)
+	if err != nil {
+		return fmt.Errorf("invalid index policies, %w", err)
+	}
+
+	for field, p := range policies {
+		if p.Mode == IndexDefault {
+			c, _ := findColumn(columns, field)
+			_, err = filterValue(c, p.Default)
+			if err != nil {
+				return fmt.Errorf("invalid default, %w", err)
+			}
+		}
+	}
+
+	for _, pk := range primaryKey {
+		c, err := findColumn(columns, pk)
+		if err != nil {
+			return fmt.Errorf("invalid primary key, %w", err)
+		}
+
+		if !c.indexable() {
+			return fmt.Errorf("column %s of type %s cannot be used as primary key, variable sized types need max length up to 256", c.name, c.cType)
+		}
+	}
+
+	return nil
+}
+
+// baseType returns column type without max length.
+func (c column) baseType() string {
+	return columnTypeRegexp.FindStringSubmatch(c.cType)[1]
+}
+
+// maxLen returns column max length, 0 if not limited.
+func (c column) maxLen() int {
+	m := columnTypeRegexp.FindStringSubmatch(c.cType)
+	if m[3] == "" {
+		return 0
+	}
+
+	maxLen, _ := strconv.Atoi(m[3])
+	return maxLen
+}
+
+// scale returns number of decimal digits of FLOAT column.
+func (c column) scale() int {
+	m := columnTypeRegexp.FindStringSubmatch(c.cType)
+	if m[3] == "" {
+		return defaultFloatScale
+	}
+
+	scale, _ := strconv.Atoi(m[3])
+	return scale
+}
+
+// scaled converts value of FLOAT column to integer it is stored as.
+func (c column) scaled(v float64) (int64, error) {
+	s := math.Round(v * math.Pow10(c.scale()))
+	if math.IsNaN(s) || math.Abs(s) >= math.MaxInt64 {
+		return 0, fmt.Errorf("field %s value %v is out of range of %s", c.name, v, c.cType)
+	}
+
+	return int64(s), nil
+}
+
+// sqlType returns type of column in immudb SQL.
+func (c column) sqlType() string {
+	switch c.baseType() {
+	case "UUID":
+		return "VARCHAR[36]"
+	case "JSON":
+		return "BLOB"
+	case "FLOAT":
+		return "INTEGER"
+	}
+
+	return c.cType
+}
+
+// indexable returns true if column can be a part of immudb index.
+func (c column) indexable() bool {
+	switch c.baseType() {
+	case "INTEGER", "BOOLEAN", "TIMESTAMP", "UUID", "FLOAT":
+		return true
+	case "VARCHAR", "BLOB":
+		return c.maxLen() > 0 && c.maxLen() <= 256
+	}
+
+	return false
+}
+
+// value converts json field to value of column type:
+//   - INTEGER accepts integer numbers and strings
+//   - FLOAT accepts numbers and numeric strings
+//   - BOOLEAN accepts booleans, "true"/"false" strings and 0/1 numbers
+//   - VARCHAR accepts strings, other types are stored as json text
+//   - BLOB accepts strings as bytes, other types are stored as json bytes
+//   - TIMESTAMP accepts RFC3339 or "2006-01-02 15:04:05" strings, and numbers as unix seconds
+//   - UUID accepts strings in any format parsable as UUID
+//   - JSON accepts any json value, including nested objects and arrays
+func (c column) value(gjr gjson.Result) (interface{}, error) {
+	switch c.baseType() {
+	case "INTEGER":
+		if gjr.Type == gjson.Number {
+			if gjr.Num != float64(gjr.Int()) {
+				return nil, fmt.Errorf("field %s is not an integer, %s", c.name, gjr.Raw)
+			}
+			return gjr.Int(), nil
+		}
+		if gjr.Type == gjson.String {
+			v, err := strconv.ParseInt(gjr.Str, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not an integer, %w", c.name, err)
+			}
+			return v, nil
+		}
+	case "FLOAT":
+		if gjr.Type == gjson.Number {
+			return c.scaled(gjr.Num)
+		}
+		if gjr.Type == gjson.String {
+			v, err := strconv.ParseFloat(gjr.Str, 64)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not a number, %w", c.name, err)
+			}
+			return c.scaled(v)
+		}
+	case "BOOLEAN":
+		switch gjr.Type {
+		case gjson.True, gjson.False:
+			return gjr.Bool(), nil
+		case gjson.String:
+			v, err := strconv.ParseBool(gjr.Str)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not a boolean, %w", c.name, err)
+			}
+			return v, nil
+		case gjson.Number:
+			if gjr.Num == 0 || gjr.Num == 1 {
+				return gjr.Num == 1, nil
+			}
+		}
+	case "VARCHAR":
+		v := gjr.Raw
+		if gjr.Type == gjson.String {
+			v = gjr.Str
+		}
+		if c.maxLen() > 0 && len(v) > c.maxLen() {
+			return nil, fmt.Errorf("field %s exceeds max length %d", c.name, c.maxLen())
+		}
+		return v, nil
+	case "BLOB":
+		v := []byte(gjr.Raw)
+		if gjr.Type == gjson.String {
+			v = []byte(gjr.Str)
+		}
+		if c.maxLen() > 0 && len(v) > c.maxLen() {
+			return nil, fmt.Errorf("field %s exceeds max length %d", c.name, c.maxLen())
+		}
+		return v, nil
+	case "TIMESTAMP":
+		if gjr.Type == gjson.Number {
+			sec := int64(gjr.Num)
+			return time.Unix(sec, int64((gjr.Num-float64(sec))*1e9)).UTC(), nil
+		}
+		if gjr.Type == gjson.String {
+			v, err := ParseTime(gjr.Str)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not a timestamp, %w", c.name, err)
+			}
+			return v, nil
+		}
+	case "UUID":
+		if gjr.Type == gjson.String {
+			v, err := uuid.Parse(gjr.Str)
+			if err != nil {
+				return nil, fmt.Errorf("field %s is not an uuid, %w", c.name, err)
+			}
+			return v.String(), nil
+		}
+	case "JSON":
+		return []byte(gjr.Raw), nil
+	}
+
+	return nil, fmt.Errorf("field %s of type %s cannot be stored as %s", c.name, gjr.Type, c.cType)
+}
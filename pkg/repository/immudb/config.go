@@ -1,19 +1,227 @@
 package immudb
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
+	"github.com/tomekkolo/immudb-play/pkg/service"
+	"google.golang.org/grpc/status"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/codenotary/immudb/pkg/api/schema"
 	immudb "github.com/codenotary/immudb/pkg/client"
 )
 
+// Index policies, defining how indexed field missing in json is handled.
+const (
+	IndexRequired = "required" // fail the write, default
+	IndexOptional = "optional" // skip index entry or store NULL column
+	IndexDefault  = "default"  // use default value
+)
+
+type IndexPolicy struct {
+	Mode    string
+	Default string `json:",omitempty"`
+}
+
 type Config struct {
+	// Version is a sequential number of config revision, starting from 1
+	Version uint64 `json:",omitempty"`
+
 	Parser  string
 	Type    string
 	Indexes []string
+
+	// MissingFields defines how SQL collection handles fields missing in
+	// json, MissingFieldsError or MissingFieldsNull
+	MissingFields string `json:",omitempty"`
+
+	// IndexPolicies per indexed field, fields without policy are required
+	IndexPolicies map[string]IndexPolicy `json:",omitempty"`
+
+	// Building are indexes of key-value collection being written by
+	// reindex. Writers maintain them, but they cannot be read until reindex
+	// is done
+	Building []string `json:",omitempty"`
+
+	// Layout of key-value collection, KVLayoutLinks or KVLayoutRefs
+	Layout string `json:",omitempty"`
+
+	// Scored are indexed fields of KVLayoutRefs collection, stored in
+	// sorted sets scored by field value
+	Scored []string `json:",omitempty"`
+
+	// Overwrite defines how writes of existing primary key are handled,
+	// OverwriteAllow, OverwriteWarn or OverwriteReject
+	Overwrite string `json:",omitempty"`
+
+	// Retention is period entries are kept for, e.g. "400d", entries older
+	// than that are deleted by purge
+	Retention string `json:",omitempty"`
+
+	// Dropped is set when collection data was deleted, config history is
+	// kept for audit
+	Dropped bool `json:",omitempty"`
+}
+
+// Overwrite policies, defining how writes of existing primary key are
+// handled. Append-only sources should never overwrite their entries.
+const (
+	OverwriteAllow  = "allow"  // store new revision, default
+	OverwriteWarn   = "warn"   // store new revision and log warning
+	OverwriteReject = "reject" // fail the write with ErrOverwriteRejected
+)
+
+// ErrOverwriteRejected is returned for writes of existing primary key into
+// collection with OverwriteReject policy.
+var ErrOverwriteRejected = service.ErrOverwriteRejected
+
+// ValidateOverwrite checks if overwrite policy is known.
+func ValidateOverwrite(policy string) error {
+	if policy != OverwriteAllow && policy != OverwriteWarn && policy != OverwriteReject {
+		return fmt.Errorf("unknown overwrite policy %s", policy)
+	}
+
+	return nil
 }
 
+// ParseRetention parses retention period, as Go duration or number of days
+// with "d" suffix, e.g. "400d".
+func ParseRetention(retention string) (time.Duration, error) {
+	var period time.Duration
+	if strings.HasSuffix(retention, "d") {
+		n, err := strconv.ParseUint(strings.TrimSuffix(retention, "d"), 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %s, %w", retention, err)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		period, err = time.ParseDuration(retention)
+		if err != nil {
+			return 0, fmt.Errorf("invalid retention %s, %w", retention, err)
+		}
+	}
+
+	if period <= 0 {
+		return 0, fmt.Errorf("invalid retention %s, must be positive", retention)
+	}
+
+	return period, nil
+}
+
+// Key-value collection layouts.
+const (
+	KVLayoutLinks = "links" // index values are payload keys, default
+	KVLayoutRefs  = "refs"  // primary index is reference, others are sorted sets
+)
+
+// reservedIndexes are names of keys key-value collection writes next to its
+// indexes, so fields with such names cannot be indexed.
+var reservedIndexes = []string{ingestedIndex, tombstoneIndex, purgedKey}
+
+// ValidateKVIndexes checks that indexes of key-value collection do not use
+// reserved names.
+func ValidateKVIndexes(indexes []string) error {
+	for _, index := range indexes {
+		for _, r := range reservedIndexes {
+			if index == r {
+				return fmt.Errorf("index name %s is reserved", index)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateKVLayout checks that layout is known and scored fields are
+// secondary indexes of KVLayoutRefs collection.
+func ValidateKVLayout(layout string, scored []string, indexes []string) error {
+	if layout != KVLayoutLinks && layout != KVLayoutRefs {
+		return fmt.Errorf("unknown layout %s", layout)
+	}
+
+	if len(scored) > 0 && layout != KVLayoutRefs {
+		return fmt.Errorf("scored fields require %s layout", KVLayoutRefs)
+	}
+
+	for _, f := range scored {
+		indexed := false
+		for i := 1; i < len(indexes); i++ {
+			indexed = indexed || indexes[i] == f
+		}
+		if !indexed {
+			return fmt.Errorf("scored field %s is not a secondary index", f)
+		}
+	}
+
+	return nil
+}
+
+// IsScored returns true if indexed field is stored in sorted set scored by
+// field value.
+func (c *Config) IsScored(field string) bool {
+	for _, f := range c.Scored {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Policy returns policy for indexed field.
+func (c *Config) Policy(field string) IndexPolicy {
+	p, ok := c.IndexPolicies[field]
+	if ok {
+		return p
+	}
+
+	if c.MissingFields == MissingFieldsNull {
+		return IndexPolicy{Mode: IndexOptional}
+	}
+
+	return IndexPolicy{Mode: IndexRequired}
+}
+
+// ValidateIndexPolicies checks that policies are defined for indexed fields
+// only, and primary key fields are always required.
+func ValidateIndexPolicies(policies map[string]IndexPolicy, fields []string, primaryKey []string) error {
+	for field, p := range policies {
+		if p.Mode != IndexRequired && p.Mode != IndexOptional && p.Mode != IndexDefault {
+			return fmt.Errorf("invalid policy %s for %s", p.Mode, field)
+		}
+
+		indexed := false
+		for _, f := range fields {
+			if f == field {
+				indexed = true
+			}
+		}
+		if !indexed {
+			return fmt.Errorf("policy defined for not indexed field %s", field)
+		}
+
+		for _, pk := range primaryKey {
+			if pk == field && p.Mode != IndexRequired {
+				return fmt.Errorf("primary key field %s is always required", field)
+			}
+		}
+	}
+
+	return nil
+}
+
+// collectionsRegistry is a key prefix of registered collections.
+const collectionsRegistry = "_collections"
+
 type configs struct {
 	cli immudb.ImmuClient
 }
@@ -39,16 +247,237 @@ func (c *configs) Read(collection string) (*Config, error) {
 	return &cfg, nil
 }
 
+// Create sets up a new collection with setup and stores its config. Existing
+// collection can be redefined with force only, as entries already written
+// keep the layout of the previous config, while creating it again with the
+// same definition does nothing. Config is stored only if setup succeeds.
+func (c *configs) Create(collection string, cfg Config, force bool, setup func() error) error {
+	current, err := c.Read(collection)
+	if err != nil && !isKeyNotFound(err) {
+		return err
+	}
+
+	if err == nil && !current.Dropped {
+		if sameDefinition(*current, cfg) {
+			// config is stored only after setup succeeded, so there is
+			// nothing left to set up
+			log.WithField("collection", collection).Info("Collection already exists with the same definition")
+			return nil
+		}
+
+		if !force {
+			return errors.New("collection already exists with different definition, use collections alter to add indexes, or --force to overwrite")
+		}
+
+		log.WithField("collection", collection).WithField("version", current.Version).Warn("Overwriting collection definition, existing entries keep previous layout")
+	}
+
+	err = setup()
+	if err != nil {
+		return err
+	}
+
+	err = c.Write(collection, cfg)
+	if err != nil {
+		return fmt.Errorf("could not store collection definition, %w", err)
+	}
+
+	return nil
+}
+
+// Write stores the next revision of collection config and registers
+// collection, so it can be listed. Write fails if config was modified
+// concurrently.
 func (c *configs) Write(collection string, cfg Config) error {
+	key := []byte(fmt.Sprintf("%s.config", collection))
+	precondition := schema.PreconditionKeyMustNotExist(key)
+	cfg.Version = 1
+
+	current, err := c.cli.Get(context.TODO(), key)
+	if err != nil && !isKeyNotFound(err) {
+		return err
+	}
+
+	if err == nil {
+		precondition = schema.PreconditionKeyNotModifiedAfterTX(key, current.Tx)
+		cfg.Version = current.Revision + 1
+	}
+
 	b, err := json.Marshal(cfg)
 	if err != nil {
 		return err
 	}
 
-	_, err = c.cli.Set(context.TODO(), []byte(fmt.Sprintf("%s.config", collection)), b)
+	_, err = c.cli.SetAll(context.TODO(), &schema.SetRequest{
+		KVs: []*schema.KeyValue{
+			{
+				Key:   key,
+				Value: b,
+			},
+			{ // registry entry <collectionsRegistry>.{<collection>}
+				Key:   []byte(fmt.Sprintf("%s.{%s}", collectionsRegistry, collection)),
+				Value: []byte(cfg.Type),
+			},
+		},
+		Preconditions: []*schema.Precondition{precondition},
+	})
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// ConfigRevision is a config together with transaction it became active in.
+type ConfigRevision struct {
+	Config
+	Tx uint64
+}
+
+// History returns all revisions of collection config, oldest first.
+func (c *configs) History(collection string) ([]ConfigRevision, error) {
+	offset := uint64(0)
+	revisions := []ConfigRevision{}
+	for {
+		entries, err := c.cli.History(context.TODO(), &schema.HistoryRequest{
+			Key:    []byte(fmt.Sprintf("%s.config", collection)),
+			Offset: offset,
+			Limit:  999,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, e := range entries.Entries {
+			var cfg Config
+			err = json.Unmarshal(e.Value, &cfg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config revision %d, %w", e.Revision, err)
+			}
+
+			// configs written before versioning have no version
+			if cfg.Version == 0 {
+				cfg.Version = e.Revision
+			}
+
+			revisions = append(revisions, ConfigRevision{Config: cfg, Tx: e.Tx})
+			offset++
+		}
+
+		if len(entries.Entries) < 999 {
+			break
+		}
+	}
+
+	return revisions, nil
+}
+
+// ActiveConfig returns config revision active at transaction, that is the
+// latest one written up to it, or nil if there is none.
+func ActiveConfig(revisions []ConfigRevision, tx uint64) *ConfigRevision {
+	var active *ConfigRevision
+	for i := range revisions {
+		if revisions[i].Tx <= tx {
+			active = &revisions[i]
+		}
+	}
+
+	return active
+}
+
+// sameDefinition compares configs ignoring their versions. Configs are
+// compared as stored, so empty and missing lists or policies are equal.
+func sameDefinition(a Config, b Config) bool {
+	a.Version, b.Version = 0, 0
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ja, jb)
+}
+
+// IsNotFound reports whether err is caused by missing key, e.g. config of
+// collection which does not exist.
+func IsNotFound(err error) bool {
+	return isKeyNotFound(err)
+}
+
+// isKeyNotFound matches store error of missing key. immudb server returns it
+// without error code, as grpc status with the error message, which is
+// matched exactly, also when status is wrapped.
+func isKeyNotFound(err error) bool {
+	if errors.Is(err, store.ErrKeyNotFound) {
+		return true
+	}
+
+	var se interface{ GRPCStatus() *status.Status }
+	return errors.As(err, &se) && se.GRPCStatus().Message() == store.ErrKeyNotFound.Error()
+}
+
+func isPreconditionFailed(err error) bool {
+	return strings.Contains(err.Error(), "precondition failed")
+}
+
+// CreatedTx returns the transaction collection was created in, the last time
+// if it was dropped and created again.
+func (c *configs) CreatedTx(collection string) (uint64, error) {
+	revisions, err := c.History(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	created := uint64(0)
+	for i, r := range revisions {
+		if i == 0 || revisions[i-1].Dropped {
+			created = r.Tx
+		}
+	}
+
+	return created, nil
+}
+
+// ConfigTx returns the transaction the collection config was first written
+// in.
+func (c *configs) ConfigTx(collection string) (uint64, error) {
+	entry, err := c.cli.GetAtRevision(context.TODO(), []byte(fmt.Sprintf("%s.config", collection)), 1)
+	if err != nil {
+		return 0, err
+	}
+
+	return entry.Tx, nil
+}
+
+// List returns names of registered collections. Collections created before
+// the registry existed are registered with their next config write.
+func (c *configs) List() ([]string, error) {
+	prefix := []byte(collectionsRegistry + ".{")
+	var seekKey []byte
+	collections := []string{}
+	for {
+		entries, err := c.cli.Scan(context.TODO(), &schema.ScanRequest{
+			Prefix:  prefix,
+			SeekKey: seekKey,
+			Limit:   999,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not scan collections, %w", err)
+		}
+
+		for _, e := range entries.Entries {
+			collections = append(collections, string(e.Key[len(prefix):len(e.Key)-1]))
+			seekKey = e.Key
+		}
+
+		if len(entries.Entries) < 999 {
+			break
+		}
+	}
+
+	return collections, nil
+}
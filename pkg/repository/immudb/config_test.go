@@ -0,0 +1,34 @@
+package immudb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/codenotary/immudb/embedded/store"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsKeyNotFound(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	_, err := cli.Get(context.Background(), []byte("missing"))
+	if !isKeyNotFound(err) || !isKeyNotFound(fmt.Errorf("could not read, %w", err)) {
+		t.Fatalf("expected error of immudb server to be key not found, got %v", err)
+	}
+
+	for err, notFound := range map[error]bool{
+		store.ErrKeyNotFound:                                      true,
+		fmt.Errorf("wrapped, %w", store.ErrKeyNotFound):           true,
+		status.Error(codes.Unknown, store.ErrKeyNotFound.Error()): true,
+		errors.New("tbtree: key not found"):                       false,
+		status.Error(codes.Unknown, "index key not found in row"): false,
+		errors.New("other"):                                       false,
+	} {
+		if isKeyNotFound(err) != notFound {
+			t.Errorf("expected key not found of %v to be %t", err, notFound)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package immudb
+
+import (
+	"context"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+)
+
+// contextClient makes calls of immudb client with its context, in place of
+// the one passed by repository, so deadlines and cancellation of callers
+// reach immudb.
+type contextClient struct {
+	immudb.ImmuClient
+	ctx context.Context
+}
+
+// WithContext returns client, which makes calls used by repositories with
+// ctx.
+func WithContext(ctx context.Context, cli immudb.ImmuClient) immudb.ImmuClient {
+	if c, ok := cli.(*contextClient); ok {
+		cli = c.ImmuClient
+	}
+
+	return &contextClient{ImmuClient: cli, ctx: ctx}
+}
+
+// WithContext returns copy of repository, which calls immudb with ctx.
+func (jr *JsonKVRepository) WithContext(ctx context.Context) *JsonKVRepository {
+	r := *jr
+	r.client = WithContext(ctx, jr.client)
+	return &r
+}
+
+// WithContext returns copy of repository, which calls immudb with ctx.
+func (jr *JsonSQLRepository) WithContext(ctx context.Context) *JsonSQLRepository {
+	r := *jr
+	r.client = WithContext(ctx, jr.client)
+	return &r
+}
+
+func (c *contextClient) CurrentState(_ context.Context) (*schema.ImmutableState, error) {
+	return c.ImmuClient.CurrentState(c.ctx)
+}
+
+func (c *contextClient) Set(_ context.Context, key []byte, value []byte) (*schema.TxHeader, error) {
+	return c.ImmuClient.Set(c.ctx, key, value)
+}
+
+func (c *contextClient) SetAll(_ context.Context, req *schema.SetRequest) (*schema.TxHeader, error) {
+	return c.ImmuClient.SetAll(c.ctx, req)
+}
+
+func (c *contextClient) ExecAll(_ context.Context, req *schema.ExecAllRequest) (*schema.TxHeader, error) {
+	return c.ImmuClient.ExecAll(c.ctx, req)
+}
+
+func (c *contextClient) Delete(_ context.Context, req *schema.DeleteKeysRequest) (*schema.TxHeader, error) {
+	return c.ImmuClient.Delete(c.ctx, req)
+}
+
+func (c *contextClient) Get(_ context.Context, key []byte, opts ...immudb.GetOption) (*schema.Entry, error) {
+	return c.ImmuClient.Get(c.ctx, key, opts...)
+}
+
+func (c *contextClient) GetAt(_ context.Context, key []byte, tx uint64) (*schema.Entry, error) {
+	return c.ImmuClient.GetAt(c.ctx, key, tx)
+}
+
+func (c *contextClient) GetAtRevision(_ context.Context, key []byte, rev int64) (*schema.Entry, error) {
+	return c.ImmuClient.GetAtRevision(c.ctx, key, rev)
+}
+
+func (c *contextClient) VerifiedGetAt(_ context.Context, key []byte, tx uint64) (*schema.Entry, error) {
+	return c.ImmuClient.VerifiedGetAt(c.ctx, key, tx)
+}
+
+func (c *contextClient) History(_ context.Context, req *schema.HistoryRequest) (*schema.Entries, error) {
+	return c.ImmuClient.History(c.ctx, req)
+}
+
+func (c *contextClient) Scan(_ context.Context, req *schema.ScanRequest) (*schema.Entries, error) {
+	return c.ImmuClient.Scan(c.ctx, req)
+}
+
+func (c *contextClient) ZScan(_ context.Context, req *schema.ZScanRequest) (*schema.ZEntries, error) {
+	return c.ImmuClient.ZScan(c.ctx, req)
+}
+
+func (c *contextClient) TxByID(_ context.Context, tx uint64) (*schema.Tx, error) {
+	return c.ImmuClient.TxByID(c.ctx, tx)
+}
+
+func (c *contextClient) VerifiedTxByID(_ context.Context, tx uint64) (*schema.Tx, error) {
+	return c.ImmuClient.VerifiedTxByID(c.ctx, tx)
+}
+
+func (c *contextClient) TxScan(_ context.Context, req *schema.TxScanRequest) (*schema.TxList, error) {
+	return c.ImmuClient.TxScan(c.ctx, req)
+}
+
+func (c *contextClient) SQLExec(_ context.Context, sql string, params map[string]interface{}) (*schema.SQLExecResult, error) {
+	return c.ImmuClient.SQLExec(c.ctx, sql, params)
+}
+
+func (c *contextClient) SQLQuery(_ context.Context, sql string, params map[string]interface{}, renewSnapshot bool) (*schema.SQLQueryResult, error) {
+	return c.ImmuClient.SQLQuery(c.ctx, sql, params, renewSnapshot)
+}
+
+func (c *contextClient) VerifyRow(_ context.Context, row *schema.Row, table string, pkVals []*schema.SQLValue) error {
+	return c.ImmuClient.VerifyRow(c.ctx, row, table, pkVals)
+}
+
+func (c *contextClient) NewTx(_ context.Context) (immudb.Tx, error) {
+	tx, err := c.ImmuClient.NewTx(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &contextTx{Tx: tx, ctx: c.ctx}, nil
+}
+
+// contextTx makes statements and commit of transaction with its context.
+// Rollback keeps context of caller, so transaction is closed even after ctx
+// is cancelled.
+type contextTx struct {
+	immudb.Tx
+	ctx context.Context
+}
+
+func (t *contextTx) Commit(_ context.Context) (*schema.CommittedSQLTx, error) {
+	return t.Tx.Commit(t.ctx)
+}
+
+func (t *contextTx) SQLExec(_ context.Context, sql string, params map[string]interface{}) error {
+	return t.Tx.SQLExec(t.ctx, sql, params)
+}
+
+func (t *contextTx) SQLQuery(_ context.Context, sql string, params map[string]interface{}) (*schema.SQLQueryResult, error) {
+	return t.Tx.SQLQuery(t.ctx, sql, params)
+}
@@ -0,0 +1,321 @@
+package immudb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// Kinds of changes between two states of collection.
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// Change describes entry which differs between two states of collection.
+type Change struct {
+	Kind   string
+	Key    string          // primary key value, json array for composite SQL primary key
+	From   json.RawMessage `json:",omitempty"` // entry in the first state, empty if added
+	To     json.RawMessage `json:",omitempty"` // entry in the second state, empty if deleted
+	Fields []FieldChange   `json:",omitempty"` // changed fields of modified entry
+}
+
+// FieldChange describes single changed field of modified entry, with gjson
+// path of the field. Missing field has empty value.
+type FieldChange struct {
+	Path string
+	From json.RawMessage `json:",omitempty"`
+	To   json.RawMessage `json:",omitempty"`
+}
+
+// Diff streams changes of key-value collection entries between states at
+// fromTx and toTx. Zero fromTx is the empty state, zero toTx is the current
+// state. Only entries written within the range are compared, so it does not
+// scan the whole collection.
+func (jr *JsonKVRepository) Diff(fromTx uint64, toTx uint64, fn func(Change) error) error {
+	// the latest revision within range is the state at toTx, keys are kept
+	// in order of their first change
+	last := map[string]History{}
+	keys := []string{}
+	err := jr.HistoryByTx(fromTx+1, toTx, func(h History) error {
+		if _, ok := last[h.Key]; !ok {
+			keys = append(keys, h.Key)
+		}
+		last[h.Key] = h
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		var from []byte
+		if fromTx > 0 {
+			err = jr.KeyHistory(key, 0, fromTx, func(h History) error {
+				from = h.Entry
+				if h.Deleted {
+					from = nil
+				}
+
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("could not get history of %s, %w", key, err)
+			}
+		}
+
+		var to []byte
+		if !last[key].Deleted {
+			to = last[key].Entry
+		}
+
+		change, changed := diffEntries(key, from, to)
+		if !changed {
+			continue
+		}
+
+		err = fn(change)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sqlDiffEntry is row of SQL collection in the first state of diff.
+type sqlDiffEntry struct {
+	hash       [sha256.Size]byte
+	primaryKey []gjson.Result
+}
+
+// Diff streams changes of SQL collection rows between states at fromTx and
+// toTx. Zero fromTx is the empty state, zero toTx is the current state. Rows
+// of both states are scanned, with only hashes of the first state kept in
+// memory. Added and modified rows are streamed in primary key order, deleted
+// ones follow.
+func (jr *JsonSQLRepository) Diff(fromTx uint64, toTx uint64, fn func(Change) error) error {
+	fromRows := map[string]sqlDiffEntry{}
+	if fromTx > 0 {
+		_, err := jr.selectPaged(jr.collection+" UNTIL TX @fromTx", "", map[string]interface{}{"fromTx": fromTx}, ReadOptions{}, func(object []byte) error {
+			key, pk := jr.primaryKeyOf(object)
+			fromRows[key] = sqlDiffEntry{hash: sha256.Sum256(object), primaryKey: pk}
+
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not read rows at transaction %d, %w", fromTx, err)
+		}
+	}
+
+	source, params := jr.collection, map[string]interface{}{}
+	if toTx > 0 {
+		source, params = jr.collection+" UNTIL TX @toTx", map[string]interface{}{"toTx": toTx}
+	}
+
+	_, err := jr.selectPaged(source, "", params, ReadOptions{}, func(object []byte) error {
+		key, _ := jr.primaryKeyOf(object)
+		entry, ok := fromRows[key]
+		delete(fromRows, key)
+		if ok && entry.hash == sha256.Sum256(object) {
+			return nil
+		}
+
+		var from []byte
+		if ok {
+			var err error
+			from, err = jr.rowAt(entry.primaryKey, fromTx)
+			if err != nil {
+				return err
+			}
+		}
+
+		change, changed := diffEntries(key, from, object)
+		if !changed {
+			return nil
+		}
+
+		return fn(change)
+	})
+	if err != nil {
+		return fmt.Errorf("could not read rows, %w", err)
+	}
+
+	deleted := make([]string, 0, len(fromRows))
+	for key := range fromRows {
+		deleted = append(deleted, key)
+	}
+	sort.Strings(deleted)
+
+	for _, key := range deleted {
+		from, err := jr.rowAt(fromRows[key].primaryKey, fromTx)
+		if err != nil {
+			return err
+		}
+
+		err = fn(Change{Kind: ChangeDeleted, Key: key, From: from})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PrimaryKey returns primary key value of stored object, in format of
+// PrimaryKeyFilters.
+func (jr *JsonSQLRepository) PrimaryKey(object []byte) string {
+	key, _ := jr.primaryKeyOf(object)
+	return key
+}
+
+// primaryKeyOf returns primary key of stored object, as value for single
+// column primary key, or json array of values for composite one.
+func (jr *JsonSQLRepository) primaryKeyOf(object []byte) (string, []gjson.Result) {
+	gjsonObject := gjson.ParseBytes(object)
+	pk := make([]gjson.Result, len(jr.primaryKey))
+	raw := make([]string, len(jr.primaryKey))
+	for i, c := range jr.primaryKey {
+		pk[i] = gjsonObject.Get(c.name)
+		raw[i] = pk[i].Raw
+	}
+
+	if len(pk) == 1 {
+		return pk[0].String(), pk
+	}
+
+	return "[" + strings.Join(raw, ",") + "]", pk
+}
+
+// primaryKeyCondition builds condition matching row with primary key, with
+// parameters prefixed by prefix.
+func (jr *JsonSQLRepository) primaryKeyCondition(primaryKey []gjson.Result, prefix string, params map[string]interface{}) (string, error) {
+	conditions := []string{}
+	for i, c := range jr.primaryKey {
+		v, err := c.value(primaryKey[i])
+		if err != nil {
+			return "", err
+		}
+
+		name := fmt.Sprintf("%s%d", prefix, i)
+		params[name] = v
+		conditions = append(conditions, fmt.Sprintf("\"%s\" = @%s", c.name, name))
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+// rowAt reads object with primary key from collection state at tx.
+func (jr *JsonSQLRepository) rowAt(primaryKey []gjson.Result, tx uint64) ([]byte, error) {
+	params := map[string]interface{}{"tx": tx}
+	condition, err := jr.primaryKeyCondition(primaryKey, "pk", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var object []byte
+	_, err = jr.selectPaged(jr.collection+" UNTIL TX @tx", condition, params, ReadOptions{Limit: 1}, func(o []byte) error {
+		object = o
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not read row at transaction %d, %w", tx, err)
+	}
+
+	return object, nil
+}
+
+// diffEntries compares two states of entry, where nil means missing entry.
+// It returns false if entry did not change.
+func diffEntries(key string, from []byte, to []byte) (Change, bool) {
+	switch {
+	case from == nil && to == nil:
+		return Change{}, false
+	case from == nil:
+		return Change{Kind: ChangeAdded, Key: key, To: to}, true
+	case to == nil:
+		return Change{Kind: ChangeDeleted, Key: key, From: from}, true
+	case bytes.Equal(from, to):
+		return Change{}, false
+	}
+
+	fields := []FieldChange{}
+	diffFields("", gjson.ParseBytes(from), gjson.ParseBytes(to), &fields)
+	if len(fields) == 0 {
+		// entries differ by formatting only
+		return Change{}, false
+	}
+
+	return Change{Kind: ChangeModified, Key: key, From: from, To: to, Fields: fields}, true
+}
+
+// diffFields collects changed fields of json values, descending into nested
+// objects. Arrays are compared as a whole.
+func diffFields(path string, from gjson.Result, to gjson.Result, fields *[]FieldChange) {
+	if !from.IsObject() || !to.IsObject() {
+		if compactJSON(from.Raw) != compactJSON(to.Raw) {
+			*fields = append(*fields, FieldChange{Path: path, From: rawMessage(from.Raw), To: rawMessage(to.Raw)})
+		}
+
+		return
+	}
+
+	fromFields, toFields := from.Map(), to.Map()
+	names := []string{}
+	for name := range fromFields {
+		names = append(names, name)
+	}
+	for name := range toFields {
+		if _, ok := fromFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fieldPath := escapePath(name)
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+
+		diffFields(fieldPath, fromFields[name], toFields[name], fields)
+	}
+}
+
+func compactJSON(raw string) string {
+	b := bytes.Buffer{}
+	if json.Compact(&b, []byte(raw)) != nil {
+		return raw
+	}
+
+	return b.String()
+}
+
+func rawMessage(raw string) json.RawMessage {
+	if raw == "" {
+		return nil
+	}
+
+	return json.RawMessage(raw)
+}
+
+// escapePath escapes characters with special meaning in gjson paths.
+func escapePath(name string) string {
+	sb := strings.Builder{}
+	for _, r := range name {
+		if strings.ContainsRune(`.*?|#@\`, r) {
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,103 @@
+package immudb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+func TestDiff(t *testing.T) {
+	for _, typ := range []string{"kv", "sql"} {
+		t.Run(typ, func(t *testing.T) {
+			cli := immudbtest.NewT(t).Client(t)
+			cfg := Config{Type: "kv", Indexes: []string{"id"}}
+			var pk []string
+			if typ == "sql" {
+				cfg = Config{Type: "sql", Indexes: []string{"id=VARCHAR[16]", "v=INTEGER"}, MissingFields: MissingFieldsError}
+				pk = []string{"id"}
+			}
+
+			err := CreateCollection(cli, "diff", cfg, pk, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var repo interface {
+				WriteBytes([]byte) (uint64, error)
+				Diff(fromTx uint64, toTx uint64, fn func(Change) error) error
+				Drop() error
+			}
+			if typ == "sql" {
+				repo, err = NewJsonSQLRepository(cli, "diff")
+			} else {
+				repo, err = NewJsonKVRepository(cli, "diff")
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			txs := []uint64{}
+			for _, object := range []string{`{"id":"1","v":1}`, `{"id":"2","v":1}`, `{"id":"1","v":2}`} {
+				tx, err := repo.WriteBytes([]byte(object))
+				if err != nil {
+					t.Fatal(err)
+				}
+				txs = append(txs, tx)
+			}
+
+			err = repo.Drop()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state, err := cli.CurrentState(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			dropTx := state.TxId
+
+			// states at both transactions include their writes, so only
+			// writes after fromTx up to toTx are changes
+			tests := []struct {
+				fromTx   uint64
+				toTx     uint64
+				expected []string
+			}{
+				{fromTx: 0, toTx: txs[0], expected: []string{"added 1"}},
+				{fromTx: txs[0], toTx: txs[0], expected: []string{}},
+				{fromTx: txs[0], toTx: txs[1], expected: []string{"added 2"}},
+				{fromTx: txs[1], toTx: txs[2], expected: []string{"modified 1 v"}},
+				{fromTx: txs[0], toTx: txs[2], expected: []string{"added 2", "modified 1 v"}},
+				{fromTx: 0, toTx: txs[2], expected: []string{"added 1", "added 2"}},
+				{fromTx: txs[2], toTx: dropTx, expected: []string{"deleted 1", "deleted 2"}},
+				{fromTx: txs[1], toTx: 0, expected: []string{"deleted 1", "deleted 2"}},
+				{fromTx: 0, toTx: 0, expected: []string{}},
+			}
+
+			for _, tt := range tests {
+				changes := []string{}
+				err = repo.Diff(tt.fromTx, tt.toTx, func(c Change) error {
+					change := fmt.Sprintf("%s %s", c.Kind, c.Key)
+					for _, f := range c.Fields {
+						change += " " + f.Path
+					}
+
+					changes = append(changes, change)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				sort.Strings(changes)
+				if !reflect.DeepEqual(changes, tt.expected) {
+					t.Errorf("expected %v from %d to %d, got %v", tt.expected, tt.fromTx, tt.toTx, changes)
+				}
+			}
+		})
+	}
+}
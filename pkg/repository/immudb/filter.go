@@ -0,0 +1,209 @@
+package immudb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Filter is a single condition on collection field, e.g. field>=100.
+type Filter struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// operators supported by filters, with SQL counterparts. Order matters for
+// parsing, as longer operators need to be matched first.
+var filterOperators = []struct {
+	operator string
+	sql      string
+}{
+	{operator: "!=", sql: "!="},
+	{operator: ">=", sql: ">="},
+	{operator: "<=", sql: "<="},
+	{operator: "=", sql: "="},
+	{operator: ">", sql: ">"},
+	{operator: "<", sql: "<"},
+	{operator: "~", sql: "LIKE"},
+}
+
+// ErrInvalidQuery is matched by errors of reads caused by the query itself,
+// e.g. unknown field, invalid filter value or cursor, rather than by immudb.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// queryError is error of invalid query, keeping message of its cause.
+type queryError struct {
+	err error
+}
+
+func invalidQuery(err error) error {
+	return &queryError{err: err}
+}
+
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+func (e *queryError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
+
+var identifierRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseFilter parses filter in format <field><operator><value>, where operator
+// is one of =, !=, >, >=, <, <= or ~ (LIKE, matching value as regexp).
+func ParseFilter(s string) (Filter, error) {
+	pos := strings.IndexAny(s, "!=<>~")
+	if pos <= 0 {
+		return Filter{}, invalidQuery(fmt.Errorf("invalid filter %s, expected <field><operator><value>", s))
+	}
+
+	for _, op := range filterOperators {
+		if strings.HasPrefix(s[pos:], op.operator) {
+			return Filter{
+				Field:    strings.TrimSpace(s[:pos]),
+				Operator: op.operator,
+				Value:    s[pos+len(op.operator):],
+			}, nil
+		}
+	}
+
+	return Filter{}, invalidQuery(fmt.Errorf("invalid filter operator in %s", s))
+}
+
+// ValidateIdentifier checks if name can be safely used as SQL table or column
+// name.
+func ValidateIdentifier(name string) error {
+	if !identifierRegexp.MatchString(name) {
+		return fmt.Errorf("invalid name %s, only letters, digits and underscores are allowed", name)
+	}
+
+	return nil
+}
+
+// compileFilters compiles filters into parameterized SQL condition. Filter
+// fields are validated against collection columns and values are converted to
+// column types, so no user input is ever part of SQL statement itself.
+func compileFilters(filters []Filter, columns []column, params map[string]interface{}) (string, error) {
+	conditions := []string{}
+	for i, f := range filters {
+		c, err := findColumn(columns, f.Field)
+		if err != nil {
+			return "", invalidQuery(err)
+		}
+
+		sqlOperator := ""
+		for _, op := range filterOperators {
+			if op.operator == f.Operator {
+				sqlOperator = op.sql
+			}
+		}
+		if sqlOperator == "" {
+			return "", invalidQuery(fmt.Errorf("unsupported filter operator %s", f.Operator))
+		}
+
+		if sqlOperator == "LIKE" && c.baseType() != "VARCHAR" {
+			return "", invalidQuery(fmt.Errorf("operator %s is supported only for VARCHAR columns", f.Operator))
+		}
+
+		value, err := filterValue(c, f.Value)
+		if err != nil {
+			return "", invalidQuery(err)
+		}
+
+		param := fmt.Sprintf("f%d", i)
+		params[param] = value
+		conditions = append(conditions, fmt.Sprintf("\"%s\" %s @%s", c.name, sqlOperator, param))
+	}
+
+	return strings.Join(conditions, " AND "), nil
+}
+
+func findColumn(columns []column, name string) (column, error) {
+	for _, c := range columns {
+		if strings.EqualFold(c.name, name) {
+			return c, nil
+		}
+	}
+
+	return column{}, fmt.Errorf("field %s is not a collection column", name)
+}
+
+func filterValue(c column, value string) (interface{}, error) {
+	switch c.baseType() {
+	case "INTEGER":
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid INTEGER value for %s, %w", c.name, err)
+		}
+		return v, nil
+	case "FLOAT":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FLOAT value for %s, %w", c.name, err)
+		}
+		return c.scaled(v)
+	case "BOOLEAN":
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BOOLEAN value for %s, %w", c.name, err)
+		}
+		return v, nil
+	case "TIMESTAMP":
+		v, err := ParseTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIMESTAMP value for %s, %w", c.name, err)
+		}
+		return v, nil
+	case "UUID":
+		v, err := uuid.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UUID value for %s, %w", c.name, err)
+		}
+		return v.String(), nil
+	case "VARCHAR":
+		return value, nil
+	case "BLOB":
+		return []byte(value), nil
+	case "JSON":
+		// value which is not json, e.g. default "none", is stored as json
+		// string
+		if json.Valid([]byte(value)) {
+			return []byte(value), nil
+		}
+		return json.Marshal(value)
+	}
+
+	return nil, fmt.Errorf("filters are not supported for %s columns", c.cType)
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses time in RFC3339 or "2006-01-02 15:04:05" format. Times
+// without zone are considered UTC.
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("unsupported time format, expected RFC3339 or 2006-01-02 15:04:05")
+}
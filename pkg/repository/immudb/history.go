@@ -0,0 +1,291 @@
+package immudb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// HistoryByIndex streams full histories of objects matching indexed key and
+// value prefix by their current value, within transaction range. Zero bound
+// leaves the range open. History of every object is returned once, while
+// index is scanned.
+func (jr *JsonKVRepository) HistoryByIndex(key string, prefix string, sinceTx uint64, untilTx uint64, fn func(History) error) error {
+	_, err := jr.Read(key, prefix, ReadOptions{current: true}, func(object []byte) error {
+		pk, err := jr.primaryKeyValue(gjson.ParseBytes(object))
+		if err != nil {
+			return err
+		}
+
+		err = jr.KeyHistory(pk, sinceTx, untilTx, fn)
+		if err != nil {
+			return fmt.Errorf("could not get history of %s, %w", pk, err)
+		}
+
+		return nil
+	})
+
+	return err
+}
+
+// HistoryByTx streams revisions of all objects written within transaction
+// range, in transaction order. Zero until means up to the current state.
+func (jr *JsonKVRepository) HistoryByTx(sinceTx uint64, untilTx uint64, fn func(History) error) error {
+	if untilTx == 0 {
+		state, err := jr.client.CurrentState(context.TODO())
+		if err != nil {
+			return fmt.Errorf("could not get current state, %w", err)
+		}
+		untilTx = state.TxId
+	}
+
+	if sinceTx == 0 {
+		sinceTx = 1
+	}
+
+	prefix := []byte(fmt.Sprintf("%s.payload.%s.{", jr.collection, jr.indexedKeys[0]))
+	revisions := map[string]uint64{}
+	for initialTx := sinceTx; initialTx <= untilTx; {
+		limit := uint64(999)
+		if untilTx-initialTx+1 < limit {
+			limit = untilTx - initialTx + 1
+		}
+
+		txs, err := jr.client.TxScan(context.TODO(), &schema.TxScanRequest{
+			InitialTx: initialTx,
+			Limit:     uint32(limit),
+			EntriesSpec: &schema.EntriesSpec{
+				KvEntriesSpec: &schema.EntryTypeSpec{Action: schema.EntryTypeAction_RAW_VALUE},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not scan transactions, %w", err)
+		}
+
+		for _, tx := range txs.Txs {
+			for _, e := range tx.Entries {
+				// raw keys and values are prefixed with their kind, plain
+				// key-values have zero prefix
+				deleted := e.Metadata.GetDeleted()
+				if len(e.Key) == 0 || e.Key[0] != 0 || (!deleted && (len(e.Value) == 0 || e.Value[0] != 0)) {
+					continue
+				}
+
+				key := e.Key[1:]
+				if !bytes.HasPrefix(key, prefix) {
+					continue
+				}
+
+				h := History{
+					Key:     string(key[len(prefix) : len(key)-1]),
+					TxID:    tx.Header.Id,
+					Deleted: deleted,
+				}
+				if !deleted {
+					h.Entry = e.Value[1:]
+				}
+
+				// transaction entries do not carry revisions, so they are
+				// counted from key history once, and incremented afterwards
+				revision, ok := revisions[h.Key]
+				if !ok {
+					revision, err = jr.revisionAt(key, tx.Header.Id)
+					if err != nil {
+						return fmt.Errorf("could not get revision of %s, %w", h.Key, err)
+					}
+				} else {
+					revision++
+				}
+				revisions[h.Key] = revision
+				h.Revision = revision
+
+				err = fn(h)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if uint64(len(txs.Txs)) < limit {
+			break
+		}
+		initialTx += limit
+	}
+
+	return nil
+}
+
+// revisionAt returns revision of key written in transaction. Revisions are
+// ordered by transactions, so it is searched for by bisecting key history,
+// instead of reading all of it.
+func (jr *JsonKVRepository) revisionAt(key []byte, txID uint64) (uint64, error) {
+	revisionOf := func(offset uint64, desc bool) (*schema.Entry, error) {
+		entries, err := jr.client.History(context.TODO(), &schema.HistoryRequest{
+			Key:    key,
+			Offset: offset,
+			Limit:  1,
+			Desc:   desc,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries.Entries) == 0 {
+			return nil, fmt.Errorf("no revision at offset %d", offset)
+		}
+
+		return entries.Entries[0], nil
+	}
+
+	last, err := revisionOf(0, true)
+	if err != nil {
+		return 0, err
+	}
+
+	low, high := uint64(1), last.Revision
+	for low <= high {
+		middle := low + (high-low)/2
+		e, err := revisionOf(middle-1, false)
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case e.Tx == txID:
+			return e.Revision, nil
+		case e.Tx < txID:
+			low = middle + 1
+		default:
+			high = middle - 1
+		}
+	}
+
+	return 0, fmt.Errorf("no revision in transaction %d", txID)
+}
+
+// VerifyHistory verifies revision of object with inclusion proof of its
+// payload in transaction, and consistency proof of the transaction with
+// immudb state.
+func (jr *JsonKVRepository) VerifyHistory(h History) error {
+	key := []byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], h.Key))
+	if h.Deleted {
+		return jr.verifyDeletion(key, h.TxID)
+	}
+
+	e, err := jr.client.VerifiedGetAt(context.TODO(), key, h.TxID)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(e.Value, h.Entry) {
+		return fmt.Errorf("revision %d of %s differs from verified value", h.Revision, h.Key)
+	}
+
+	return nil
+}
+
+// verifyDeletion verifies transaction with consistency proof, and checks it
+// deletes key, as deleted keys cannot be read with inclusion proof.
+func (jr *JsonKVRepository) verifyDeletion(key []byte, txID uint64) error {
+	tx, err := jr.client.VerifiedTxByID(context.TODO(), txID)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range tx.Entries {
+		if bytes.Equal(e.Key, key) && e.Metadata.GetDeleted() {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("transaction %d does not delete %s", txID, key)
+}
+
+// PrimaryKeyFilters returns filters matching row with primary key value, in
+// format of change and tombstone keys: value of single column primary key,
+// or json array of values of composite one.
+func (jr *JsonSQLRepository) PrimaryKeyFilters(key string) ([]Filter, error) {
+	if len(jr.primaryKey) == 1 {
+		return []Filter{{Field: jr.primaryKey[0].name, Operator: "=", Value: key}}, nil
+	}
+
+	values := gjson.Parse(key)
+	if !values.IsArray() || len(values.Array()) != len(jr.primaryKey) {
+		return nil, fmt.Errorf("invalid primary key %s, expected json array of %d values", key, len(jr.primaryKey))
+	}
+
+	filters := []Filter{}
+	for i, v := range values.Array() {
+		filters = append(filters, Filter{Field: jr.primaryKey[i].name, Operator: "=", Value: v.String()})
+	}
+
+	return filters, nil
+}
+
+// VerifyRow reads current row with primary key value, as for
+// PrimaryKeyFilters, and verifies it with inclusion proof in its transaction
+// and consistency proof of the transaction with immudb state. It returns
+// stored object, or nil if there is no such row.
+func (jr *JsonSQLRepository) VerifyRow(key string) ([]byte, error) {
+	filters, err := jr.PrimaryKeyFilters(key)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]interface{}{}
+	condition, err := compileFilters(filters, jr.columns, params)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := jr.client.SQLQuery(context.TODO(), fmt.Sprintf("SELECT * FROM %s WHERE %s;", jr.collection, condition), params, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not read row, %w", err)
+	}
+
+	if len(res.Rows) == 0 {
+		return nil, nil
+	}
+
+	// columns are named as selectors, e.g. (defaultdb.collection.id)
+	row := &schema.Row{Values: res.Rows[0].Values}
+	valueOf := map[string]*schema.SQLValue{}
+	for i, c := range res.Columns {
+		row.Columns = append(row.Columns, c.Name)
+		name := strings.TrimSuffix(c.Name[strings.LastIndex(c.Name, ".")+1:], ")")
+		valueOf[name] = row.Values[i]
+	}
+
+	pkValues := []*schema.SQLValue{}
+	for _, c := range jr.primaryKey {
+		pkValues = append(pkValues, valueOf[c.name])
+	}
+
+	err = jr.client.VerifyRow(context.TODO(), row, jr.collection, pkValues)
+	if err != nil {
+		return nil, err
+	}
+
+	return valueOf["__value__"].GetBs(), nil
+}
+
+// EntryJSON returns stored entry as json value, entries which are not valid
+// json are encoded as strings, and nil ones, e.g. deleted, as null.
+func EntryJSON(entry []byte) json.RawMessage {
+	if entry == nil {
+		return json.RawMessage("null")
+	}
+
+	if json.Valid(entry) {
+		return entry
+	}
+
+	b, _ := json.Marshal(string(entry))
+	return b
+}
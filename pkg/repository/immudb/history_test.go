@@ -0,0 +1,109 @@
+package immudb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+func newHistoryRepository(t *testing.T) *JsonKVRepository {
+	t.Helper()
+
+	cli := immudbtest.NewT(t).Client(t)
+	err := CreateCollection(cli, "history", Config{Type: "kv", Indexes: []string{"id", "user"}}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonKVRepository(cli, "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return jr
+}
+
+func TestHistoryByIndex(t *testing.T) {
+	jr := newHistoryRepository(t)
+
+	// links of previous values remain, objects match by current value only
+	for _, object := range []string{
+		`{"id":"1","user":"alice"}`,
+		`{"id":"1","user":"alina"}`,
+		`{"id":"2","user":"bob"}`,
+		`{"id":"2","user":"alex"}`,
+		`{"id":"3","user":"albert"}`,
+		`{"id":"3","user":"carl"}`,
+	} {
+		_, err := jr.WriteBytes([]byte(object))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type revision struct {
+		Key      string
+		Revision uint64
+	}
+
+	revisions := []revision{}
+	err := jr.HistoryByIndex("user", "al", 0, 0, func(h History) error {
+		revisions = append(revisions, revision{Key: h.Key, Revision: h.Revision})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []revision{{"2", 1}, {"2", 2}, {"1", 1}, {"1", 2}}
+	if !reflect.DeepEqual(revisions, expected) {
+		t.Fatalf("expected histories %v, got %v", expected, revisions)
+	}
+}
+
+func TestHistoryByTxRevisions(t *testing.T) {
+	jr := newHistoryRepository(t)
+	txs := []uint64{}
+	for _, user := range []string{"a", "b", "c", "", "d"} {
+		object := []byte(`{"id":"1","user":"` + user + `"}`)
+		if user == "" {
+			ops, err := jr.deleteOps("1", []byte(`{"id":"1","user":"c"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			txh, err := jr.client.ExecAll(context.Background(), &schema.ExecAllRequest{Operations: ops})
+			if err != nil {
+				t.Fatal(err)
+			}
+			txs = append(txs, txh.Id)
+			continue
+		}
+
+		tx, err := jr.WriteBytes(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+
+	// revisions of the first transaction in range are resolved from history,
+	// deletions are revisions too
+	for since, expected := range map[int][]uint64{0: {1, 2, 3, 4, 5}, 2: {3, 4, 5}, 3: {4, 5}, 4: {5}} {
+		revisions := []uint64{}
+		err := jr.HistoryByTx(txs[since], 0, func(h History) error {
+			revisions = append(revisions, h.Revision)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(revisions, expected) {
+			t.Errorf("expected revisions %v since write %d, got %v", expected, since+1, revisions)
+		}
+	}
+}
@@ -1,23 +1,34 @@
 package immudb
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/codenotary/immudb/pkg/api/schema"
 	immudb "github.com/codenotary/immudb/pkg/client"
 	"github.com/tidwall/gjson"
+	"github.com/tomekkolo/immudb-play/pkg/metrics"
 )
 
+// ingestedIndex is the name of index of ingestion time, maintained for all
+// key-value collections.
+const ingestedIndex = "_ingested"
+
 type JsonKVRepository struct {
 	client      immudb.ImmuClient
 	collection  string
 	indexedKeys []string // first key is considered primary key
+	cfg         *Config
 }
 
 func NewJsonKVRepository(cli immudb.ImmuClient, collection string) (*JsonKVRepository, error) {
@@ -31,12 +42,17 @@ func NewJsonKVRepository(cli immudb.ImmuClient, collection string) (*JsonKVRepos
 		return nil, fmt.Errorf("collection is missing definition, %w", err)
 	}
 
+	if cfg.Dropped {
+		return nil, errors.New("collection was dropped")
+	}
+
 	log.WithField("indexes", cfg.Indexes).Info("Indexes from immudb")
 
 	return &JsonKVRepository{
 		client:      cli,
 		collection:  collection,
 		indexedKeys: cfg.Indexes,
+		cfg:         cfg,
 	}, nil
 }
 
@@ -73,66 +89,293 @@ func (jr *JsonKVRepository) Write(jObject interface{}) (uint64, error) {
 // Primary index: <collection>.<primary field name>.{<primary field value as text>}
 // Additional indexes: <collection>.<indexed field name>.{<indexed field value as text>}.{<primary field value as text>}
 // Original json as bytes: <collection>.payload.<primary field name>.{<primary field value as text>}
+// Ingestion index: <collection>._ingested.{<ingestion unix nanoseconds>}.{<primary field value as text>}
+//
+// Ingestion index entries are references bound to the payload version
+// written. With KVLayoutLinks, other indexes values contain the name of
+// payload key. With KVLayoutRefs, primary index is an immudb reference to
+// payload key, and additional indexes are sorted sets of payload keys:
 //
-// Indexes values contain the name of payload key
+// Scored indexes: <collection>.<indexed field name>, scored by field value
+// Other indexes: <collection>.<indexed field name>.{<indexed field value as text>}
 
 func (jr *JsonKVRepository) WriteBytes(jBytes []byte) (uint64, error) {
+	immudbObjectRequest, payloadKey, pk, err := jr.writeRequest(jBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	defer metrics.ObserveWrite(jr.collection, "kv", time.Now())
+
+	// existing entries are detected by immudb, so they cannot be replaced
+	// between check and write
+	if jr.cfg.Overwrite == OverwriteWarn || jr.cfg.Overwrite == OverwriteReject {
+		immudbObjectRequest.Preconditions = []*schema.Precondition{schema.PreconditionKeyMustNotExist(payloadKey)}
+	}
+
+	txh, err := jr.client.ExecAll(context.TODO(), immudbObjectRequest)
+	if err != nil && isPreconditionFailed(err) {
+		if jr.cfg.Overwrite == OverwriteReject {
+			return 0, fmt.Errorf("%w, primary key %s", ErrOverwriteRejected, pk)
+		}
+
+		log.WithField("collection", jr.collection).WithField("key", pk).Warn("Overwriting existing entry")
+		immudbObjectRequest.Preconditions = nil
+		txh, err = jr.client.ExecAll(context.TODO(), immudbObjectRequest)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not store object: %w", err)
+	}
+
+	log.WithField("txID", txh.Id).Trace("Wrote entry")
+
+	return txh.Id, nil
+}
+
+// Stored tells whether object is the current version of its entry, and
+// returns transaction it was written in, e.g. to check if write which failed
+// with lost connection was committed.
+func (jr *JsonKVRepository) Stored(jBytes []byte) (uint64, bool, error) {
+	_, payloadKey, _, err := jr.writeRequest(jBytes)
+	if err != nil {
+		return 0, false, err
+	}
+
+	e, err := jr.client.Get(context.TODO(), payloadKey)
+	if err != nil {
+		if isKeyNotFound(err) {
+			return 0, false, nil
+		}
+
+		return 0, false, fmt.Errorf("could not read object, %w", err)
+	}
+
+	if !bytes.Equal(e.Value, jBytes) {
+		return 0, false, nil
+	}
+
+	return e.Tx, true, nil
+}
+
+// WriteBytesBatch writes objects in single transaction, and returns its id
+// for each of them. With overwrite policy other than allow, or primary key
+// repeated in batch, objects are written one by one, as failed precondition
+// does not tell which object already existed. Then objects rejected by
+// overwrite policy get 0 transaction id.
+func (jr *JsonKVRepository) WriteBytesBatch(objects [][]byte) ([]uint64, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	batch := &schema.ExecAllRequest{}
+	payloadKeys := map[string]bool{}
+	for _, o := range objects {
+		req, payloadKey, _, err := jr.writeRequest(o)
+		if err != nil {
+			return nil, err
+		}
+
+		if payloadKeys[string(payloadKey)] {
+			batch = nil
+			break
+		}
+
+		payloadKeys[string(payloadKey)] = true
+		batch.Operations = append(batch.Operations, req.Operations...)
+	}
+
+	metrics.ObserveBatch(jr.collection, "kv", len(objects))
+	if batch == nil || jr.cfg.Overwrite == OverwriteWarn || jr.cfg.Overwrite == OverwriteReject {
+		return writeOneByOne(jr, objects)
+	}
+
+	start := time.Now()
+	txh, err := jr.client.ExecAll(context.TODO(), batch)
+	metrics.ObserveWrite(jr.collection, "kv", start)
+	if err != nil {
+		return nil, fmt.Errorf("could not store objects: %w", err)
+	}
+
+	log.WithField("txID", txh.Id).WithField("entries", len(objects)).Trace("Wrote batch")
+
+	txIDs := make([]uint64, len(objects))
+	for i := range txIDs {
+		txIDs[i] = txh.Id
+	}
+
+	return txIDs, nil
+}
+
+// writeOneByOne writes objects in separate transactions, skipping ones
+// rejected by overwrite policy.
+func writeOneByOne(w interface{ WriteBytes([]byte) (uint64, error) }, objects [][]byte) ([]uint64, error) {
+	txIDs := make([]uint64, len(objects))
+	for i, o := range objects {
+		txID, err := w.WriteBytes(o)
+		if err != nil && !errors.Is(err, ErrOverwriteRejected) {
+			return txIDs[:i], fmt.Errorf("could not write object %d of batch, %w", i+1, err)
+		}
+
+		txIDs[i] = txID
+	}
+
+	return txIDs, nil
+}
+
+// writeRequest builds operations storing json object with its indexes, and
+// returns them with payload key and primary key value of object.
+func (jr *JsonKVRepository) writeRequest(jBytes []byte) (*schema.ExecAllRequest, []byte, string, error) {
 	if len(jr.indexedKeys) == 0 {
-		return 0, errors.New("primary key is mandataory")
+		return nil, nil, "", errors.New("primary key is mandataory")
 	}
 
 	// parse with gjson
 	gjsonObject := gjson.ParseBytes(jBytes)
+	pk, err := jr.primaryKeyValue(gjsonObject)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	payloadKey := []byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], pk))
+	primaryKey := []byte(fmt.Sprintf("%s.%s.{%s}", jr.collection, jr.indexedKeys[0], pk))
+	immudbObjectRequest := &schema.ExecAllRequest{
+		Operations: []*schema.Op{
+			{ // create payload entry
+				Operation: &schema.Op_Kv{Kv: &schema.KeyValue{Key: payloadKey, Value: jBytes}},
+			},
+		},
+	}
+
+	if jr.cfg.Layout == KVLayoutRefs {
+		immudbObjectRequest.Operations = append(immudbObjectRequest.Operations, &schema.Op{ // create primary key reference
+			Operation: &schema.Op_Ref{Ref: &schema.ReferenceRequest{Key: primaryKey, ReferencedKey: payloadKey}},
+		})
+	} else {
+		immudbObjectRequest.Operations = append(immudbObjectRequest.Operations, &schema.Op{ // crete primary key index
+			Operation: &schema.Op_Kv{Kv: &schema.KeyValue{Key: primaryKey, Value: payloadKey}}, //value is link to payload
+		})
+	}
+
+	// ingestion index, bound to the version of payload written
+	immudbObjectRequest.Operations = append(immudbObjectRequest.Operations, &schema.Op{
+		Operation: &schema.Op_Ref{Ref: &schema.ReferenceRequest{
+			Key:           []byte(fmt.Sprintf("%s.%s.{%019d}.{%s}", jr.collection, ingestedIndex, time.Now().UnixNano(), pk)),
+			ReferencedKey: payloadKey,
+			BoundRef:      true,
+		}},
+	})
+
+	for i := 1; i < len(jr.indexedKeys); i++ {
+		op, err := jr.secondaryIndex(jr.indexedKeys[i], gjsonObject, pk)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		if op != nil {
+			immudbObjectRequest.Operations = append(immudbObjectRequest.Operations, op)
+		}
+	}
+
+	return immudbObjectRequest, payloadKey, pk, nil
+}
 
-	// resolve primary key, format "key1+key2+..."
+// primaryKeyValue resolves primary key value of object, primary key has
+// format "key1+key2+..."
+func (jr *JsonKVRepository) primaryKeyValue(gjsonObject gjson.Result) (string, error) {
 	var pk string
 	for _, pkPart := range strings.Split(jr.indexedKeys[0], "+") {
 		gjPK := gjsonObject.Get(pkPart)
 		if !gjPK.Exists() {
-			return 0, fmt.Errorf("missing primary key in json, %s", pkPart)
+			return "", fmt.Errorf("missing primary key in json, %s", pkPart)
 		}
 		pk += gjPK.String()
 	}
 
-	immudbObjectRequest := &schema.SetRequest{
-		KVs: []*schema.KeyValue{
-			{ // crete primary key index
-				Key:   []byte(fmt.Sprintf("%s.%s.{%s}", jr.collection, jr.indexedKeys[0], pk)),
-				Value: []byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], pk)), //value is link to payload
-			},
-			{ // create payload entry
-				Key:   []byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], pk)),
-				Value: jBytes,
-			},
-		},
+	return pk, nil
+}
+
+// secondaryIndex creates secondary index operation for field, or nil if the
+// field is missing and optional.
+func (jr *JsonKVRepository) secondaryIndex(field string, gjsonObject gjson.Result, pk string) (*schema.Op, error) {
+	// null is missing, as for SQL collections
+	gjSK := gjsonObject.Get(field)
+	if !gjSK.Exists() || gjSK.Type == gjson.Null {
+		policy := jr.cfg.Policy(field)
+		if policy.Mode == IndexOptional {
+			return nil, nil
+		} else if policy.Mode == IndexDefault {
+			gjSK = gjson.Result{Type: gjson.String, Str: policy.Default}
+		} else {
+			return nil, fmt.Errorf("missing secondary key in json, %s", field)
+		}
 	}
 
-	for i := 1; i < len(jr.indexedKeys); i++ {
-		gjSK := gjsonObject.Get(jr.indexedKeys[i])
-		if !gjSK.Exists() {
-			return 0, errors.New("missing secondary key in json")
+	payloadKey := []byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], pk))
+	if jr.cfg.Layout == KVLayoutRefs {
+		if jr.cfg.IsScored(field) {
+			score, err := scoreOf(gjSK)
+			if err != nil {
+				return nil, fmt.Errorf("invalid score of %s, %w", field, err)
+			}
+
+			return &schema.Op{ // add payload key to <collection>.<SKName> scored by SKVALUE
+				Operation: &schema.Op_ZAdd{ZAdd: &schema.ZAddRequest{Set: []byte(fmt.Sprintf("%s.%s", jr.collection, field)), Score: score, Key: payloadKey}},
+			}, nil
 		}
 
-		immudbObjectRequest.KVs = append(immudbObjectRequest.KVs,
-			&schema.KeyValue{ // crete secondary key index <collection>.<SKName>.<SKVALUE>.<PKVALUE>
-				Key:   []byte(fmt.Sprintf("%s.%s.{%s}.{%s}", jr.collection, jr.indexedKeys[i], gjSK.String(), pk)),
-				Value: []byte([]byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], pk))), //value is link to payload
-			},
-		)
+		return &schema.Op{ // add payload key to <collection>.<SKName>.<SKVALUE>
+			Operation: &schema.Op_ZAdd{ZAdd: &schema.ZAddRequest{Set: []byte(fmt.Sprintf("%s.%s.{%s}", jr.collection, field, gjSK.String())), Key: payloadKey}},
+		}, nil
 	}
 
-	txh, err := jr.client.SetAll(context.TODO(), immudbObjectRequest)
-	if err != nil {
-		return 0, fmt.Errorf("could not store object: %w", err)
+	return &schema.Op{ // crete secondary key index <collection>.<SKName>.<SKVALUE>.<PKVALUE>
+		Operation: &schema.Op_Kv{Kv: &schema.KeyValue{
+			Key:   []byte(fmt.Sprintf("%s.%s.{%s}.{%s}", jr.collection, field, gjSK.String(), pk)),
+			Value: payloadKey, //value is link to payload
+		}},
+	}, nil
+}
+
+// scoreOf converts json value into sorted set score. Numbers and numeric
+// strings are used as is, time strings as unix seconds.
+func scoreOf(gjr gjson.Result) (float64, error) {
+	if gjr.Type == gjson.Number {
+		return gjr.Num, nil
 	}
 
-	log.WithField("txID", txh.Id).Trace("Wrote entry")
+	if gjr.Type == gjson.String {
+		score, err := strconv.ParseFloat(gjr.Str, 64)
+		if err == nil {
+			return score, nil
+		}
 
-	return txh.Id, nil
+		t, err := ParseTime(gjr.Str)
+		if err != nil {
+			return 0, fmt.Errorf("%s is neither a number nor time", gjr.Str)
+		}
+
+		return float64(t.UnixNano()) / 1e9, nil
+	}
+
+	return 0, fmt.Errorf("%s is neither a number nor time", gjr.Raw)
+}
+
+// ReadOptions controls paging and ordering of reads.
+type ReadOptions struct {
+	Limit  uint64 // maximum number of entries to read, 0 means all
+	Cursor string // cursor returned by previous read, to continue from
+	Desc   bool   // if true, entries are read in descending order
+	AsOfTx uint64 // if set, entries are read as they were at transaction
+
+	// current skips links of previous index values, so every object is read
+	// once, by its current value
+	current bool
 }
 
-// for now just based on SK
-func (jr *JsonKVRepository) Read(key string, prefix string) ([][]byte, error) {
+// Read streams objects matching indexed key and value prefix to fn, without
+// accumulating them in memory. If the limit is reached, it returns cursor
+// to be used to continue reading, otherwise empty string.
+func (jr *JsonKVRepository) Read(key string, prefix string, opts ReadOptions, fn func(object []byte) error) (string, error) {
 	if key == "" {
 		key = jr.indexedKeys[0]
 	}
@@ -144,50 +387,312 @@ func (jr *JsonKVRepository) Read(key string, prefix string) ([][]byte, error) {
 		}
 	}
 	if !validKey {
-		return nil, fmt.Errorf("not indexed key %s", key)
+		return "", invalidQuery(fmt.Errorf("not indexed key %s", key))
+	}
+
+	for _, b := range jr.cfg.Building {
+		if b == key {
+			return "", invalidQuery(fmt.Errorf("index %s is being built, run reindex to finish it", key))
+		}
+	}
+
+	if opts.AsOfTx > 0 {
+		err := jr.checkAsOf(opts.AsOfTx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if jr.cfg.Layout == KVLayoutRefs && key != jr.indexedKeys[0] {
+		return jr.readSortedSet(key, prefix, opts, fn)
+	}
+
+	return jr.scanIndex(key, &schema.ScanRequest{
+		Prefix: []byte(fmt.Sprintf("%s.%s.{%s", jr.collection, key, prefix)),
+		Desc:   opts.Desc,
+	}, opts, fn)
+}
+
+// ReadIngested streams objects ingested within time range, in versions they
+// were ingested in. Zero since or until leaves the range open.
+func (jr *JsonKVRepository) ReadIngested(since time.Time, until time.Time, opts ReadOptions, fn func(object []byte) error) (string, error) {
+	if opts.AsOfTx > 0 {
+		err := jr.checkAsOf(opts.AsOfTx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var from, to []byte
+	if !since.IsZero() {
+		from = []byte(fmt.Sprintf("%s.%s.{%019d", jr.collection, ingestedIndex, since.UnixNano()))
+	}
+	if !until.IsZero() {
+		to = []byte(fmt.Sprintf("%s.%s.{%019d", jr.collection, ingestedIndex, until.UnixNano()+1))
+	}
+
+	request := &schema.ScanRequest{
+		Prefix:  []byte(fmt.Sprintf("%s.%s.{", jr.collection, ingestedIndex)),
+		SeekKey: from,
+		EndKey:  to,
+		Desc:    opts.Desc,
+	}
+	if opts.Desc {
+		request.SeekKey, request.EndKey = to, from
+	}
+
+	return jr.scanIndex(ingestedIndex, request, opts, fn)
+}
+
+// scanIndex streams objects pointed by entries of field index matching
+// request.
+func (jr *JsonKVRepository) scanIndex(field string, request *schema.ScanRequest, opts ReadOptions, fn func(object []byte) error) (string, error) {
+	if opts.Cursor != "" {
+		seekKey, err := decodeKVCursor(opts.Cursor)
+		if err != nil {
+			return "", err
+		}
+		request.SeekKey = seekKey
 	}
 
-	seekKey := []byte("")
-	var objects [][]byte
+	read := uint64(0)
 	for {
-		entries, err := jr.client.Scan(context.TODO(), &schema.ScanRequest{
-			Prefix:  []byte(fmt.Sprintf("%s.%s.{%s", jr.collection, key, prefix)),
-			SeekKey: seekKey,
-			Limit:   999,
-		})
+		request.Limit = uint64(999)
+		if opts.Limit > 0 && opts.Limit-read < request.Limit {
+			request.Limit = opts.Limit - read
+		}
+
+		entries, err := jr.client.Scan(context.TODO(), request)
 		if err != nil {
-			return nil, fmt.Errorf("could not scan for objects, %w", err)
+			return "", fmt.Errorf("could not scan for objects, %w", err)
+		}
+
+		for _, e := range entries.Entries {
+			// references are resolved by immudb, links need to be followed
+			object := e.Value
+			request.SeekKey = e.Key
+			if opts.AsOfTx > 0 {
+				object, err = jr.indexedObjectAt(field, e, opts.AsOfTx)
+				if err != nil {
+					return "", err
+				}
+
+				if e.ReferencedBy != nil {
+					request.SeekKey = e.ReferencedBy.Key
+				}
+				if object == nil {
+					continue
+				}
+			} else if e.ReferencedBy != nil {
+				request.SeekKey = e.ReferencedBy.Key
+			} else {
+				objectEntry, err := jr.client.Get(context.TODO(), e.Value)
+				if err != nil && isKeyNotFound(err) {
+					// links of previous index values remain after the entry
+					// was purged
+					continue
+				}
+				if err != nil {
+					return "", fmt.Errorf("could not scan for object, %w", err)
+				}
+				object = objectEntry.Value
+
+				if opts.current && field != jr.indexedKeys[0] {
+					op, err := jr.indexOf(field, object)
+					if err != nil {
+						return "", err
+					}
+
+					if op == nil || !bytes.Equal(op.GetKv().GetKey(), e.Key) {
+						continue
+					}
+				}
+			}
+
+			err = fn(object)
+			if err != nil {
+				return "", err
+			}
+
+			read++
 		}
 
-		if len(entries.Entries) == 0 {
-			log.WithField("key", key).WithField("prefix", prefix).Debug("No more entries matching condition")
+		if opts.Limit > 0 && read >= opts.Limit {
+			return encodeKVCursor(request.SeekKey), nil
+		}
+
+		if uint64(len(entries.Entries)) < request.Limit {
+			log.WithField("prefix", string(request.Prefix)).Debug("No more entries matching condition")
 			break
 		}
+	}
+
+	return "", nil
+}
+
+// readSortedSet streams objects from sorted set of indexed field. For scored
+// fields, value is a score range min..max, with optional bounds, or exact
+// score. For other fields, value needs to match exactly.
+func (jr *JsonKVRepository) readSortedSet(key string, value string, opts ReadOptions, fn func(object []byte) error) (string, error) {
+	request := &schema.ZScanRequest{Desc: opts.Desc}
+	if jr.cfg.IsScored(key) {
+		request.Set = []byte(fmt.Sprintf("%s.%s", jr.collection, key))
+		min, max, err := parseScoreRange(value)
+		if err != nil {
+			return "", err
+		}
+
+		request.MinScore, request.MaxScore = min, max
+		// descending scan seeks to max score without key, which would skip
+		// entries with exactly max score
+		if opts.Desc && max != nil {
+			request.MaxScore = &schema.Score{Score: math.Nextafter(max.Score, math.Inf(1))}
+		}
+	} else {
+		if value == "" {
+			return "", invalidQuery(fmt.Errorf("exact value of %s is required", key))
+		}
+		request.Set = []byte(fmt.Sprintf("%s.%s.{%s}", jr.collection, key, value))
+	}
+
+	if opts.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return "", invalidQuery(fmt.Errorf("invalid cursor, %w", err))
+		}
+
+		request.SeekKey = []byte(gjson.GetBytes(b, "Key").String())
+		request.SeekScore = gjson.GetBytes(b, "Score").Float()
+	}
+
+	read := uint64(0)
+	for {
+		request.Limit = uint64(999)
+		if opts.Limit > 0 && opts.Limit-read < request.Limit {
+			request.Limit = opts.Limit - read
+		}
+
+		entries, err := jr.client.ZScan(context.TODO(), request)
+		if err != nil {
+			return "", fmt.Errorf("could not scan sorted set, %w", err)
+		}
 
 		for _, e := range entries.Entries {
-			// retrieve an object
-			objectEntry, err := jr.client.Get(context.Background(), e.Value)
+			request.SeekKey = e.Key
+			request.SeekScore = e.Score
+
+			object := e.Entry.Value
+			if opts.AsOfTx > 0 {
+				object, err = jr.zMemberObjectAt(key, e, opts.AsOfTx)
+				if err != nil {
+					return "", err
+				}
+
+				if object == nil {
+					continue
+				}
+			} else {
+				isMember, err := jr.isMemberOf(key, e, object)
+				if err != nil {
+					return "", err
+				}
+
+				if !isMember {
+					continue
+				}
+			}
+
+			err = fn(object)
+			if err != nil {
+				return "", err
+			}
+
+			read++
+		}
+
+		if opts.Limit > 0 && read >= opts.Limit {
+			b, err := json.Marshal(map[string]interface{}{"Key": string(request.SeekKey), "Score": request.SeekScore})
 			if err != nil {
-				return nil, fmt.Errorf("could not scan for object, %w", err)
+				return "", fmt.Errorf("could not encode cursor, %w", err)
 			}
 
-			seekKey = e.Key
-			objects = append(objects, objectEntry.Value)
+			return base64.RawURLEncoding.EncodeToString(b), nil
+		}
+
+		if uint64(len(entries.Entries)) < request.Limit {
+			break
 		}
 	}
 
-	return objects, nil
+	return "", nil
+}
+
+// parseScoreRange parses min..max score range, where both bounds are
+// optional, or exact score.
+func parseScoreRange(value string) (*schema.Score, *schema.Score, error) {
+	if value == "" {
+		return nil, nil, nil
+	}
+
+	bounds := strings.SplitN(value, "..", 2)
+	if len(bounds) == 1 {
+		bounds = append(bounds, bounds[0])
+	}
+
+	scores := []*schema.Score{nil, nil}
+	for i, b := range bounds {
+		if b == "" {
+			continue
+		}
+
+		score, err := scoreOf(gjson.Result{Type: gjson.String, Str: b})
+		if err != nil {
+			return nil, nil, invalidQuery(fmt.Errorf("invalid score range %s, %w", value, err))
+		}
+		scores[i] = &schema.Score{Score: score}
+	}
+
+	return scores[0], scores[1], nil
+}
+
+func encodeKVCursor(seekKey []byte) string {
+	return base64.RawURLEncoding.EncodeToString(seekKey)
+}
+
+func decodeKVCursor(cursor string) ([]byte, error) {
+	seekKey, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidQuery(fmt.Errorf("invalid cursor, %w", err))
+	}
+
+	return seekKey, nil
 }
 
 type History struct {
+	Key      string // primary key value
 	Entry    []byte
 	TxID     uint64
 	Revision uint64
+	Deleted  bool
 }
 
 func (imo *JsonKVRepository) History(primaryKeyValue string) ([]History, error) {
-	offset := uint64(0)
 	objects := []History{}
+	err := imo.KeyHistory(primaryKeyValue, 0, 0, func(h History) error {
+		objects = append(objects, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// KeyHistory streams revisions of object with primary key value within
+// transaction range to fn. Zero bound leaves the range open.
+func (imo *JsonKVRepository) KeyHistory(primaryKeyValue string, sinceTx uint64, untilTx uint64, fn func(History) error) error {
+	offset := uint64(0)
 	for {
 		entries, err := imo.client.History(context.TODO(), &schema.HistoryRequest{
 			Key:    []byte(fmt.Sprintf("%s.payload.%s.{%s}", imo.collection, imo.indexedKeys[0], primaryKeyValue)),
@@ -196,16 +701,25 @@ func (imo *JsonKVRepository) History(primaryKeyValue string) ([]History, error)
 		})
 
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		for _, e := range entries.Entries {
-			objects = append(objects, History{
+			offset++
+			if e.Tx < sinceTx || (untilTx > 0 && e.Tx > untilTx) {
+				continue
+			}
+
+			err = fn(History{
+				Key:      primaryKeyValue,
 				Entry:    e.Value,
 				Revision: e.Revision,
 				TxID:     e.Tx,
+				Deleted:  e.Metadata.GetDeleted(),
 			})
-			offset++
+			if err != nil {
+				return err
+			}
 		}
 
 		if len(entries.Entries) < 999 {
@@ -214,5 +728,5 @@ func (imo *JsonKVRepository) History(primaryKeyValue string) ([]History, error)
 		}
 	}
 
-	return objects, nil
+	return nil
 }
@@ -0,0 +1,122 @@
+package immudb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+func TestKVStored(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	err := CreateCollection(cli, "stored", Config{Type: "kv", Indexes: []string{"id", "user"}}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonKVRepository(cli, "stored")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jr.WriteBytes([]byte(`{"id":"1","user":"alice"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := jr.WriteBytes([]byte(`{"id":"1","user":"bob"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, stored, err := jr.Stored([]byte(`{"id":"1","user":"bob"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored || tx != second {
+		t.Fatalf("expected current version stored in transaction %d, got %t in %d", second, stored, tx)
+	}
+
+	// only the current version counts, as previous one would be written again
+	for _, object := range []string{`{"id":"1","user":"alice"}`, `{"id":"2","user":"bob"}`} {
+		_, stored, err = jr.Stored([]byte(object))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored {
+			t.Errorf("expected %s not to be stored", object)
+		}
+	}
+}
+
+func TestKVNullFields(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	cfg := Config{Type: "kv", Indexes: []string{"id", "user", "group", "role"}, IndexPolicies: map[string]IndexPolicy{
+		"group": {Mode: IndexOptional},
+		"role":  {Mode: IndexDefault, Default: "none"},
+	}}
+	err := CreateCollection(cli, "nulls", cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonKVRepository(cli, "nulls")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// null of required field is missing, as for SQL collections
+	_, err = jr.WriteBytes([]byte(`{"id":"1","user":null}`))
+	if err == nil {
+		t.Fatal("expected write with null required field to fail")
+	}
+
+	_, err = jr.WriteBytes([]byte(`{"id":"1","user":"alice","group":null,"role":null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		field    string
+		value    string
+		expected []string
+	}{
+		{"group", "", []string{}},
+		{"role", "none", []string{"1"}},
+	} {
+		ids := readIDs(t, func(fn func([]byte) error) error {
+			_, err := jr.Read(tt.field, tt.value, ReadOptions{}, fn)
+			return err
+		})
+		if !reflect.DeepEqual(ids, tt.expected) {
+			t.Errorf("expected %v by %s, got %v", tt.expected, tt.field, ids)
+		}
+	}
+}
+
+func TestKVReservedIndexes(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	for _, index := range []string{"_ingested", "_tombstone", "_purged"} {
+		err := CreateCollection(cli, "reserved", Config{Type: "kv", Indexes: []string{"id", index}}, nil, false)
+		if err == nil {
+			t.Errorf("expected collection with index %s to be rejected", index)
+		}
+	}
+
+	err := CreateCollection(cli, "reserved", Config{Type: "kv", Indexes: []string{"id"}}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonKVRepository(cli, "reserved")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = jr.AddIndexes([]string{"_tombstone"}, nil)
+	if err == nil {
+		t.Error("expected reserved index not to be added")
+	}
+}
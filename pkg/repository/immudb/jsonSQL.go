@@ -1,42 +1,50 @@
 package immudb
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand"
+	"regexp"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/gjson"
 
+	"github.com/codenotary/immudb/pkg/api/schema"
 	immudb "github.com/codenotary/immudb/pkg/client"
+	"github.com/tomekkolo/immudb-play/pkg/metrics"
 )
 
-type column struct {
-	name  string
-	cType string
-}
-
 type JsonSQLRepository struct {
 	client     immudb.ImmuClient
 	collection string
 	columns    []column
+	primaryKey []column
+	cfg        *Config
 }
 
 func NewJsonSQLRepository(cli immudb.ImmuClient, collection string) (*JsonSQLRepository, error) {
-	// retrieve collection table and columns
-	tx, err := cli.NewTx(context.TODO())
+	// collection is used as table name, which cannot be passed as parameter
+	err := ValidateIdentifier(collection)
 	if err != nil {
-		return nil, fmt.Errorf("could not create transaction for sql repository, %w", err)
+		return nil, fmt.Errorf("invalid collection, %w", err)
 	}
 
-	res, err := tx.SQLQuery(context.TODO(), fmt.Sprintf("select name from Tables() where name like '%s';", collection), nil)
+	// collection table is read outside of transaction, as session allows
+	// only one read write transaction at once, and repositories are created
+	// by concurrent requests of servers
+	query := clientQuery(cli)
+	exists, err := tableExists(query, collection)
 	if err != nil {
-		return nil, fmt.Errorf("could not query tables, %w", err)
+		return nil, err
 	}
 
-	if len(res.Rows) != 1 {
+	if !exists {
 		return nil, errors.New("collection does not exist")
 	}
 
@@ -45,29 +53,115 @@ func NewJsonSQLRepository(cli immudb.ImmuClient, collection string) (*JsonSQLRep
 		return nil, fmt.Errorf("collection is missing definition, %w", err)
 	}
 
-	columns := []column{}
-	for _, c := range cfg.Indexes {
-		splitted := strings.Split(c, "=")
-		if len(splitted) != 2 {
-			return nil, fmt.Errorf("invalid index definition, %s", c)
-		}
+	if cfg.Dropped {
+		return nil, errors.New("collection was dropped")
+	}
 
-		columns = append(columns, column{name: splitted[0], cType: splitted[1]})
+	columns, err := parseColumns(cfg.Indexes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collection definition, %w", err)
 	}
 
-	_, err = tx.Commit(context.TODO())
+	primaryKey, err := queryPrimaryKey(query, collection, columns)
 	if err != nil {
-		return nil, fmt.Errorf("could not initialize sql repository, %w", err)
+		return nil, err
 	}
 
-	log.WithField("columns", columns).Info("Columns from immudb")
+	log.WithField("columns", columns).WithField("primary_key", primaryKey).Info("Columns from immudb")
 	return &JsonSQLRepository{
 		client:     cli,
 		collection: collection,
 		columns:    columns,
+		primaryKey: primaryKey,
+		cfg:        cfg,
 	}, nil
 }
 
+// sqlQuery runs SQL query, either in transaction or outside of one.
+type sqlQuery func(sql string, params map[string]interface{}) (*schema.SQLQueryResult, error)
+
+func txQuery(tx immudb.Tx) sqlQuery {
+	return func(sql string, params map[string]interface{}) (*schema.SQLQueryResult, error) {
+		return tx.SQLQuery(context.TODO(), sql, params)
+	}
+}
+
+func clientQuery(cli immudb.ImmuClient) sqlQuery {
+	return func(sql string, params map[string]interface{}) (*schema.SQLQueryResult, error) {
+		return cli.SQLQuery(context.TODO(), sql, params, true)
+	}
+}
+
+func tableExists(query sqlQuery, collection string) (bool, error) {
+	// tables are matched here, as immudb does not pass parameters to
+	// conditions on TABLES()
+	res, err := query("SELECT name FROM TABLES();", nil)
+	if err != nil {
+		return false, fmt.Errorf("could not query tables, %w", err)
+	}
+
+	for _, r := range res.Rows {
+		if r.Values[0].GetS() == collection {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// queryPrimaryKey resolves primary key columns of collection table, in the
+// order they are declared in the primary index.
+func queryPrimaryKey(query sqlQuery, collection string, columns []column) ([]column, error) {
+	res, err := query("SELECT * FROM INDEXES(@collection);", map[string]interface{}{"collection": collection})
+	if err != nil {
+		return nil, fmt.Errorf("could not query indexes, %w", err)
+	}
+
+	for _, r := range res.Rows {
+		if !r.Values[3].GetB() {
+			continue
+		}
+
+		// primary index name has format table[column1,column2,...], with
+		// column names lowercased by immudb
+		name := r.Values[1].GetS()
+		start := strings.Index(name, "[")
+		if start < 0 || !strings.HasSuffix(name, "]") {
+			return nil, fmt.Errorf("invalid primary index name %s", name)
+		}
+
+		primaryKey := []column{}
+		for _, pkName := range strings.Split(name[start+1:len(name)-1], ",") {
+			found := false
+			for _, c := range columns {
+				if strings.EqualFold(c.name, pkName) {
+					primaryKey = append(primaryKey, c)
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				return nil, fmt.Errorf("primary key column %s is missing definition", pkName)
+			}
+		}
+
+		return primaryKey, nil
+	}
+
+	return nil, errors.New("collection is missing primary key")
+}
+
+func (jr *JsonSQLRepository) isPrimaryKey(c column) bool {
+	for _, pk := range jr.primaryKey {
+		if pk.name == c.name {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (jr *JsonSQLRepository) Write(jObject interface{}) (uint64, error) {
 	objectBytes, err := json.Marshal(jObject)
 	if err != nil {
@@ -78,6 +172,182 @@ func (jr *JsonSQLRepository) Write(jObject interface{}) (uint64, error) {
 }
 
 func (jr *JsonSQLRepository) WriteBytes(jBytes []byte) (uint64, error) {
+	sql, params, err := jr.upsert(jBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	defer metrics.ObserveWrite(jr.collection, "sql", time.Now())
+
+	// existing rows are detected by immudb with INSERT, so they cannot be
+	// replaced between check and write
+	if jr.cfg.Overwrite == OverwriteWarn || jr.cfg.Overwrite == OverwriteReject {
+		res, err := jr.sqlExec(strings.Replace(sql, "UPSERT", "INSERT", 1), params)
+		if err == nil {
+			return res.Txs[0].Header.Id, nil
+		}
+
+		if !isDuplicateKey(err) {
+			return 0, fmt.Errorf("could not insert into collection, %w", err)
+		}
+
+		if jr.cfg.Overwrite == OverwriteReject {
+			return 0, fmt.Errorf("%w, %s", ErrOverwriteRejected, err)
+		}
+
+		log.WithField("collection", jr.collection).WithError(err).Warn("Overwriting existing row")
+	}
+
+	res, err := jr.sqlExec(sql, params)
+	if err != nil {
+		return 0, fmt.Errorf("could not insert into collection, %w", err)
+	}
+
+	return res.Txs[0].Header.Id, nil
+}
+
+// Stored tells whether object is the current version of its row, and
+// returns transaction it was written in, e.g. to check if write which failed
+// with lost connection was committed.
+func (jr *JsonSQLRepository) Stored(jBytes []byte) (uint64, bool, error) {
+	_, _, err := jr.upsert(jBytes)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return jr.CurrentTx(jBytes)
+}
+
+// CurrentTx tells whether object read from collection, e.g. by History, is
+// the current version of its row, and returns transaction it was written in.
+func (jr *JsonSQLRepository) CurrentTx(jBytes []byte) (uint64, bool, error) {
+	_, primaryKey := jr.primaryKeyOf(jBytes)
+	params := map[string]interface{}{}
+	condition, err := jr.primaryKeyCondition(primaryKey, "pk", params)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var object []byte
+	_, err = jr.selectPaged(jr.collection, condition, params, ReadOptions{Limit: 1}, func(o []byte) error {
+		object = o
+		return nil
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("could not read row, %w", err)
+	}
+
+	if !bytes.Equal(object, jBytes) {
+		return 0, false, nil
+	}
+
+	entry, err := jr.sqlEntry(primaryKey)
+	if err != nil {
+		return 0, false, fmt.Errorf("could not get transaction of row, %w", err)
+	}
+
+	return entry.Tx, true, nil
+}
+
+// sqlEntry reads current version of row with primary key, with its raw key
+// and transaction, which rows read with queries do not expose.
+func (jr *JsonSQLRepository) sqlEntry(primaryKey []gjson.Result) (*schema.SQLEntry, error) {
+	pkValues, err := jr.primaryKeyValues(primaryKey)
+	if err != nil {
+		return nil, err
+	}
+
+	vEntry, err := jr.client.GetServiceClient().VerifiableSQLGet(context.TODO(), &schema.VerifiableSQLGetRequest{
+		SqlGetRequest: &schema.SQLGetRequest{Table: jr.collection, PkValues: pkValues},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return vEntry.SqlEntry, nil
+}
+
+// primaryKeyValues encodes primary key of object for requests of single row.
+func (jr *JsonSQLRepository) primaryKeyValues(primaryKey []gjson.Result) ([]*schema.SQLValue, error) {
+	params := map[string]interface{}{}
+	_, err := jr.primaryKeyCondition(primaryKey, "pk", params)
+	if err != nil {
+		return nil, err
+	}
+
+	pkValues := make([]*schema.SQLValue, len(jr.primaryKey))
+	for i := range jr.primaryKey {
+		named, err := schema.EncodeParams(map[string]interface{}{"pk": params[fmt.Sprintf("pk%d", i)]})
+		if err != nil {
+			return nil, fmt.Errorf("invalid primary key, %w", err)
+		}
+		pkValues[i] = named[0].Value
+	}
+
+	return pkValues, nil
+}
+
+// WriteBytesBatch writes objects in single transaction, and returns its id
+// for each of them. With overwrite policy other than allow, objects are
+// written one by one, and ones rejected by the policy get 0 transaction id.
+func (jr *JsonSQLRepository) WriteBytesBatch(objects [][]byte) ([]uint64, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	metrics.ObserveBatch(jr.collection, "sql", len(objects))
+	if jr.cfg.Overwrite == OverwriteWarn || jr.cfg.Overwrite == OverwriteReject {
+		return writeOneByOne(jr, objects)
+	}
+
+	start := time.Now()
+	txID, err := jr.upsertAll(objects)
+	metrics.ObserveWrite(jr.collection, "sql", start)
+	if err != nil {
+		return nil, err
+	}
+
+	txIDs := make([]uint64, len(objects))
+	for i := range txIDs {
+		txIDs[i] = txID
+	}
+
+	return txIDs, nil
+}
+
+// Writes conflicting with concurrent ones are retried up to maxConflictRetries
+// times, after random backoff growing by conflictBackoff, so they do not
+// conflict again.
+const (
+	maxConflictRetries = 10
+	conflictBackoff    = 10 * time.Millisecond
+)
+
+// sqlExec executes statement, retrying it on read conflict, with which
+// immudb rejects transactions conflicting with concurrent ones instead of
+// waiting for them.
+func (jr *JsonSQLRepository) sqlExec(sql string, params map[string]interface{}) (*schema.SQLExecResult, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := jr.client.SQLExec(context.TODO(), sql, params)
+		if err == nil || attempt == maxConflictRetries || !isReadConflict(err) {
+			return res, err
+		}
+
+		log.WithField("collection", jr.collection).WithField("attempt", attempt).Debug("Write conflicted with concurrent one, retrying")
+		time.Sleep(time.Duration(rand.Int63n(int64(attempt) * int64(conflictBackoff))))
+	}
+}
+
+func isReadConflict(err error) bool {
+	return strings.Contains(err.Error(), "tx read conflict")
+}
+
+func isDuplicateKey(err error) bool {
+	return strings.Contains(err.Error(), "key already exists")
+}
+
+// upsert builds UPSERT statement with parameters for json object.
+func (jr *JsonSQLRepository) upsert(jBytes []byte) (string, map[string]interface{}, error) {
 	// parse with gjson
 	gjsonObject := gjson.ParseBytes(jBytes)
 
@@ -89,19 +359,32 @@ func (jr *JsonSQLRepository) WriteBytes(jBytes []byte) (uint64, error) {
 		}
 		cSlice = append(cSlice, c.name)
 		gjr := gjsonObject.Get(c.name)
-		if !gjr.Exists() {
-			return 0, fmt.Errorf("missing field %s in object", c)
+		if !gjr.Exists() || gjr.Type == gjson.Null {
+			policy := jr.cfg.Policy(c.name)
+			if jr.isPrimaryKey(c) || policy.Mode == IndexRequired {
+				return "", nil, fmt.Errorf("missing field %s in object", c.name)
+			}
+
+			if policy.Mode == IndexDefault {
+				v, err := filterValue(c, policy.Default)
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid default for field %s, %w", c.name, err)
+				}
+
+				params[c.name] = v
+				continue
+			}
+
+			params[c.name] = nil
+			continue
 		}
 
-		if c.cType == "INTEGER" {
-			params[c.name] = gjr.Int()
-		} else if strings.HasPrefix(c.cType, "VARCHAR") {
-			params[c.name] = gjr.String()
-		} else if c.cType == "TIMESTAMP" {
-			params[c.name] = gjr.Time()
-		} else {
-			return 0, fmt.Errorf("unsupported field type %s", c.cType)
+		v, err := c.value(gjr)
+		if err != nil {
+			return "", nil, err
 		}
+
+		params[c.name] = v
 	}
 
 	sb := strings.Builder{}
@@ -113,124 +396,339 @@ func (jr *JsonSQLRepository) WriteBytes(jBytes []byte) (uint64, error) {
 	sb.WriteString(strings.Join(cSlice, ",@"))
 	sb.WriteString(",@__value__);")
 	log.WithField("sql", sb.String()).WithField("collection", jr.collection).Trace("inserting row")
-	res, err := jr.client.SQLExec(context.TODO(), sb.String(), params)
+
+	return sb.String(), params, nil
+}
+
+// SQLQuery narrows down reads from SQL collection. Filters are compiled into
+// parameterized conditions. Raw is used as is, so it must come from trusted
+// input only. For Read, it is a condition, e.g. "id=1", for History it is a
+// temporal query, e.g. "SINCE TX 100 UNTIL NOW() WHERE id=1".
+type SQLQuery struct {
+	Filters []Filter
+	Raw     string
+
+	// temporal range, considered by History only
+	SinceTx uint64
+	UntilTx uint64
+	Since   time.Time
+	Until   time.Time
+}
+
+// Read streams objects matching query to fn, without accumulating them in
+// memory. If the limit is reached, it returns cursor to be used to continue
+// reading, otherwise empty string.
+func (jr *JsonSQLRepository) Read(query SQLQuery, opts ReadOptions, fn func(object []byte) error) (string, error) {
+	params := map[string]interface{}{}
+	condition, err := jr.condition(query.Filters, query.Raw, params)
 	if err != nil {
-		return 0, fmt.Errorf("could not insert into collection, %w", err)
+		return "", err
 	}
 
-	return res.Txs[0].Header.Id, nil
+	source := jr.collection
+	if opts.AsOfTx > 0 {
+		source += " UNTIL TX @asOfTx"
+		params["asOfTx"] = opts.AsOfTx
+	}
+
+	return jr.selectPaged(source, condition, params, opts, fn)
 }
 
-func (jr *JsonSQLRepository) Read(query string) ([][]byte, error) {
-	// intentionally accepting query as is for now.
-	sb := strings.Builder{}
-	sb.WriteString("SELECT \"")
-	sb.WriteString(jr.columns[0].name)
-	sb.WriteString("\",__value__ FROM ")
-	sb.WriteString(jr.collection)
-	if query != "" {
-		sb.WriteString(" WHERE ")
-		sb.WriteString(query)
+// History streams objects matching query in its temporal range to fn. When no
+// range is given, the whole history is considered. Range can be given either
+// by raw query or by query fields, not both.
+func (jr *JsonSQLRepository) History(query SQLQuery, opts ReadOptions, fn func(object []byte) error) (string, error) {
+	params := map[string]interface{}{}
+	temporal, rawCondition := splitTemporalQuery(query.Raw)
+	hasRange := query.SinceTx > 0 || query.UntilTx > 0 || !query.Since.IsZero() || !query.Until.IsZero()
+	if temporal != "" && hasRange {
+		return "", invalidQuery(errors.New("temporal range given both in raw query and as since/until"))
 	}
 
-	page := fmt.Sprintf(" ORDER BY \"%s\" DESC LIMIT 999", jr.columns[0].name)
-	ret := [][]byte{}
-	for {
-		log.WithField("sql", sb.String()+page).WithField("collection", jr.collection).Info("reading")
-		res, err := jr.client.SQLQuery(context.TODO(), sb.String()+page, nil, true)
-		if err != nil {
-			return nil, err
-		}
+	if temporal == "" {
+		temporal = temporalClause(query, params)
+	}
 
-		if len(res.Rows) < 999 {
-			break
-		}
+	condition, err := jr.condition(query.Filters, rawCondition, params)
+	if err != nil {
+		return "", err
+	}
 
-		for _, r := range res.Rows {
-			ret = append(ret, r.Values[0].GetBs())
-		}
+	return jr.selectPaged(jr.collection+" "+temporal, condition, params, opts, fn)
+}
 
-		if jr.columns[0].cType == "INTEGER" {
-			page = fmt.Sprintf(" \"%s\" < %d ORDER BY \"%s\" DESC LIMIT 999;", jr.columns[0].name, res.Rows[len(res.Rows)-1].Values[0].GetN(), jr.columns[0].name)
-		} else if strings.HasPrefix(jr.columns[0].cType, "VARCHAR") {
-			page = fmt.Sprintf(" \"%s\" < '%s' ORDER BY \"%s\" DESC LIMIT 999;", jr.columns[0].name, res.Rows[len(res.Rows)-1].Values[0].GetS(), jr.columns[0].name)
-		} else if jr.columns[0].cType == "TIMESTAMP" {
-			page = fmt.Sprintf(" \"%s\" < %d ORDER BY \"%s\" DESC LIMIT 999;", jr.columns[0].name, res.Rows[len(res.Rows)-1].Values[0].GetTs(), jr.columns[0].name)
-		} else {
-			return nil, fmt.Errorf("unsupported field type %s", jr.columns[0].cType)
-		}
+func (jr *JsonSQLRepository) condition(filters []Filter, raw string, params map[string]interface{}) (string, error) {
+	condition, err := compileFilters(filters, jr.columns, params)
+	if err != nil {
+		return "", err
+	}
 
-		if !strings.Contains(strings.ToLower(sb.String()), "where") {
-			page = " WHERE " + page
+	if raw != "" {
+		if condition != "" {
+			condition += " AND "
 		}
+		condition += "(" + raw + ")"
 	}
 
-	return ret, nil
+	return condition, nil
 }
 
-func (jr *JsonSQLRepository) History(query string) ([][]byte, error) {
-	// intentionally accepting query as is for now.
-	sb := strings.Builder{}
-	sb.WriteString("SELECT \"")
-	sb.WriteString(jr.columns[0].name)
-	sb.WriteString("\",__value__ FROM ")
-	sb.WriteString(jr.collection)
-	sb.WriteString(" ")
-	if query != "" {
-		sb.WriteString(query)
+// temporalClause builds parameterized SINCE/UNTIL clause from query range.
+func temporalClause(query SQLQuery, params map[string]interface{}) string {
+	clause := "SINCE TX 1"
+	if query.SinceTx > 0 {
+		clause = "SINCE TX @sinceTx"
+		params["sinceTx"] = query.SinceTx
+	} else if !query.Since.IsZero() {
+		clause = "SINCE @since"
+		params["since"] = query.Since
+	}
+
+	if query.UntilTx > 0 {
+		clause += " UNTIL TX @untilTx"
+		params["untilTx"] = query.UntilTx
+	} else if !query.Until.IsZero() {
+		clause += " UNTIL @until"
+		params["until"] = query.Until
 	} else {
-		sb.WriteString("SINCE TX 1 UNTIL NOW() ")
+		clause += " UNTIL NOW()"
 	}
 
-	h := [][]byte{}
+	return clause
+}
 
-	page := fmt.Sprintf(" ORDER BY \"%s\" DESC LIMIT 999", jr.columns[0].name)
+// selectPaged reads rows from source matching condition in pages, with keyset
+// pagination over the primary key. Rows are always sorted by the primary
+// index, so the last primary key value read is a position to continue from.
+func (jr *JsonSQLRepository) selectPaged(source string, condition string, params map[string]interface{}, opts ReadOptions, fn func(object []byte) error) (string, error) {
+	after, err := jr.decodeSQLCursor(opts.Cursor)
+	if err != nil {
+		return "", err
+	}
+
+	pkNames := make([]string, len(jr.primaryKey))
+	for i, c := range jr.primaryKey {
+		pkNames[i] = "\"" + c.name + "\""
+	}
+
+	read := uint64(0)
 	for {
-		log.WithField("sql", sb.String()+page).WithField("collection", jr.collection).Info("history")
-		res, err := jr.client.SQLQuery(context.TODO(), sb.String()+page, nil, true)
-		if err != nil {
-			return nil, err
+		limit := uint64(999)
+		if opts.Limit > 0 && opts.Limit-read < limit {
+			limit = opts.Limit - read
 		}
 
-		if len(res.Rows) < 999 {
-			break
+		conditions := []string{}
+		if condition != "" {
+			conditions = append(conditions, "("+condition+")")
+		}
+
+		if after != nil {
+			conditions = append(conditions, jr.keysetCondition(after, opts.Desc, params))
+		}
+
+		sb := strings.Builder{}
+		sb.WriteString("SELECT ")
+		sb.WriteString(strings.Join(pkNames, ","))
+		sb.WriteString(",__value__ FROM ")
+		sb.WriteString(source)
+		sb.WriteString(" USE INDEX ON (")
+		sb.WriteString(strings.Join(pkNames, ","))
+		sb.WriteString(")")
+		if len(conditions) > 0 {
+			sb.WriteString(" WHERE ")
+			sb.WriteString(strings.Join(conditions, " AND "))
+		}
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(pkNames[0])
+		if opts.Desc {
+			sb.WriteString(" DESC")
+		}
+		sb.WriteString(fmt.Sprintf(" LIMIT %d;", limit))
+
+		log.WithField("sql", sb.String()).WithField("collection", jr.collection).Debug("reading")
+		res, err := jr.client.SQLQuery(context.TODO(), sb.String(), params, true)
+		if err != nil {
+			return "", err
 		}
 
 		for _, r := range res.Rows {
+			err = fn(r.Values[len(jr.primaryKey)].GetBs())
 			if err != nil {
-				return nil, fmt.Errorf("error querying for row TX")
+				return "", err
 			}
 
-			h = append(h, r.Values[1].GetBs())
+			read++
 		}
 
-		if jr.columns[0].cType == "INTEGER" {
-			page = fmt.Sprintf(" \"%s\" < %d ORDER BY \"%s\" DESC LIMIT 999;", jr.columns[0].name, res.Rows[len(res.Rows)-1].Values[0].GetN(), jr.columns[0].name)
-		} else if strings.HasPrefix(jr.columns[0].cType, "VARCHAR") {
-			page = fmt.Sprintf(" \"%s\" < '%s' ORDER BY \"%s\" DESC LIMIT 999;", jr.columns[0].name, res.Rows[len(res.Rows)-1].Values[0].GetS(), jr.columns[0].name)
-		} else if jr.columns[0].cType == "TIMESTAMP" {
-			page = fmt.Sprintf(" \"%s\" < %d ORDER BY \"%s\" DESC LIMIT 999;", jr.columns[0].name, res.Rows[len(res.Rows)-1].Values[0].GetTs(), jr.columns[0].name)
-		} else {
-			return nil, fmt.Errorf("unsupported field type %s", jr.columns[0].cType)
+		if len(res.Rows) > 0 {
+			after = res.Rows[len(res.Rows)-1].Values[:len(jr.primaryKey)]
 		}
 
-		if !strings.Contains(strings.ToLower(sb.String()), "where") {
-			page = " WHERE " + page
+		if opts.Limit > 0 && read >= opts.Limit {
+			return jr.encodeSQLCursor(after)
 		}
 
+		if uint64(len(res.Rows)) < limit {
+			break
+		}
+	}
+
+	return "", nil
+}
+
+// keysetCondition builds condition matching rows after given primary key
+// values in the primary index order, e.g. for primary key (a,b):
+// a >= @k0 AND (a > @k0 OR (a = @k0 AND b > @k1)).
+// The leading range on the first column lets immudb seek in the index.
+func (jr *JsonSQLRepository) keysetCondition(after []*schema.SQLValue, desc bool, params map[string]interface{}) string {
+	cmp := ">"
+	if desc {
+		cmp = "<"
+	}
+
+	alternatives := []string{}
+	for i := range jr.primaryKey {
+		parts := []string{}
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("\"%s\" = @k%d", jr.primaryKey[j].name, j))
+		}
+		parts = append(parts, fmt.Sprintf("\"%s\" %s @k%d", jr.primaryKey[i].name, cmp, i))
+		alternatives = append(alternatives, "("+strings.Join(parts, " AND ")+")")
+
+		params[fmt.Sprintf("k%d", i)] = sqlValueParam(after[i])
+	}
+
+	return fmt.Sprintf("\"%s\" %s= @k0 AND (%s)", jr.primaryKey[0].name, cmp, strings.Join(alternatives, " OR "))
+}
+
+// splitTemporalQuery splits query into temporal part, e.g. "SINCE TX 1", and
+// condition after WHERE.
+func splitTemporalQuery(query string) (string, string) {
+	loc := whereRegexp.FindStringIndex(query)
+	if loc == nil {
+		return strings.TrimSpace(query), ""
 	}
-	return h, nil
+
+	return strings.TrimSpace(query[:loc[0]]), strings.TrimSpace(query[loc[1]:])
 }
 
-func SetupJsonSQLRepository(cli immudb.ImmuClient, collection string, primaryKey string, columns []string) error {
+var whereRegexp = regexp.MustCompile(`(?i)\bWHERE\b`)
+
+func sqlValueParam(v *schema.SQLValue) interface{} {
+	switch tv := v.Value.(type) {
+	case *schema.SQLValue_N:
+		return tv.N
+	case *schema.SQLValue_S:
+		return tv.S
+	case *schema.SQLValue_B:
+		return tv.B
+	case *schema.SQLValue_Bs:
+		return tv.Bs
+	case *schema.SQLValue_Ts:
+		return time.UnixMicro(tv.Ts).UTC()
+	}
+
+	return nil
+}
+
+// SQL cursor is a base64 encoded json array of primary key values of the last
+// row read.
+func (jr *JsonSQLRepository) encodeSQLCursor(after []*schema.SQLValue) (string, error) {
+	values := make([]interface{}, len(after))
+	for i, v := range after {
+		values[i] = sqlValueParam(v)
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("could not encode cursor, %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (jr *JsonSQLRepository) decodeSQLCursor(cursor string) ([]*schema.SQLValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalidQuery(fmt.Errorf("invalid cursor, %w", err))
+	}
+
+	values := gjson.ParseBytes(b).Array()
+	if len(values) != len(jr.primaryKey) {
+		return nil, invalidQuery(errors.New("invalid cursor, primary key mismatch"))
+	}
+
+	after := make([]*schema.SQLValue, len(values))
+	for i, c := range jr.primaryKey {
+		switch c.baseType() {
+		case "INTEGER", "FLOAT":
+			after[i] = &schema.SQLValue{Value: &schema.SQLValue_N{N: values[i].Int()}}
+		case "BOOLEAN":
+			after[i] = &schema.SQLValue{Value: &schema.SQLValue_B{B: values[i].Bool()}}
+		case "TIMESTAMP":
+			after[i] = &schema.SQLValue{Value: &schema.SQLValue_Ts{Ts: values[i].Time().UnixMicro()}}
+		case "VARCHAR", "UUID":
+			after[i] = &schema.SQLValue{Value: &schema.SQLValue_S{S: values[i].String()}}
+		case "BLOB":
+			bs, err := base64.StdEncoding.DecodeString(values[i].String())
+			if err != nil {
+				return nil, invalidQuery(fmt.Errorf("invalid cursor, %w", err))
+			}
+			after[i] = &schema.SQLValue{Value: &schema.SQLValue_Bs{Bs: bs}}
+		default:
+			return nil, fmt.Errorf("unsupported primary key type %s", c.cType)
+		}
+	}
+
+	return after, nil
+}
+
+func SetupJsonSQLRepository(cli immudb.ImmuClient, collection string, primaryKey string, columnDefinitions []string) error {
 	if collection == "" {
 		return errors.New("collection cannot be empty")
 	}
 
+	// collection and columns are used as identifiers, which cannot be passed
+	// as parameters
+	err := ValidateIdentifier(collection)
+	if err != nil {
+		return fmt.Errorf("invalid collection, %w", err)
+	}
+
+	if strings.HasSuffix(collection, tombstoneTableSuffix) {
+		return fmt.Errorf("invalid collection, %s suffix is reserved for tombstones", tombstoneTableSuffix)
+	}
+
+	pkColumns := strings.Split(primaryKey, ",")
+	err = ValidateSQLColumns(columnDefinitions, pkColumns, nil)
+	if err != nil {
+		return err
+	}
+
+	columns, err := parseColumns(columnDefinitions)
+	if err != nil {
+		return err
+	}
+
 	// create table representing audit log
-	tx, err := cli.NewTx(context.TODO())
+	tx, err := newRWTx(cli)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("could not create transaction, %w", err)
+	}
+	defer tx.Close()
+
+	exists, err := tableExists(txQuery(tx), collection)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return updateJsonSQLTable(tx, collection, pkColumns, columns)
 	}
 
 	sb := strings.Builder{}
@@ -238,28 +736,27 @@ func SetupJsonSQLRepository(cli immudb.ImmuClient, collection string, primaryKey
 	sb.WriteString(collection)
 	sb.WriteString(" ( ")
 	indexes := []string{}
-	for _, column := range columns {
-		splitted := strings.Split(column, "=")
-		if len(splitted) != 2 {
-			return fmt.Errorf("invalid index definition, %s", column)
-		}
+	for _, c := range columns {
 		sb.WriteString("\"")
-		sb.WriteString(splitted[0])
+		sb.WriteString(c.name)
 		sb.WriteString("\"")
 		sb.WriteString(" ")
-		sb.WriteString(splitted[1])
+		sb.WriteString(c.sqlType())
 		sb.WriteString(",")
-		indexes = append(indexes, splitted[0])
+
+		// only fixed or limited size columns can be indexed
+		if c.indexable() {
+			indexes = append(indexes, c.name)
+		}
 	}
-	sb.WriteString(" __value__ BLOB, PRIMARY KEY (")
-	sb.WriteString(primaryKey)
-	sb.WriteString("));")
+	sb.WriteString(" __value__ BLOB, PRIMARY KEY (\"")
+	sb.WriteString(strings.Join(pkColumns, "\",\""))
+	sb.WriteString("\"));")
 
 	log.WithField("sql", sb.String()).Info("Creating collection table")
 	err = tx.SQLExec(context.TODO(), sb.String(), nil)
-
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("could not create collection table, %w", err)
 	}
 
 	sb = strings.Builder{}
@@ -272,7 +769,7 @@ func SetupJsonSQLRepository(cli immudb.ImmuClient, collection string, primaryKey
 	log.WithField("sql", sb.String()).Info("Creating indexes")
 	err = tx.SQLExec(context.TODO(), sb.String(), nil)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("could not create indexes, %w", err)
 	}
 
 	_, err = tx.Commit(context.TODO())
@@ -282,3 +779,63 @@ func SetupJsonSQLRepository(cli immudb.ImmuClient, collection string, primaryKey
 
 	return nil
 }
+
+// updateJsonSQLTable adds missing columns to existing collection table, e.g.
+// when collection is redefined. Primary key cannot be changed, and added
+// columns are not indexed, as immudb creates indexes on empty tables only.
+func updateJsonSQLTable(tx *rwTx, collection string, pkColumns []string, columns []column) error {
+	primaryKey, err := queryPrimaryKey(txQuery(tx), collection, columns)
+	if err != nil {
+		return fmt.Errorf("primary key of existing collection table cannot be changed, %w", err)
+	}
+
+	if len(primaryKey) != len(pkColumns) {
+		return errors.New("primary key of existing collection table cannot be changed")
+	}
+	for i, c := range primaryKey {
+		if !strings.EqualFold(c.name, pkColumns[i]) {
+			return errors.New("primary key of existing collection table cannot be changed")
+		}
+	}
+
+	err = addMissingColumns(tx, collection, columns)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Commit(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addMissingColumns adds columns not yet in collection table, as nullable.
+func addMissingColumns(tx immudb.Tx, collection string, columns []column) error {
+	res, err := tx.SQLQuery(context.TODO(), "SELECT name FROM COLUMNS(@collection);", map[string]interface{}{"collection": collection})
+	if err != nil {
+		return fmt.Errorf("could not query columns, %w", err)
+	}
+
+	// column names are lowercased by immudb
+	existing := map[string]bool{}
+	for _, r := range res.Rows {
+		existing[strings.ToLower(r.Values[0].GetS())] = true
+	}
+
+	for _, c := range columns {
+		if existing[strings.ToLower(c.name)] {
+			continue
+		}
+
+		sql := fmt.Sprintf("ALTER TABLE %s ADD COLUMN \"%s\" %s;", collection, c.name, c.sqlType())
+		log.WithField("sql", sql).Info("Adding column")
+		err = tx.SQLExec(context.TODO(), sql, nil)
+		if err != nil {
+			return fmt.Errorf("could not add column %s, %w", c.name, err)
+		}
+	}
+
+	return nil
+}
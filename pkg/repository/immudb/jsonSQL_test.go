@@ -0,0 +1,238 @@
+package immudb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+// row is a position of entry in primary index of test collection.
+type row struct {
+	Region string
+	ID     int64
+}
+
+// newPagingRepository creates SQL collection with composite primary key of
+// region and id, and writes rows of regions us, ap and eu with ids 1 to 4
+// in that order, each in its own transaction, so the order of writes differs
+// from the primary index one. It returns transactions of the writes.
+func newPagingRepository(t *testing.T) (*JsonSQLRepository, []row, []uint64) {
+	t.Helper()
+
+	cli := immudbtest.NewT(t).Client(t)
+	cfg := Config{Type: "sql", Indexes: []string{"region=VARCHAR[16]", "id=INTEGER", "kind=VARCHAR[16]"}, MissingFields: MissingFieldsError}
+	err := CreateCollection(cli, "paging", cfg, []string{"region", "id"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonSQLRepository(cli, "paging")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []row{}
+	txs := []uint64{}
+	for _, region := range []string{"us", "ap", "eu"} {
+		for id := int64(1); id <= 4; id++ {
+			kind := "odd"
+			if id%2 == 0 {
+				kind = "even"
+			}
+
+			tx, err := jr.WriteBytes([]byte(fmt.Sprintf(`{"region":"%s","id":%d,"kind":"%s"}`, region, id, kind)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rows = append(rows, row{Region: region, ID: id})
+			txs = append(txs, tx)
+		}
+	}
+
+	return jr, rows, txs
+}
+
+// sorted returns rows in primary index order, descending if desc is set.
+func sorted(rows []row, desc bool) []row {
+	result := append([]row{}, rows...)
+	sort.Slice(result, func(i, j int) bool {
+		less := result[i].Region < result[j].Region || (result[i].Region == result[j].Region && result[i].ID < result[j].ID)
+		if desc {
+			return !less
+		}
+		return less
+	})
+
+	return result
+}
+
+// readPages reads all rows with read, in pages of limit, and checks that
+// every page but the last ends with cursor.
+func readPages(t *testing.T, limit uint64, opts ReadOptions, read func(ReadOptions, func([]byte) error) (string, error)) []row {
+	t.Helper()
+
+	result := []row{}
+	opts.Limit = limit
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatal("paging does not end")
+		}
+
+		n := uint64(0)
+		cursor, err := read(opts, func(object []byte) error {
+			result = append(result, row{Region: gjson.GetBytes(object, "region").String(), ID: gjson.GetBytes(object, "id").Int()})
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cursor == "" {
+			if n == limit {
+				// a full page ends with cursor, even if it is the last one
+				t.Fatalf("expected cursor after page of %d rows", n)
+			}
+			return result
+		}
+
+		if n != limit {
+			t.Fatalf("expected cursor after full page only, got %d rows", n)
+		}
+
+		opts.Cursor = cursor
+	}
+}
+
+func TestSQLPaging(t *testing.T) {
+	jr, rows, txs := newPagingRepository(t)
+
+	odd := []row{}
+	for _, r := range rows {
+		if r.ID%2 == 1 {
+			odd = append(odd, r)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    SQLQuery
+		opts     ReadOptions
+		history  bool
+		expected []row
+	}{
+		{name: "composite primary key", expected: sorted(rows, false)},
+		{name: "desc", opts: ReadOptions{Desc: true}, expected: sorted(rows, true)},
+		{name: "filter", query: SQLQuery{Filters: []Filter{{Field: "kind", Operator: "=", Value: "odd"}}}, expected: sorted(odd, false)},
+		{name: "filter desc", query: SQLQuery{Filters: []Filter{{Field: "kind", Operator: "=", Value: "odd"}}}, opts: ReadOptions{Desc: true}, expected: sorted(odd, true)},
+		{name: "raw condition", query: SQLQuery{Raw: "kind = 'odd'"}, expected: sorted(odd, false)},
+		{name: "filter on primary key", query: SQLQuery{Filters: []Filter{{Field: "id", Operator: ">", Value: "2"}}}, expected: sorted([]row{{"ap", 3}, {"ap", 4}, {"eu", 3}, {"eu", 4}, {"us", 3}, {"us", 4}}, false)},
+		{name: "as of transaction", opts: ReadOptions{AsOfTx: txs[5]}, expected: sorted(rows[:6], false)},
+		{name: "as of transaction desc", opts: ReadOptions{AsOfTx: txs[5], Desc: true}, expected: sorted(rows[:6], true)},
+		{name: "history since transaction", query: SQLQuery{SinceTx: txs[6]}, history: true, expected: sorted(rows[6:], false)},
+		{name: "history until transaction", query: SQLQuery{UntilTx: txs[5]}, history: true, expected: sorted(rows[:6], false)},
+		{name: "history range with filter", query: SQLQuery{SinceTx: txs[2], UntilTx: txs[9], Filters: []Filter{{Field: "kind", Operator: "=", Value: "odd"}}}, history: true, opts: ReadOptions{Desc: true}, expected: sorted([]row{{"us", 3}, {"ap", 1}, {"ap", 3}, {"eu", 1}}, true)},
+		{name: "raw temporal query", query: SQLQuery{Raw: fmt.Sprintf("SINCE TX %d UNTIL TX %d WHERE id = 4", txs[0], txs[7])}, history: true, expected: sorted([]row{{"us", 4}, {"ap", 4}}, false)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := func(opts ReadOptions, fn func([]byte) error) (string, error) {
+				if tt.history {
+					return jr.History(tt.query, opts, fn)
+				}
+				return jr.Read(tt.query, opts, fn)
+			}
+
+			for _, limit := range []uint64{1, 2, 5, 100} {
+				result := readPages(t, limit, tt.opts, read)
+				if !reflect.DeepEqual(result, tt.expected) {
+					t.Fatalf("expected %v with pages of %d, got %v", tt.expected, limit, result)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLInvalidCursor(t *testing.T) {
+	jr, _, _ := newPagingRepository(t)
+
+	// not base64, and json arrays of wrong number of primary key values
+	for _, cursor := range []string{"!", "W10", "WyJhcCJd", "WyJhcCIsMSwyXQ"} {
+		_, err := jr.Read(SQLQuery{}, ReadOptions{Cursor: cursor}, func([]byte) error { return nil })
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("expected invalid query error of cursor %s, got %v", cursor, err)
+		}
+	}
+}
+
+func TestSQLHistoryRange(t *testing.T) {
+	jr, rows, txs := newPagingRepository(t)
+	count := func(query SQLQuery) (int, error) {
+		n := 0
+		_, err := jr.History(query, ReadOptions{}, func([]byte) error {
+			n++
+			return nil
+		})
+		return n, err
+	}
+
+	// range of raw query is used, when no other is given
+	n, err := count(SQLQuery{Raw: fmt.Sprintf("SINCE TX %d WHERE region = 'eu'", txs[len(txs)-1])})
+	if err != nil || n != 1 {
+		t.Fatalf("expected last row by raw range, got %d, %v", n, err)
+	}
+
+	n, err = count(SQLQuery{Raw: "WHERE region = 'eu'", SinceTx: txs[len(txs)-1]})
+	if err != nil || n != 1 {
+		t.Fatalf("expected last row by since transaction, got %d, %v", n, err)
+	}
+
+	// ranges are not combined
+	for _, query := range []SQLQuery{
+		{Raw: "SINCE TX 1 WHERE region = 'eu'", SinceTx: txs[0]},
+		{Raw: "UNTIL NOW()", UntilTx: txs[0]},
+		{Raw: "SINCE TX 1", Until: time.Now()},
+	} {
+		_, err = count(query)
+		if !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("expected invalid query of raw range with %+v, got %v", query, err)
+		}
+	}
+
+	n, err = count(SQLQuery{})
+	if err != nil || n != len(rows) {
+		t.Fatalf("expected whole history, got %d, %v", n, err)
+	}
+}
+
+func TestSQLStored(t *testing.T) {
+	jr, _, txs := newPagingRepository(t)
+
+	tx, stored, err := jr.Stored([]byte(`{"region":"us","id":2,"kind":"even"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored || tx != txs[1] {
+		t.Fatalf("expected row stored in transaction %d, got %t in %d", txs[1], stored, tx)
+	}
+
+	for _, object := range []string{`{"region":"us","id":2,"kind":"odd"}`, `{"region":"us","id":5,"kind":"odd"}`} {
+		_, stored, err = jr.Stored([]byte(object))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stored {
+			t.Errorf("expected %s not to be stored", object)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package immudb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+)
+
+// CreateCollection validates definition of collection and creates it, see
+// configs.Create. Primary key is given for SQL collections only, for
+// key-value ones it is the first index. Default layout and overwrite policy
+// are not stored, to keep definitions of existing collections unchanged.
+func CreateCollection(cli immudb.ImmuClient, collection string, cfg Config, primaryKey []string, force bool) error {
+	var setup func() error
+	switch cfg.Type {
+	case "kv":
+		if len(cfg.Indexes) == 0 {
+			return errors.New("at least primary key needs to be specified")
+		}
+
+		err := ValidateKVIndexes(cfg.Indexes)
+		if err != nil {
+			return fmt.Errorf("invalid indexes, %w", err)
+		}
+
+		primaryKey = strings.Split(cfg.Indexes[0], "+")
+		err = ValidateIndexPolicies(cfg.IndexPolicies, append(primaryKey, cfg.Indexes[1:]...), primaryKey)
+		if err != nil {
+			return fmt.Errorf("invalid index policies, %w", err)
+		}
+
+		if cfg.Layout == "" {
+			cfg.Layout = KVLayoutLinks
+		}
+
+		err = ValidateKVLayout(cfg.Layout, cfg.Scored, cfg.Indexes)
+		if err != nil {
+			return fmt.Errorf("invalid layout, %w", err)
+		}
+
+		if cfg.Layout == KVLayoutLinks {
+			cfg.Layout = ""
+		}
+
+		setup = func() error {
+			return SetupJsonKVRepository(cli, collection, cfg.Indexes)
+		}
+	case "sql":
+		if len(cfg.Indexes) == 0 || len(primaryKey) == 0 {
+			return errors.New("at least one column and primary key needs to be specified")
+		}
+
+		if cfg.MissingFields != MissingFieldsError && cfg.MissingFields != MissingFieldsNull {
+			return fmt.Errorf("invalid missing fields handling %s", cfg.MissingFields)
+		}
+
+		err := ValidateSQLColumns(cfg.Indexes, primaryKey, cfg.IndexPolicies)
+		if err != nil {
+			return fmt.Errorf("invalid collection definition, %w", err)
+		}
+
+		setup = func() error {
+			return SetupJsonSQLRepository(cli, collection, strings.Join(primaryKey, ","), cfg.Indexes)
+		}
+	default:
+		return fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+
+	if cfg.Overwrite != "" {
+		err := ValidateOverwrite(cfg.Overwrite)
+		if err != nil {
+			return fmt.Errorf("invalid overwrite policy, %w", err)
+		}
+
+		if cfg.Overwrite == OverwriteAllow {
+			cfg.Overwrite = ""
+		}
+	}
+
+	if cfg.Retention != "" {
+		_, err := ParseRetention(cfg.Retention)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := NewConfigs(cli).Create(collection, cfg, force, func() error {
+		err := setup()
+		if err != nil {
+			return fmt.Errorf("could not create json repository, %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not create collection, %w", err)
+	}
+
+	return nil
+}
+
+// CollectionStats summarizes current content of collection.
+type CollectionStats struct {
+	Entries uint64 // number of entries
+	FirstTx uint64 // first transaction with collection entries, 0 if empty
+	LastTx  uint64 // last transaction modifying collection entries, 0 if empty
+}
+
+// Stats counts entries of key-value collection. As only the latest revision
+// of each entry is scanned, FirstTx is the oldest transaction among current
+// entries.
+func (jr *JsonKVRepository) Stats() (CollectionStats, error) {
+	stats := CollectionStats{}
+	err := jr.scanPayloads(nil, func(pk string, e *schema.Entry) error {
+		stats.Entries++
+		if stats.FirstTx == 0 || e.Tx < stats.FirstTx {
+			stats.FirstTx = e.Tx
+		}
+		if e.Tx > stats.LastTx {
+			stats.LastTx = e.Tx
+		}
+
+		return nil
+	})
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	return stats, nil
+}
+
+// scanPayloads streams payload entries after seekKey with their primary key
+// values to fn.
+func (jr *JsonKVRepository) scanPayloads(seekKey []byte, fn func(pk string, e *schema.Entry) error) error {
+	prefix := []byte(fmt.Sprintf("%s.payload.%s.{", jr.collection, jr.indexedKeys[0]))
+	for {
+		entries, err := jr.client.Scan(context.TODO(), &schema.ScanRequest{
+			Prefix:  prefix,
+			SeekKey: seekKey,
+			Limit:   999,
+		})
+		if err != nil {
+			return fmt.Errorf("could not scan for objects, %w", err)
+		}
+
+		for _, e := range entries.Entries {
+			// payload key has format <collection>.payload.<primary field name>.{<pk>}
+			err = fn(string(e.Key[len(prefix):len(e.Key)-1]), e)
+			if err != nil {
+				return err
+			}
+
+			seekKey = e.Key
+		}
+
+		if len(entries.Entries) < 999 {
+			return nil
+		}
+	}
+}
+
+// AddIndexes adds secondary indexes to collection, with index entries
+// backfilled for existing objects.
+func (jr *JsonKVRepository) AddIndexes(fields []string, policies map[string]IndexPolicy) error {
+	for _, f := range fields {
+		for _, k := range jr.indexedKeys {
+			if f == k {
+				return fmt.Errorf("field %s is already indexed", f)
+			}
+		}
+	}
+
+	return jr.Reindex(fields, policies)
+}
+
+// Drop logically deletes payloads and indexes of collection. Deleted
+// entries, as well as config with its history and tombstones, remain
+// available for audit. Keys are matched by their exact shapes, so
+// collections sharing the name prefix, e.g. foo and foo.bar, are kept.
+//
+// Sorted set members of refs layout cannot be deleted in immudb. They
+// resolve to deleted payloads, so scans skip them, and reads skip the ones
+// resolving to object written again after collection was recreated.
+func (jr *JsonKVRepository) Drop() error {
+	prefixes, err := jr.keyPrefixes()
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+	for _, prefix := range prefixes {
+		n, err := jr.deletePrefix(prefix)
+		if err != nil {
+			return err
+		}
+
+		deleted += n
+	}
+
+	log.WithField("collection", jr.collection).WithField("keys", deleted).Info("Deleted collection keys")
+
+	return markDropped(jr.client, jr.collection, *jr.cfg)
+}
+
+// keyPrefixes returns prefixes of payload and index keys of collection, for
+// fields indexed by any revision of its config.
+func (jr *JsonKVRepository) keyPrefixes() ([][]byte, error) {
+	revisions, err := NewConfigs(jr.client).History(jr.collection)
+	if err != nil {
+		return nil, fmt.Errorf("could not read collection definition history, %w", err)
+	}
+
+	revisions = append(revisions, ConfigRevision{Config: *jr.cfg})
+	indexes := map[string]bool{fmt.Sprintf("%s.%s.{", jr.collection, ingestedIndex): true}
+	payloads := map[string]bool{}
+	for _, r := range revisions {
+		if len(r.Indexes) == 0 {
+			continue
+		}
+
+		payloads[fmt.Sprintf("%s.payload.%s.{", jr.collection, r.Indexes[0])] = true
+		for _, field := range r.Indexes {
+			indexes[fmt.Sprintf("%s.%s.{", jr.collection, field)] = true
+		}
+	}
+
+	// payloads go last, as references to deleted keys are not returned by
+	// scans, so they could not be deleted
+	return append(sortedKeys(indexes), sortedKeys(payloads)...), nil
+}
+
+func sortedKeys(set map[string]bool) [][]byte {
+	keys := []string{}
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := [][]byte{}
+	for _, k := range keys {
+		result = append(result, []byte(k))
+	}
+
+	return result
+}
+
+// deletePrefix logically deletes all keys with prefix, and returns their
+// number.
+func (jr *JsonKVRepository) deletePrefix(prefix []byte) (int, error) {
+	var seekKey []byte
+	deleted := 0
+	for {
+		entries, err := jr.client.Scan(context.TODO(), &schema.ScanRequest{
+			Prefix:  prefix,
+			SeekKey: seekKey,
+			Limit:   500,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("could not scan collection keys, %w", err)
+		}
+
+		keys := [][]byte{}
+		for _, e := range entries.Entries {
+			// references are resolved by scan, so they are deleted by their
+			// own key
+			seekKey = e.Key
+			if e.ReferencedBy != nil {
+				seekKey = e.ReferencedBy.Key
+			}
+
+			keys = append(keys, seekKey)
+		}
+
+		if len(keys) > 0 {
+			_, err = jr.client.Delete(context.TODO(), &schema.DeleteKeysRequest{Keys: keys})
+			if err != nil {
+				return 0, fmt.Errorf("could not delete collection keys, %w", err)
+			}
+			deleted += len(keys)
+		}
+
+		if len(entries.Entries) < 500 {
+			return deleted, nil
+		}
+	}
+}
+
+// Stats counts rows of SQL collection. First and last transactions are
+// searched with temporal queries, as rows do not expose their transactions.
+func (jr *JsonSQLRepository) Stats() (CollectionStats, error) {
+	stats := CollectionStats{}
+	var err error
+	stats.Entries, err = jr.count("", 0)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	if stats.Entries == 0 {
+		return stats, nil
+	}
+
+	state, err := jr.client.CurrentState(context.TODO())
+	if err != nil {
+		return CollectionStats{}, fmt.Errorf("could not get current state, %w", err)
+	}
+
+	// first transaction is the lowest one with any row until it
+	stats.FirstTx, err = searchTx(state.TxId, func(tx uint64) (bool, error) {
+		n, err := jr.count("UNTIL TX @tx", tx)
+		return n > 0, err
+	})
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	// last transaction is the lowest one without any row changed after it
+	stats.LastTx, err = searchTx(state.TxId, func(tx uint64) (bool, error) {
+		n, err := jr.count("AFTER TX @tx", tx)
+		return n == 0, err
+	})
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	return stats, nil
+}
+
+// count returns number of rows in collection, within optional temporal clause
+// parameterized with @tx.
+func (jr *JsonSQLRepository) count(temporal string, tx uint64) (uint64, error) {
+	res, err := jr.client.SQLQuery(context.TODO(), fmt.Sprintf("SELECT COUNT(*) FROM %s %s;", jr.collection, temporal), map[string]interface{}{"tx": tx}, true)
+	if err != nil {
+		return 0, fmt.Errorf("could not count rows, %w", err)
+	}
+
+	if len(res.Rows) == 0 {
+		return 0, nil
+	}
+
+	return uint64(res.Rows[0].Values[0].GetN()), nil
+}
+
+// searchTx returns the lowest transaction up to maxTx for which monotonic
+// condition holds.
+func searchTx(maxTx uint64, condition func(tx uint64) (bool, error)) (uint64, error) {
+	low, high := uint64(1), maxTx
+	for low < high {
+		mid := low + (high-low)/2
+		ok, err := condition(mid)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+
+	return low, nil
+}
+
+// AddColumns adds nullable columns to collection table, with values
+// backfilled from stored objects. New columns are not indexed, as immudb
+// creates indexes on empty tables only. Config is updated once backfill
+// succeeds.
+func (jr *JsonSQLRepository) AddColumns(definitions []string, policies map[string]IndexPolicy) error {
+	columns, err := parseColumns(definitions)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range columns {
+		_, err = findColumn(jr.columns, c.name)
+		if err == nil {
+			return fmt.Errorf("column %s already exists", c.name)
+		}
+	}
+
+	cfg := *jr.cfg
+	cfg.Indexes = append(append([]string{}, jr.cfg.Indexes...), definitions...)
+	cfg.IndexPolicies = mergePolicies(jr.cfg.IndexPolicies, policies)
+
+	primaryKey := []string{}
+	for _, c := range jr.primaryKey {
+		primaryKey = append(primaryKey, c.name)
+	}
+
+	err = ValidateSQLColumns(cfg.Indexes, primaryKey, cfg.IndexPolicies)
+	if err != nil {
+		return fmt.Errorf("invalid collection definition, %w", err)
+	}
+
+	// columns already in table are skipped, so failed alter can be repeated
+	tx, err := newRWTx(jr.client)
+	if err != nil {
+		return fmt.Errorf("could not create transaction, %w", err)
+	}
+	defer tx.Close()
+
+	err = addMissingColumns(tx, jr.collection, columns)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Commit(context.TODO())
+	if err != nil {
+		return fmt.Errorf("could not commit, %w", err)
+	}
+
+	jr.cfg = &cfg
+	jr.columns = append(jr.columns, columns...)
+
+	n, err := jr.backfill()
+	if err != nil {
+		return fmt.Errorf("could not backfill columns, %w", err)
+	}
+
+	log.WithField("collection", jr.collection).WithField("columns", definitions).WithField("rows", n).Info("Backfilled columns")
+
+	err = NewConfigs(jr.client).Write(jr.collection, cfg)
+	if err != nil {
+		return fmt.Errorf("could not store collection definition, %w", err)
+	}
+
+	return nil
+}
+
+// backfill rewrites all rows from their stored objects, in batches of rows
+// fitting into single transaction. It returns number of rows written.
+func (jr *JsonSQLRepository) backfill() (uint64, error) {
+	n := uint64(0)
+	batch := [][]byte{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		_, err := jr.upsertAll(batch)
+		if err != nil {
+			return err
+		}
+
+		batch = [][]byte{}
+		return nil
+	}
+
+	_, err := jr.selectPaged(jr.collection, "", map[string]interface{}{}, ReadOptions{}, func(object []byte) error {
+		batch = append(batch, object)
+		n++
+		if len(batch) >= 100 {
+			return flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, flush()
+}
+
+// upsertAll writes objects in single transaction, and returns its id.
+func (jr *JsonSQLRepository) upsertAll(objects [][]byte) (uint64, error) {
+	tx, err := newRWTx(jr.client)
+	if err != nil {
+		return 0, fmt.Errorf("could not create transaction, %w", err)
+	}
+	defer tx.Close()
+
+	for _, o := range objects {
+		sql, params, err := jr.upsert(o)
+		if err != nil {
+			return 0, err
+		}
+
+		err = tx.SQLExec(context.TODO(), sql, params)
+		if err != nil {
+			return 0, fmt.Errorf("could not insert into collection, %w", err)
+		}
+	}
+
+	committed, err := tx.Commit(context.TODO())
+	if err != nil {
+		return 0, fmt.Errorf("could not commit, %w", err)
+	}
+
+	return committed.Header.Id, nil
+}
+
+// Drop deletes all rows of collection table. immudb does not support
+// dropping tables, so the empty table is kept, with deleted rows still
+// available for temporal queries. Config with its history is kept for audit.
+func (jr *JsonSQLRepository) Drop() error {
+	deleted := uint64(0)
+	for {
+		res, err := jr.client.SQLExec(context.TODO(), fmt.Sprintf("DELETE FROM %s LIMIT 300;", jr.collection), nil)
+		if err != nil {
+			return fmt.Errorf("could not delete rows, %w", err)
+		}
+
+		if len(res.Txs) == 0 || res.Txs[0].UpdatedRows == 0 {
+			break
+		}
+
+		deleted += uint64(res.Txs[0].UpdatedRows)
+	}
+
+	log.WithField("collection", jr.collection).WithField("rows", deleted).Info("Deleted collection rows")
+
+	return markDropped(jr.client, jr.collection, *jr.cfg)
+}
+
+func markDropped(cli immudb.ImmuClient, collection string, cfg Config) error {
+	cfg.Dropped = true
+	err := NewConfigs(cli).Write(collection, cfg)
+	if err != nil {
+		return fmt.Errorf("could not store collection definition, %w", err)
+	}
+
+	return nil
+}
+
+func mergePolicies(policies map[string]IndexPolicy, added map[string]IndexPolicy) map[string]IndexPolicy {
+	if len(policies) == 0 && len(added) == 0 {
+		return nil
+	}
+
+	merged := map[string]IndexPolicy{}
+	for f, p := range policies {
+		merged[f] = p
+	}
+	for f, p := range added {
+		merged[f] = p
+	}
+
+	return merged
+}
@@ -0,0 +1,251 @@
+package immudb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+)
+
+// ReindexProgress is a state of reindex operation. It is stored under
+// <collection>.reindex key together with every batch of index entries, so
+// interrupted reindex can be resumed, and its history audited.
+type ReindexProgress struct {
+	Fields  []string
+	SeekKey []byte `json:",omitempty"` // last payload key indexed
+	Entries uint64 // number of objects indexed so far
+	Done    bool
+}
+
+// ReindexEvent is a revision of reindex progress with its transaction.
+type ReindexEvent struct {
+	ReindexProgress
+	Tx uint64
+}
+
+// Reindex writes index entries of fields for all existing objects. Fields not
+// indexed yet are added to collection config as building before objects are
+// scanned, so writers opened since maintain them, and can be read once all
+// entries are written. Unfinished reindex of the same fields is resumed from
+// the last batch.
+func (jr *JsonKVRepository) Reindex(fields []string, policies map[string]IndexPolicy) error {
+	if len(fields) == 0 {
+		return errors.New("no fields to reindex")
+	}
+
+	err := ValidateKVIndexes(fields)
+	if err != nil {
+		return fmt.Errorf("invalid indexes, %w", err)
+	}
+
+	previous := *jr.cfg
+	cfg := *jr.cfg
+	cfg.Indexes = append([]string{}, jr.indexedKeys...)
+	cfg.Building = append([]string{}, jr.cfg.Building...)
+	for _, f := range fields {
+		if f == jr.indexedKeys[0] {
+			return fmt.Errorf("primary key %s cannot be reindexed", f)
+		}
+
+		indexed := false
+		for _, k := range jr.indexedKeys {
+			indexed = indexed || k == f
+		}
+		if !indexed {
+			cfg.Indexes = append(cfg.Indexes, f)
+			cfg.Building = append(cfg.Building, f)
+		}
+	}
+	cfg.IndexPolicies = mergePolicies(jr.cfg.IndexPolicies, policies)
+
+	primaryKey := strings.Split(jr.indexedKeys[0], "+")
+	err = ValidateIndexPolicies(cfg.IndexPolicies, append(append([]string{}, primaryKey...), cfg.Indexes[1:]...), primaryKey)
+	if err != nil {
+		return fmt.Errorf("invalid index policies, %w", err)
+	}
+
+	if !sameDefinition(previous, cfg) {
+		err = NewConfigs(jr.client).Write(jr.collection, cfg)
+		if err != nil {
+			return fmt.Errorf("could not store collection definition, %w", err)
+		}
+	}
+
+	jr.cfg = &cfg
+	jr.indexedKeys = cfg.Indexes
+
+	progress, err := jr.reindexProgress()
+	if err != nil {
+		return err
+	}
+
+	if progress == nil || progress.Done || !reflect.DeepEqual(progress.Fields, fields) {
+		progress = &ReindexProgress{Fields: fields}
+		err = jr.writeReindexBatch(progress, nil)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.WithField("collection", jr.collection).WithField("entries", progress.Entries).Info("Resuming reindex")
+	}
+
+	err = jr.reindexFrom(progress)
+	if err != nil {
+		return fmt.Errorf("stopped after %d entries, %w", progress.Entries, err)
+	}
+
+	log.WithField("collection", jr.collection).WithField("indexes", fields).WithField("entries", progress.Entries).Info("Reindexed")
+
+	// indexes built by other unfinished reindex are kept building
+	built := cfg
+	built.Building = nil
+	for _, b := range cfg.Building {
+		reindexed := false
+		for _, f := range fields {
+			reindexed = reindexed || f == b
+		}
+		if !reindexed {
+			built.Building = append(built.Building, b)
+		}
+	}
+
+	if !sameDefinition(built, cfg) {
+		err = NewConfigs(jr.client).Write(jr.collection, built)
+		if err != nil {
+			return fmt.Errorf("could not store collection definition, %w", err)
+		}
+		jr.cfg = &built
+	}
+
+	progress.Done = true
+	return jr.writeReindexBatch(progress, nil)
+}
+
+// reindexFrom writes index entries for objects after progress seek key, in
+// batches fitting into single transaction together with updated progress.
+func (jr *JsonKVRepository) reindexFrom(progress *ReindexProgress) error {
+	ops := []*schema.Op{}
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+
+		err := jr.writeReindexBatch(progress, ops)
+		if err != nil {
+			return err
+		}
+
+		ops = []*schema.Op{}
+		return nil
+	}
+
+	err := jr.scanPayloads(progress.SeekKey, func(pk string, e *schema.Entry) error {
+		gjsonObject := gjson.ParseBytes(e.Value)
+		for _, f := range progress.Fields {
+			op, err := jr.secondaryIndex(f, gjsonObject, pk)
+			if err != nil {
+				return fmt.Errorf("object %s, %w", pk, err)
+			}
+
+			if op != nil {
+				ops = append(ops, op)
+			}
+		}
+
+		progress.SeekKey = e.Key
+		progress.Entries++
+		if len(ops)+len(progress.Fields) > 999 {
+			return flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// writeReindexBatch atomically writes index entries with reindex progress.
+func (jr *JsonKVRepository) writeReindexBatch(progress *ReindexProgress, ops []*schema.Op) error {
+	b, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	_, err = jr.client.ExecAll(context.TODO(), &schema.ExecAllRequest{
+		Operations: append(ops, &schema.Op{
+			Operation: &schema.Op_Kv{Kv: &schema.KeyValue{
+				Key:   []byte(fmt.Sprintf("%s.reindex", jr.collection)),
+				Value: b,
+			}},
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("could not store index entries, %w", err)
+	}
+
+	return nil
+}
+
+func (jr *JsonKVRepository) reindexProgress() (*ReindexProgress, error) {
+	entry, err := jr.client.Get(context.TODO(), []byte(fmt.Sprintf("%s.reindex", jr.collection)))
+	if err != nil {
+		if isKeyNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not read reindex progress, %w", err)
+	}
+
+	var progress ReindexProgress
+	err = json.Unmarshal(entry.Value, &progress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid reindex progress, %w", err)
+	}
+
+	return &progress, nil
+}
+
+// ReindexHistory returns all revisions of reindex progress, oldest first.
+func (jr *JsonKVRepository) ReindexHistory() ([]ReindexEvent, error) {
+	offset := uint64(0)
+	events := []ReindexEvent{}
+	for {
+		entries, err := jr.client.History(context.TODO(), &schema.HistoryRequest{
+			Key:    []byte(fmt.Sprintf("%s.reindex", jr.collection)),
+			Offset: offset,
+			Limit:  999,
+		})
+		if err != nil {
+			if isKeyNotFound(err) {
+				return events, nil
+			}
+
+			return nil, err
+		}
+
+		for _, e := range entries.Entries {
+			var progress ReindexProgress
+			err = json.Unmarshal(e.Value, &progress)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reindex progress, %w", err)
+			}
+
+			events = append(events, ReindexEvent{ReindexProgress: progress, Tx: e.Tx})
+			offset++
+		}
+
+		if len(entries.Entries) < 999 {
+			return events, nil
+		}
+	}
+}
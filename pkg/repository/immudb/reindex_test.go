@@ -0,0 +1,99 @@
+package immudb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+func TestReindexBuildingIndex(t *testing.T) {
+	cli := immudbtest.NewT(t).Client(t)
+	err := CreateCollection(cli, "reindexed", Config{Type: "kv", Indexes: []string{"id"}}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jr, err := NewJsonKVRepository(cli, "reindexed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jr.WriteBytes([]byte(`{"id":"1","user":"a"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = jr.Reindex([]string{"user"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// index is registered as building before entries are scanned
+	revisions, err := NewConfigs(cli).History("reindexed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	building := [][]string{}
+	for _, r := range revisions {
+		building = append(building, r.Building)
+	}
+	if !reflect.DeepEqual(building, [][]string{nil, {"user"}, nil}) {
+		t.Fatalf("expected index to be building during reindex, got %v", building)
+	}
+
+	// reindex interrupted after index was registered
+	cfg := revisions[len(revisions)-1].Config
+	cfg.Indexes = append(cfg.Indexes, "group")
+	cfg.Building = []string{"group"}
+	err = NewConfigs(cli).Write("reindexed", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := NewJsonKVRepository(cli, "reindexed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = writer.Read("group", "", ReadOptions{}, func([]byte) error { return nil })
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("expected read of building index to fail, got %v", err)
+	}
+
+	// writer opened since maintains building index, entries written by
+	// writer opened before are indexed when reindex is resumed
+	_, err = writer.WriteBytes([]byte(`{"id":"2","user":"b","group":"g"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jr.WriteBytes([]byte(`{"id":"1","user":"a","group":"g"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writer.Reindex([]string{"group"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewJsonKVRepository(cli, "reindexed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reader.cfg.Building) != 0 {
+		t.Fatalf("expected no building index after reindex, got %v", reader.cfg.Building)
+	}
+
+	ids := readIDs(t, func(fn func([]byte) error) error {
+		_, err := reader.Read("group", "g", ReadOptions{}, fn)
+		return err
+	})
+	if !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Fatalf("expected both entries in group index, got %v", ids)
+	}
+}
@@ -0,0 +1,509 @@
+package immudb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+)
+
+// Retention is applied with logical deletion, so deleted values stay in
+// immudb history. Expiration metadata is not used: immudb fails scans of
+// references and sorted sets pointing to expired keys, instead of skipping
+// them as deleted ones, so expired entries would break reads of collection.
+
+// Tombstones of key-value collections are stored under
+// <collection>._tombstone.{<primary key value>}, every purge of the same key
+// being its next revision.
+const tombstoneIndex = "_tombstone"
+
+// tombstoneTableSuffix names table of tombstones of SQL collection, keyed by
+// sha256 of primary key value. Every purge of the same key is next revision
+// of its row.
+const tombstoneTableSuffix = "__tombstones"
+
+// Every transaction of key-value collection purge also writes
+// <collection>._purged, with cutoff of the purge, so reads as of earlier
+// transactions can detect entries deleted since.
+const purgedKey = "_purged"
+
+func purgedOp(collection string, cutoff time.Time) *schema.Op {
+	return &schema.Op{Operation: &schema.Op_Kv{Kv: &schema.KeyValue{
+		Key:   []byte(fmt.Sprintf("%s.%s", collection, purgedKey)),
+		Value: []byte(cutoff.UTC().Format(time.RFC3339Nano)),
+	}}}
+}
+
+func tombstoneTable(collection string) string {
+	return collection + tombstoneTableSuffix
+}
+
+// Tombstone records deletion of entry by retention rule. It is written in
+// the same transaction as deletion, so every deletion is recorded.
+type Tombstone struct {
+	Key       string    // primary key value of deleted entry
+	TxID      uint64    `json:",omitempty"` // transaction of deleted entry, key-value only
+	Hash      string    // sha256 of deleted entry
+	Rule      string    // retention rule entry was deleted by
+	DeletedBy string    // who applied the rule
+	DeletedAt time.Time // when the rule was applied
+}
+
+// retentionCutoff returns the last transaction with entries older than
+// retention of collection, or 0 if there are none, with the rule applied.
+func retentionCutoff(cli immudb.ImmuClient, cfg *Config) (time.Time, uint64, string, error) {
+	if cfg.Retention == "" {
+		return time.Time{}, 0, "", errors.New("collection has no retention rule")
+	}
+
+	period, err := ParseRetention(cfg.Retention)
+	if err != nil {
+		return time.Time{}, 0, "", err
+	}
+
+	cutoff := time.Now().Add(-period)
+	cutoffTx, err := TxAt(cli, cutoff)
+	if err != nil {
+		return time.Time{}, 0, "", err
+	}
+
+	return cutoff, cutoffTx, "retain " + cfg.Retention, nil
+}
+
+func newTombstone(key string, txID uint64, entry []byte, rule string, by string) Tombstone {
+	hash := sha256.Sum256(entry)
+	return Tombstone{
+		Key:       key,
+		TxID:      txID,
+		Hash:      hex.EncodeToString(hash[:]),
+		Rule:      rule,
+		DeletedBy: by,
+		DeletedAt: time.Now().UTC(),
+	}
+}
+
+func tombstoneOp(collection string, t Tombstone) (*schema.Op, error) {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal tombstone, %w", err)
+	}
+
+	return &schema.Op{Operation: &schema.Op_Kv{Kv: &schema.KeyValue{
+		Key:   []byte(fmt.Sprintf("%s.%s.{%s}", collection, tombstoneIndex, t.Key)),
+		Value: b,
+	}}}, nil
+}
+
+func deleteOp(key []byte) *schema.Op {
+	return &schema.Op{Operation: &schema.Op_Kv{Kv: &schema.KeyValue{Key: key, Metadata: &schema.KVMetadata{Deleted: true}}}}
+}
+
+// ReadTombstones streams the latest tombstone of every deleted key of
+// collection. Earlier ones are kept in key or row history.
+func ReadTombstones(cli immudb.ImmuClient, collection string, fn func(Tombstone) error) error {
+	cfg, err := NewConfigs(cli).Read(collection)
+	if err != nil && !isKeyNotFound(err) {
+		return fmt.Errorf("could not read collection config, %w", err)
+	}
+
+	if err == nil && cfg.Type == "sql" {
+		err = readSQLTombstones(cli, collection, fn)
+		if err != nil {
+			return err
+		}
+	}
+
+	// SQL collections may have key-value tombstones too, written by earlier
+	// versions
+	request := &schema.ScanRequest{Prefix: []byte(fmt.Sprintf("%s.%s.{", collection, tombstoneIndex)), Limit: 999}
+	for {
+		entries, err := cli.Scan(context.TODO(), request)
+		if err != nil {
+			return fmt.Errorf("could not scan tombstones, %w", err)
+		}
+
+		for _, e := range entries.Entries {
+			t := Tombstone{}
+			err = json.Unmarshal(e.Value, &t)
+			if err != nil {
+				return fmt.Errorf("invalid tombstone %s, %w", e.Key, err)
+			}
+
+			err = fn(t)
+			if err != nil {
+				return err
+			}
+
+			request.SeekKey = e.Key
+		}
+
+		if len(entries.Entries) < 999 {
+			return nil
+		}
+	}
+}
+
+// Purge logically deletes entries of key-value collection whose current
+// version was written before its retention period, together with their
+// index entries and ingestion index entries, writing tombstones for them.
+// Tombstones are streamed to fn, and with dryRun nothing is deleted. Entries
+// written or deleted concurrently with purge are skipped.
+func (jr *JsonKVRepository) Purge(by string, dryRun bool, fn func(Tombstone) error) error {
+	cutoff, cutoffTx, rule, err := retentionCutoff(jr.client, jr.cfg)
+	if err != nil || cutoffTx == 0 {
+		return err
+	}
+
+	batch := []purgeItem{}
+	operations := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		deleted := batch
+		if !dryRun {
+			var err error
+			deleted, err = jr.deleteExpired(batch, purgedOp(jr.collection, cutoff))
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, item := range deleted {
+			err := fn(item.tombstone)
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = []purgeItem{}
+		operations = 0
+		return nil
+	}
+
+	err = jr.scanPayloads(nil, func(pk string, e *schema.Entry) error {
+		if e.Tx > cutoffTx {
+			return nil
+		}
+
+		t := newTombstone(pk, e.Tx, e.Value, rule, by)
+		tOp, err := tombstoneOp(jr.collection, t)
+		if err != nil {
+			return err
+		}
+
+		ops, err := jr.deleteOps(pk, e.Value)
+		if err != nil {
+			return err
+		}
+		ops = append(ops, tOp)
+
+		if operations+len(ops) > 999 {
+			err = flush()
+			if err != nil {
+				return err
+			}
+		}
+
+		batch = append(batch, purgeItem{key: e.Key, tx: e.Tx, ops: ops, tombstone: t})
+		operations += len(ops)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = flush()
+	if err != nil || dryRun {
+		return err
+	}
+
+	return jr.purgeIngested(cutoff)
+}
+
+// purgeItem is expired object of key-value collection, with operations
+// deleting it and writing its tombstone.
+type purgeItem struct {
+	key       []byte // payload key
+	tx        uint64 // transaction of payload, when it was scanned
+	ops       []*schema.Op
+	tombstone Tombstone
+}
+
+// deleteExpired deletes items in single transaction, together with marker
+// operation, and returns the ones deleted. Every item is deleted only if it was not modified after it was
+// scanned, so if any of them was written or deleted concurrently, items are
+// read again, and only the unmodified ones are deleted.
+func (jr *JsonKVRepository) deleteExpired(items []purgeItem, marker *schema.Op) ([]purgeItem, error) {
+	for attempt := 1; len(items) > 0; attempt++ {
+		request := &schema.ExecAllRequest{Operations: []*schema.Op{marker}}
+		for _, item := range items {
+			request.Operations = append(request.Operations, item.ops...)
+			request.Preconditions = append(request.Preconditions, schema.PreconditionKeyNotModifiedAfterTX(item.key, item.tx))
+		}
+
+		_, err := jr.client.ExecAll(context.TODO(), request)
+		if err == nil {
+			return items, nil
+		}
+
+		if !isPreconditionFailed(err) || attempt == maxConflictRetries {
+			return nil, fmt.Errorf("could not delete entries, %w", err)
+		}
+
+		unmodified := []purgeItem{}
+		for _, item := range items {
+			e, err := jr.client.Get(context.TODO(), item.key)
+			if err != nil && !isKeyNotFound(err) {
+				return nil, fmt.Errorf("could not read %s, %w", item.key, err)
+			}
+
+			if err == nil && e.Tx == item.tx {
+				unmodified = append(unmodified, item)
+				continue
+			}
+
+			log.WithField("collection", jr.collection).WithField("key", item.tombstone.Key).Info("Entry modified during purge, skipping it")
+		}
+		items = unmodified
+	}
+
+	return nil, nil
+}
+
+// deleteOps returns operations deleting payload, primary key and secondary
+// index entries of object. Sorted set members cannot be deleted, they are
+// not returned by immudb once payload is deleted.
+func (jr *JsonKVRepository) deleteOps(pk string, object []byte) ([]*schema.Op, error) {
+	ops := []*schema.Op{
+		deleteOp([]byte(fmt.Sprintf("%s.payload.%s.{%s}", jr.collection, jr.indexedKeys[0], pk))),
+		deleteOp([]byte(fmt.Sprintf("%s.%s.{%s}", jr.collection, jr.indexedKeys[0], pk))),
+	}
+
+	for i := 1; i < len(jr.indexedKeys); i++ {
+		op, err := jr.indexOf(jr.indexedKeys[i], object)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve index of %s, %w", pk, err)
+		}
+
+		if op.GetKv() != nil {
+			ops = append(ops, deleteOp(op.GetKv().Key))
+		}
+	}
+
+	return ops, nil
+}
+
+// purgeIngested deletes ingestion index entries older than cutoff.
+func (jr *JsonKVRepository) purgeIngested(cutoff time.Time) error {
+	request := &schema.ScanRequest{
+		Prefix: []byte(fmt.Sprintf("%s.%s.{", jr.collection, ingestedIndex)),
+		EndKey: []byte(fmt.Sprintf("%s.%s.{%019d", jr.collection, ingestedIndex, cutoff.UnixNano())),
+		Limit:  500,
+	}
+
+	deleted := 0
+	for {
+		entries, err := jr.client.Scan(context.TODO(), request)
+		if err != nil {
+			return fmt.Errorf("could not scan ingestion index, %w", err)
+		}
+
+		ops := []*schema.Op{purgedOp(jr.collection, cutoff)}
+		for _, e := range entries.Entries {
+			request.SeekKey = e.ReferencedBy.Key
+			ops = append(ops, deleteOp(e.ReferencedBy.Key))
+		}
+
+		if len(ops) > 1 {
+			_, err = jr.client.ExecAll(context.TODO(), &schema.ExecAllRequest{Operations: ops})
+			if err != nil {
+				return fmt.Errorf("could not delete ingestion index entries, %w", err)
+			}
+			deleted += len(ops) - 1
+		}
+
+		if len(entries.Entries) < 500 {
+			break
+		}
+	}
+
+	log.WithField("collection", jr.collection).WithField("keys", deleted).Info("Deleted ingestion index entries")
+	return nil
+}
+
+// Purge deletes rows of SQL collection whose current version was written
+// before its retention period, writing tombstones for them. Tombstones are
+// streamed to fn, and with dryRun nothing is deleted.
+func (jr *JsonSQLRepository) Purge(by string, dryRun bool, fn func(Tombstone) error) error {
+	_, cutoffTx, rule, err := retentionCutoff(jr.client, jr.cfg)
+	if err != nil || cutoffTx == 0 {
+		return err
+	}
+
+	// rows do not expose their transactions, so rows written after cutoff
+	// are collected first
+	recent := map[string]bool{}
+	_, err = jr.selectPaged(jr.collection+" AFTER TX @cutoffTx", "", map[string]interface{}{"cutoffTx": cutoffTx}, ReadOptions{}, func(object []byte) error {
+		key, _ := jr.primaryKeyOf(object)
+		recent[key] = true
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not read rows written after transaction %d, %w", cutoffTx, err)
+	}
+
+	if !dryRun {
+		err = jr.createTombstoneTable()
+		if err != nil {
+			return err
+		}
+	}
+
+	tombstones := []Tombstone{}
+	primaryKeys := [][]gjson.Result{}
+	flush := func() error {
+		if len(tombstones) == 0 {
+			return nil
+		}
+
+		if !dryRun {
+			err := jr.deleteRows(tombstones, primaryKeys)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, t := range tombstones {
+			err := fn(t)
+			if err != nil {
+				return err
+			}
+		}
+
+		tombstones = []Tombstone{}
+		primaryKeys = [][]gjson.Result{}
+		return nil
+	}
+
+	_, err = jr.selectPaged(jr.collection, "", map[string]interface{}{}, ReadOptions{}, func(object []byte) error {
+		key, pk := jr.primaryKeyOf(object)
+		if recent[key] {
+			return nil
+		}
+
+		tombstones = append(tombstones, newTombstone(key, 0, object, rule, by))
+		primaryKeys = append(primaryKeys, pk)
+		if len(tombstones) >= 100 {
+			return flush()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// deleteRows writes tombstones, and deletes rows with primary keys in single
+// transaction, so tombstones are written only for deleted rows.
+func (jr *JsonSQLRepository) deleteRows(tombstones []Tombstone, primaryKeys [][]gjson.Result) error {
+	tx, err := newRWTx(jr.client)
+	if err != nil {
+		return fmt.Errorf("could not create transaction, %w", err)
+	}
+	defer tx.Close()
+
+	for _, t := range tombstones {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Errorf("could not marshal tombstone, %w", err)
+		}
+
+		hash := sha256.Sum256([]byte(t.Key))
+		params := map[string]interface{}{"keyhash": hex.EncodeToString(hash[:]), "value": b}
+		err = tx.SQLExec(context.TODO(), fmt.Sprintf("UPSERT INTO %s (keyhash, __value__) VALUES (@keyhash, @value);", tombstoneTable(jr.collection)), params)
+		if err != nil {
+			return fmt.Errorf("could not write tombstone, %w", err)
+		}
+	}
+
+	for _, pk := range primaryKeys {
+		params := map[string]interface{}{}
+		condition, err := jr.primaryKeyCondition(pk, "pk", params)
+		if err != nil {
+			return err
+		}
+
+		err = tx.SQLExec(context.TODO(), fmt.Sprintf("DELETE FROM %s WHERE %s;", jr.collection, condition), params)
+		if err != nil {
+			return fmt.Errorf("could not delete row, %w", err)
+		}
+	}
+
+	_, err = tx.Commit(context.TODO())
+	if err != nil {
+		return fmt.Errorf("could not commit, %w", err)
+	}
+
+	return nil
+}
+
+// createTombstoneTable creates table of tombstones of SQL collection, if it
+// does not exist yet.
+func (jr *JsonSQLRepository) createTombstoneTable() error {
+	_, err := jr.client.SQLExec(context.TODO(), fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (keyhash VARCHAR[64], __value__ BLOB, PRIMARY KEY keyhash);", tombstoneTable(jr.collection)), nil)
+	if err != nil {
+		return fmt.Errorf("could not create tombstone table, %w", err)
+	}
+
+	return nil
+}
+
+// readSQLTombstones streams tombstones of SQL collection, if it has any.
+func readSQLTombstones(cli immudb.ImmuClient, collection string, fn func(Tombstone) error) error {
+	query := fmt.Sprintf("SELECT keyhash, __value__ FROM %s WHERE keyhash > @after ORDER BY keyhash LIMIT 999;", tombstoneTable(collection))
+	params := map[string]interface{}{"after": ""}
+	for {
+		res, err := cli.SQLQuery(context.TODO(), query, params, true)
+		if err != nil && strings.Contains(err.Error(), "table does not exist") {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not query tombstones, %w", err)
+		}
+
+		for _, r := range res.Rows {
+			t := Tombstone{}
+			err = json.Unmarshal(r.Values[1].GetBs(), &t)
+			if err != nil {
+				return fmt.Errorf("invalid tombstone %s, %w", r.Values[0].GetS(), err)
+			}
+
+			err = fn(t)
+			if err != nil {
+				return err
+			}
+
+			params["after"] = r.Values[0].GetS()
+		}
+
+		if len(res.Rows) < 999 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package immudb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+	"github.com/tidwall/gjson"
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+)
+
+type purger interface {
+	WriteBytes([]byte) (uint64, error)
+	Purge(by string, dryRun bool, fn func(Tombstone) error) error
+}
+
+// newExpiringCollection creates collection of type with retention of one
+// second, and writes objects with ids 1 and 2, which expire, and 3, which
+// does not.
+func newExpiringCollection(t *testing.T, typ string) (immudb.ImmuClient, purger) {
+	t.Helper()
+
+	cli := immudbtest.NewT(t).Client(t)
+	cfg := Config{Type: "kv", Indexes: []string{"id", "user"}, Retention: "1s"}
+	var pk []string
+	if typ == "sql" {
+		cfg = Config{Type: "sql", Indexes: []string{"id=VARCHAR[16]", "user=VARCHAR[16]"}, Retention: "1s", MissingFields: MissingFieldsError}
+		pk = []string{"id"}
+	}
+
+	err := CreateCollection(cli, "expiring", cfg, pk, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var repo purger
+	if typ == "sql" {
+		repo, err = NewJsonSQLRepository(cli, "expiring")
+	} else {
+		repo, err = NewJsonKVRepository(cli, "expiring")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range []string{"1", "2", "3"} {
+		if i == 2 {
+			time.Sleep(1200 * time.Millisecond)
+		}
+
+		_, err = repo.WriteBytes([]byte(fmt.Sprintf(`{"id":"%s","user":"user%s"}`, id, id)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return cli, repo
+}
+
+func readIDs(t *testing.T, read func(fn func([]byte) error) error) []string {
+	t.Helper()
+
+	ids := []string{}
+	err := read(func(object []byte) error {
+		ids = append(ids, gjson.GetBytes(object, "id").String())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func TestPurge(t *testing.T) {
+	for _, typ := range []string{"kv", "sql"} {
+		t.Run(typ, func(t *testing.T) {
+			cli, repo := newExpiringCollection(t, typ)
+			readAll := func(fn func([]byte) error) error {
+				if kv, ok := repo.(*JsonKVRepository); ok {
+					_, err := kv.Read("user", "", ReadOptions{}, fn)
+					return err
+				}
+
+				_, err := repo.(*JsonSQLRepository).Read(SQLQuery{}, ReadOptions{}, fn)
+				return err
+			}
+
+			purge := func(dryRun bool) []string {
+				keys := []string{}
+				err := repo.Purge("test", dryRun, func(tombstone Tombstone) error {
+					// SQL tombstones hash rows as read back, so only key-value ones are checked
+					hash := sha256.Sum256([]byte(fmt.Sprintf(`{"id":"%s","user":"user%s"}`, tombstone.Key, tombstone.Key)))
+					if typ == "kv" && tombstone.Hash != hex.EncodeToString(hash[:]) {
+						t.Errorf("tombstone of %s has hash of other entry", tombstone.Key)
+					}
+
+					if tombstone.Rule != "retain 1s" || tombstone.DeletedBy != "test" {
+						t.Errorf("unexpected tombstone %+v", tombstone)
+					}
+
+					keys = append(keys, tombstone.Key)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				sort.Strings(keys)
+				return keys
+			}
+
+			// dry run reports expired entries, without deleting them
+			keys := purge(true)
+			if !reflect.DeepEqual(keys, []string{"1", "2"}) {
+				t.Fatalf("expected dry run to report 1 and 2, got %v", keys)
+			}
+
+			if ids := readIDs(t, readAll); !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+				t.Fatalf("expected dry run to keep entries, got %v", ids)
+			}
+
+			if tombstones := readTombstoneKeys(t, cli); len(tombstones) != 0 {
+				t.Fatalf("expected dry run to write no tombstones, got %v", tombstones)
+			}
+
+			keys = purge(false)
+			if !reflect.DeepEqual(keys, []string{"1", "2"}) {
+				t.Fatalf("expected purge of 1 and 2, got %v", keys)
+			}
+
+			if ids := readIDs(t, readAll); !reflect.DeepEqual(ids, []string{"3"}) {
+				t.Fatalf("expected only 3 after purge, got %v", ids)
+			}
+
+			if tombstones := readTombstoneKeys(t, cli); !reflect.DeepEqual(tombstones, []string{"1", "2"}) {
+				t.Fatalf("expected tombstones of 1 and 2, got %v", tombstones)
+			}
+
+			if kv, ok := repo.(*JsonKVRepository); ok {
+				revisions := []bool{}
+				err := kv.KeyHistory("1", 0, 0, func(h History) error {
+					revisions = append(revisions, h.Deleted)
+					return nil
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(revisions, []bool{false, true}) {
+					t.Fatalf("expected written and deleted revision of 1, got %v", revisions)
+				}
+			}
+
+			// deleted entries are not purged again, 3 may expire meanwhile
+			keys = purge(false)
+			if len(keys) > 1 || len(keys) == 1 && keys[0] != "3" {
+				t.Fatalf("expected deleted entries not to be purged again, got %v", keys)
+			}
+		})
+	}
+}
+
+func readTombstoneKeys(t *testing.T, cli immudb.ImmuClient) []string {
+	t.Helper()
+
+	keys := []string{}
+	err := ReadTombstones(cli, "expiring", func(tombstone Tombstone) error {
+		keys = append(keys, tombstone.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func TestPurgeSkipsModifiedEntries(t *testing.T) {
+	_, repo := newExpiringCollection(t, "kv")
+	jr := repo.(*JsonKVRepository)
+
+	// entries are scanned as by purge, and modified before they are deleted
+	items := []purgeItem{}
+	err := jr.scanPayloads(nil, func(pk string, e *schema.Entry) error {
+		ops, err := jr.deleteOps(pk, e.Value)
+		if err != nil {
+			return err
+		}
+
+		t := newTombstone(pk, e.Tx, e.Value, "retain 1s", "test")
+		tOp, err := tombstoneOp(jr.collection, t)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, purgeItem{key: e.Key, tx: e.Tx, ops: append(ops, tOp), tombstone: t})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = jr.WriteBytes([]byte(`{"id":"1","user":"other"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := jr.deleteExpired(items, purgedOp(jr.collection, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{}
+	for _, item := range deleted {
+		keys = append(keys, item.tombstone.Key)
+	}
+
+	if !reflect.DeepEqual(keys, []string{"2", "3"}) {
+		t.Fatalf("expected deletion of unmodified 2 and 3, got %v", keys)
+	}
+
+	ids := readIDs(t, func(fn func([]byte) error) error {
+		_, err := jr.Read("", "", ReadOptions{}, fn)
+		return err
+	})
+	if !reflect.DeepEqual(ids, []string{"1"}) {
+		t.Fatalf("expected modified 1 to be kept, got %v", ids)
+	}
+}
@@ -0,0 +1,91 @@
+package immudb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codenotary/immudb/pkg/api/schema"
+	immudb "github.com/codenotary/immudb/pkg/client"
+)
+
+// rwTx is read-write transaction, rolled back by Close unless it was already
+// committed or rolled back. immudb allows single read-write transaction per
+// session, so transaction leaked on error makes the following ones fail.
+type rwTx struct {
+	immudb.Tx
+	finished bool
+}
+
+func newRWTx(cli immudb.ImmuClient) (*rwTx, error) {
+	tx, err := cli.NewTx(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+
+	return &rwTx{Tx: tx}, nil
+}
+
+func (t *rwTx) Commit(ctx context.Context) (*schema.CommittedSQLTx, error) {
+	t.finished = true
+	return t.Tx.Commit(ctx)
+}
+
+func (t *rwTx) Rollback(ctx context.Context) error {
+	t.finished = true
+	return t.Tx.Rollback(ctx)
+}
+
+// Close rolls transaction back, if it was not finished.
+func (t *rwTx) Close() {
+	if !t.finished {
+		t.Rollback(context.TODO())
+	}
+}
+
+// TxAt returns the last transaction committed at or before t, or 0 if there
+// is none. immudb records commit time in whole seconds, so t is resolved
+// with second granularity, to the last transaction committed within its
+// second.
+func TxAt(cli immudb.ImmuClient, t time.Time) (uint64, error) {
+	state, err := cli.CurrentState(context.TODO())
+	if err != nil {
+		return 0, fmt.Errorf("could not get current state, %w", err)
+	}
+
+	committedAfter := func(txID uint64) (bool, error) {
+		tx, err := cli.TxByID(context.TODO(), txID)
+		if err != nil {
+			return false, fmt.Errorf("could not get transaction %d, %w", txID, err)
+		}
+
+		return tx.Header.Ts > t.Unix(), nil
+	}
+
+	if state.TxId == 0 {
+		return 0, nil
+	}
+
+	after, err := committedAfter(state.TxId)
+	if err != nil || !after {
+		return state.TxId, err
+	}
+
+	// the first transaction committed after t follows the one at t
+	first, err := searchTx(state.TxId, committedAfter)
+	if err != nil {
+		return 0, err
+	}
+
+	return first - 1, nil
+}
+
+// TxTime returns commit time of transaction.
+func TxTime(cli immudb.ImmuClient, txID uint64) (time.Time, error) {
+	tx, err := cli.TxByID(context.TODO(), txID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("could not get transaction %d, %w", txID, err)
+	}
+
+	return time.Unix(tx.Header.Ts, 0).UTC(), nil
+}
@@ -0,0 +1,341 @@
+// Package memory provides in-memory key-value collection, with the same
+// write, read, history and drop semantics as immudb one with links layout,
+// for unit testing parsers and pipelines without immudb. Other operations of
+// immudb collection, e.g. purge, reindex, diff, export or verification, are
+// not implemented.
+package memory
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codenotary/immudb/embedded/tbtree"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// ingestedIndex is the index of ingestion time, maintained for all objects as
+// in immudb.
+const ingestedIndex = "_ingested"
+
+// JsonKVRepository stores json objects with their revisions in memory. Every
+// write is a separate transaction, numbered from 1. It is safe for
+// concurrent use.
+type JsonKVRepository struct {
+	mu          sync.Mutex
+	cfg         immudb.Config
+	indexedKeys []string
+	txID        uint64
+	revisions   map[string][]immudb.History // by primary key value
+	indexes     map[string]map[string]indexEntry
+}
+
+// indexEntry is "{value}.{primary key value}" entry of field index,
+// "{primary key value}" of primary key one, or "{ingestion time}.{primary key
+// value}" of ingestion one, pointing to object.
+type indexEntry struct {
+	pk   string
+	txID uint64 // transaction entry was first written in
+}
+
+// NewJsonKVRepository creates empty collection with definition of key-value
+// one. The first of indexes is primary key, which can combine multiple
+// fields as field1+field2.
+func NewJsonKVRepository(cfg immudb.Config) (*JsonKVRepository, error) {
+	if len(cfg.Indexes) == 0 {
+		return nil, errors.New("at least primary key needs to be specified")
+	}
+
+	jr := &JsonKVRepository{
+		cfg:         cfg,
+		indexedKeys: cfg.Indexes,
+		revisions:   map[string][]immudb.History{},
+		indexes:     map[string]map[string]indexEntry{},
+	}
+	for _, field := range append([]string{ingestedIndex}, cfg.Indexes...) {
+		jr.indexes[field] = map[string]indexEntry{}
+	}
+
+	return jr, nil
+}
+
+func (jr *JsonKVRepository) Write(jObject interface{}) (uint64, error) {
+	objectBytes, err := json.Marshal(jObject)
+	if err != nil {
+		return 0, fmt.Errorf("could not marshal object: %w", err)
+	}
+
+	return jr.WriteBytes(objectBytes)
+}
+
+// WriteBytes stores object as new revision of its primary key, with index
+// entries of its fields. As in immudb, index entries of previous revisions
+// are kept, and point to the latest revision.
+func (jr *JsonKVRepository) WriteBytes(jBytes []byte) (uint64, error) {
+	gjsonObject := gjson.ParseBytes(jBytes)
+	pk := ""
+	for _, pkPart := range strings.Split(jr.indexedKeys[0], "+") {
+		gjPK := gjsonObject.Get(pkPart)
+		if !gjPK.Exists() {
+			return 0, fmt.Errorf("missing primary key in json, %s", pkPart)
+		}
+		pk += gjPK.String()
+	}
+
+	keys := map[string]string{jr.indexedKeys[0]: fmt.Sprintf("{%s}", pk)}
+	for _, field := range jr.indexedKeys[1:] {
+		gjSK := gjsonObject.Get(field)
+		if !gjSK.Exists() || gjSK.Type == gjson.Null {
+			policy := jr.cfg.Policy(field)
+			if policy.Mode == immudb.IndexOptional {
+				continue
+			} else if policy.Mode == immudb.IndexDefault {
+				gjSK = gjson.Result{Type: gjson.String, Str: policy.Default}
+			} else {
+				return 0, fmt.Errorf("missing secondary key in json, %s", field)
+			}
+		}
+
+		keys[field] = fmt.Sprintf("{%s}.{%s}", gjSK.String(), pk)
+	}
+
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	if jr.exists(pk) {
+		if jr.cfg.Overwrite == immudb.OverwriteReject {
+			return 0, fmt.Errorf("%w, primary key %s", immudb.ErrOverwriteRejected, pk)
+		}
+
+		if jr.cfg.Overwrite == immudb.OverwriteWarn {
+			log.WithField("key", pk).Warn("Overwriting existing entry")
+		}
+	}
+
+	jr.txID++
+	jr.revisions[pk] = append(jr.revisions[pk], immudb.History{
+		Key:      pk,
+		Entry:    append([]byte{}, jBytes...),
+		TxID:     jr.txID,
+		Revision: uint64(len(jr.revisions[pk]) + 1),
+	})
+
+	keys[ingestedIndex] = fmt.Sprintf("{%019d}.{%s}", time.Now().UnixNano(), pk)
+	for field, key := range keys {
+		if _, ok := jr.indexes[field][key]; !ok {
+			jr.indexes[field][key] = indexEntry{pk: pk, txID: jr.txID}
+		}
+	}
+
+	return jr.txID, nil
+}
+
+// exists reports whether object with primary key value was written and not
+// deleted since.
+func (jr *JsonKVRepository) exists(pk string) bool {
+	revisions := jr.revisions[pk]
+	return len(revisions) > 0 && !revisions[len(revisions)-1].Deleted
+}
+
+// Read streams objects matching indexed key and value prefix to fn, ordered
+// as in immudb. If the limit is reached, it returns cursor to be used to
+// continue reading, otherwise empty string.
+func (jr *JsonKVRepository) Read(key string, prefix string, opts immudb.ReadOptions, fn func(object []byte) error) (string, error) {
+	if key == "" {
+		key = jr.indexedKeys[0]
+	}
+
+	validKey := false
+	for _, k := range jr.indexedKeys {
+		if k == key {
+			validKey = true
+		}
+	}
+
+	if !validKey {
+		return "", fmt.Errorf("not indexed key %s", key)
+	}
+
+	return jr.scan(key, "{"+prefix, "", "", opts, fn)
+}
+
+// ReadIngested streams objects ingested within time range, in versions they
+// were ingested in. Zero since or until leaves the range open.
+func (jr *JsonKVRepository) ReadIngested(since time.Time, until time.Time, opts immudb.ReadOptions, fn func(object []byte) error) (string, error) {
+	var from, to string
+	if !since.IsZero() {
+		from = fmt.Sprintf("{%019d", since.UnixNano())
+	}
+	if !until.IsZero() {
+		to = fmt.Sprintf("{%019d", until.UnixNano()+1)
+	}
+
+	return jr.scan(ingestedIndex, "{", from, to, opts, fn)
+}
+
+// scan streams objects pointed by entries of field index with prefix, within
+// [from, to) range, where empty bound leaves the range open.
+func (jr *JsonKVRepository) scan(field string, prefix string, from string, to string, opts immudb.ReadOptions, fn func(object []byte) error) (string, error) {
+	var after string
+	if opts.Cursor != "" {
+		b, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return "", fmt.Errorf("invalid cursor, %w", err)
+		}
+		after = string(b)
+	}
+
+	// objects are collected first, so fn can write to repository
+	jr.mu.Lock()
+	index := jr.indexes[field]
+	keys := []string{}
+	for k, e := range index {
+		if !strings.HasPrefix(k, prefix) || (from != "" && k < from) || (to != "" && k >= to) {
+			continue
+		}
+
+		if opts.AsOfTx > 0 && e.txID > opts.AsOfTx {
+			continue
+		}
+
+		if after != "" && ((!opts.Desc && k <= after) || (opts.Desc && k >= after)) {
+			continue
+		}
+
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	if opts.Desc {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	}
+
+	if opts.Limit > 0 && uint64(len(keys)) > opts.Limit {
+		keys = keys[:opts.Limit]
+	}
+
+	objects := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		// ingestion index points to version of object written with it
+		txID := opts.AsOfTx
+		if field == ingestedIndex {
+			txID = index[k].txID
+		}
+
+		objects = append(objects, jr.objectAt(index[k].pk, txID))
+	}
+	jr.mu.Unlock()
+
+	for _, object := range objects {
+		err := fn(object)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if opts.Limit > 0 && uint64(len(keys)) == opts.Limit {
+		return base64.RawURLEncoding.EncodeToString([]byte(keys[len(keys)-1])), nil
+	}
+
+	return "", nil
+}
+
+// objectAt returns the latest revision of object written up to transaction,
+// or the latest one if txID is 0.
+func (jr *JsonKVRepository) objectAt(pk string, txID uint64) []byte {
+	revisions := jr.revisions[pk]
+	for i := len(revisions) - 1; i >= 0; i-- {
+		if txID == 0 || revisions[i].TxID <= txID {
+			return revisions[i].Entry
+		}
+	}
+
+	return nil
+}
+
+func (jr *JsonKVRepository) History(primaryKeyValue string) ([]immudb.History, error) {
+	objects := []immudb.History{}
+	err := jr.KeyHistory(primaryKeyValue, 0, 0, func(h immudb.History) error {
+		objects = append(objects, h)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return objects, nil
+}
+
+// KeyHistory streams revisions of object with primary key value within
+// transaction range to fn. Zero bound leaves the range open. As in immudb,
+// history of object never written is key not found error.
+func (jr *JsonKVRepository) KeyHistory(primaryKeyValue string, sinceTx uint64, untilTx uint64, fn func(immudb.History) error) error {
+	jr.mu.Lock()
+	revisions := append([]immudb.History{}, jr.revisions[primaryKeyValue]...)
+	jr.mu.Unlock()
+
+	if len(revisions) == 0 {
+		return tbtree.ErrKeyNotFound
+	}
+
+	for _, h := range revisions {
+		if h.TxID < sinceTx || (untilTx > 0 && h.TxID > untilTx) {
+			continue
+		}
+
+		err := fn(h)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LastTxID returns transaction of the last write, 0 if there was none.
+func (jr *JsonKVRepository) LastTxID() uint64 {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	return jr.txID
+}
+
+// Drop deletes all objects in single transaction. As in immudb, history of
+// objects ends with deletion revision and their index entries are removed,
+// so objects written afterwards continue their history.
+func (jr *JsonKVRepository) Drop() error {
+	jr.mu.Lock()
+	defer jr.mu.Unlock()
+
+	deleted := false
+	for pk, revisions := range jr.revisions {
+		if !jr.exists(pk) {
+			continue
+		}
+
+		if !deleted {
+			jr.txID++
+			deleted = true
+		}
+
+		jr.revisions[pk] = append(revisions, immudb.History{
+			Key:      pk,
+			TxID:     jr.txID,
+			Revision: uint64(len(revisions) + 1),
+			Deleted:  true,
+		})
+	}
+
+	for field := range jr.indexes {
+		jr.indexes[field] = map[string]indexEntry{}
+	}
+
+	return nil
+}
@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// repository is the part of key-value collection implemented by both
+// immudb and in-memory one.
+type repository interface {
+	WriteBytes(jBytes []byte) (uint64, error)
+	Read(key string, prefix string, opts immudb.ReadOptions, fn func(object []byte) error) (string, error)
+	ReadIngested(since time.Time, until time.Time, opts immudb.ReadOptions, fn func(object []byte) error) (string, error)
+	KeyHistory(primaryKeyValue string, sinceTx uint64, untilTx uint64, fn func(immudb.History) error) error
+	Drop() error
+}
+
+// newRepositories returns in-memory collection, and immudb one with the same
+// config, to compare their behaviour.
+func newRepositories(t *testing.T, cfg immudb.Config) (repository, repository) {
+	t.Helper()
+
+	mem, err := NewJsonKVRepository(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli := immudbtest.NewT(t).Client(t)
+	err = immudb.CreateCollection(cli, "test", cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imm, err := immudb.NewJsonKVRepository(cli, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mem, imm
+}
+
+// transcript records results of operations on repository, with transactions
+// replaced by sequence numbers of writes, as immudb ones also count
+// transactions of collection setup.
+type transcript struct {
+	t       *testing.T
+	repo    repository
+	txs     []uint64
+	results []string
+}
+
+func (tr *transcript) write(object string) {
+	tr.t.Helper()
+
+	tx, err := tr.repo.WriteBytes([]byte(object))
+	if err != nil {
+		tr.results = append(tr.results, fmt.Sprintf("write %s: %s", object, errorKind(err)))
+		return
+	}
+
+	tr.txs = append(tr.txs, tx)
+	tr.results = append(tr.results, fmt.Sprintf("write %s: tx %d", object, len(tr.txs)))
+}
+
+// tx returns transaction of n-th successful write.
+func (tr *transcript) tx(n int) uint64 {
+	return tr.txs[n-1]
+}
+
+// read records all objects read, in pages of limit.
+func (tr *transcript) read(name string, limit uint64, opts immudb.ReadOptions, read func(immudb.ReadOptions, func([]byte) error) (string, error)) {
+	tr.t.Helper()
+
+	opts.Limit = limit
+	for page := 0; ; page++ {
+		objects := []string{}
+		cursor, err := read(opts, func(object []byte) error {
+			objects = append(objects, string(object))
+			return nil
+		})
+		if err != nil {
+			tr.results = append(tr.results, fmt.Sprintf("%s: %s", name, errorKind(err)))
+			return
+		}
+
+		tr.results = append(tr.results, fmt.Sprintf("%s page %d: %v", name, page, objects))
+		if cursor == "" || page > 20 {
+			return
+		}
+		opts.Cursor = cursor
+	}
+}
+
+func (tr *transcript) history(pk string, sinceTx uint64, untilTx uint64) {
+	tr.t.Helper()
+
+	revisions := []string{}
+	err := tr.repo.KeyHistory(pk, sinceTx, untilTx, func(h immudb.History) error {
+		tx := 0
+		for i, t := range tr.txs {
+			if t == h.TxID {
+				tx = i + 1
+			}
+		}
+
+		revisions = append(revisions, fmt.Sprintf("%s rev %d tx %d deleted %t %s", h.Key, h.Revision, tx, h.Deleted, h.Entry))
+		return nil
+	})
+	if err != nil {
+		tr.results = append(tr.results, fmt.Sprintf("history %s: %s", pk, errorKind(err)))
+		return
+	}
+
+	tr.results = append(tr.results, fmt.Sprintf("history %s: %v", pk, revisions))
+}
+
+func (tr *transcript) drop() {
+	tr.t.Helper()
+
+	err := tr.repo.Drop()
+	if err != nil {
+		tr.t.Fatal(err)
+	}
+
+	// drop is a transaction, so it takes sequence number of write
+	tr.txs = append(tr.txs, 0)
+}
+
+// errorKind reduces error to the kind callers can check, as messages differ.
+func errorKind(err error) string {
+	switch {
+	case immudb.IsNotFound(err):
+		return "not found"
+	case errors.Is(err, immudb.ErrOverwriteRejected):
+		return "overwrite rejected"
+	default:
+		return "error"
+	}
+}
+
+// run runs the same operations on in-memory and immudb repositories, and
+// compares their results.
+func run(t *testing.T, cfg immudb.Config, operations func(tr *transcript)) {
+	mem, imm := newRepositories(t, cfg)
+	expected := &transcript{t: t, repo: imm}
+	operations(expected)
+
+	actual := &transcript{t: t, repo: mem}
+	operations(actual)
+
+	for i, e := range expected.results {
+		if i >= len(actual.results) {
+			t.Fatalf("expected %s, got nothing", e)
+		}
+
+		if e != actual.results[i] {
+			t.Fatalf("expected %s, got %s", e, actual.results[i])
+		}
+	}
+
+	if len(actual.results) > len(expected.results) {
+		t.Fatalf("expected nothing, got %s", actual.results[len(expected.results)])
+	}
+}
+
+func TestReadAndHistory(t *testing.T) {
+	cfg := immudb.Config{Type: "kv", Indexes: []string{"id", "user", "group"}, IndexPolicies: map[string]immudb.IndexPolicy{"group": {Mode: immudb.IndexOptional}}}
+	run(t, cfg, func(tr *transcript) {
+		tr.write(`{"id":"1","user":"alice","group":"admins"}`)
+		tr.write(`{"id":"2","user":"bob"}`)
+		tr.write(`{"id":"3","user":"alina","group":"users"}`)
+		tr.write(`{"id":"2","user":"bob","group":"users"}`)
+		tr.write(`{"user":"carol"}`)
+		tr.write(`{"id":"4","user":"dave","group":null}`)
+
+		for _, limit := range []uint64{0, 1, 2} {
+			for _, desc := range []bool{false, true} {
+				opts := immudb.ReadOptions{Desc: desc}
+				tr.read(fmt.Sprintf("read id limit %d desc %t", limit, desc), limit, opts, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+					return tr.repo.Read("", "", opts, fn)
+				})
+				tr.read(fmt.Sprintf("read user al limit %d desc %t", limit, desc), limit, opts, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+					return tr.repo.Read("user", "al", opts, fn)
+				})
+			}
+		}
+
+		tr.read("read group", 0, immudb.ReadOptions{}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.Read("group", "", opts, fn)
+		})
+		tr.read("read as of tx 3", 0, immudb.ReadOptions{AsOfTx: tr.tx(3)}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.Read("", "", opts, fn)
+		})
+		tr.read("read group as of tx 3", 0, immudb.ReadOptions{AsOfTx: tr.tx(3)}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.Read("group", "", opts, fn)
+		})
+		tr.read("read not indexed", 0, immudb.ReadOptions{}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.Read("unknown", "", opts, fn)
+		})
+
+		tr.history("1", 0, 0)
+		tr.history("2", 0, 0)
+		tr.history("2", tr.tx(3), 0)
+		tr.history("2", 0, tr.tx(3))
+		tr.history("missing", 0, 0)
+	})
+}
+
+func TestReadIngested(t *testing.T) {
+	cfg := immudb.Config{Type: "kv", Indexes: []string{"id"}}
+	mem, imm := newRepositories(t, cfg)
+
+	for _, repo := range []repository{mem, imm} {
+		times := []time.Time{}
+		for _, object := range []string{`{"id":"1","v":1}`, `{"id":"2","v":1}`, `{"id":"1","v":2}`} {
+			times = append(times, time.Now())
+			_, err := repo.WriteBytes([]byte(object))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			since    time.Time
+			until    time.Time
+			opts     immudb.ReadOptions
+			expected []string
+		}{
+			{expected: []string{`{"id":"1","v":1}`, `{"id":"2","v":1}`, `{"id":"1","v":2}`}},
+			{opts: immudb.ReadOptions{Desc: true}, expected: []string{`{"id":"1","v":2}`, `{"id":"2","v":1}`, `{"id":"1","v":1}`}},
+			{since: times[1], expected: []string{`{"id":"2","v":1}`, `{"id":"1","v":2}`}},
+			{until: times[1], expected: []string{`{"id":"1","v":1}`}},
+			{since: times[1], until: times[2], opts: immudb.ReadOptions{Desc: true}, expected: []string{`{"id":"2","v":1}`}},
+			{opts: immudb.ReadOptions{Limit: 2}, expected: []string{`{"id":"1","v":1}`, `{"id":"2","v":1}`}},
+		}
+
+		for i, tt := range tests {
+			objects := []string{}
+			_, err := repo.ReadIngested(tt.since, tt.until, tt.opts, func(object []byte) error {
+				objects = append(objects, string(object))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(objects, tt.expected) {
+				t.Errorf("%T, case %d: expected %v, got %v", repo, i, tt.expected, objects)
+			}
+		}
+	}
+}
+
+func TestDrop(t *testing.T) {
+	cfg := immudb.Config{Type: "kv", Indexes: []string{"id", "user"}, Overwrite: immudb.OverwriteReject}
+	run(t, cfg, func(tr *transcript) {
+		tr.write(`{"id":"1","user":"alice"}`)
+		tr.write(`{"id":"2","user":"bob"}`)
+		tr.write(`{"id":"1","user":"alina"}`)
+		tr.drop()
+
+		tr.read("read after drop", 0, immudb.ReadOptions{}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.Read("user", "", opts, fn)
+		})
+		tr.read("read ingested after drop", 0, immudb.ReadOptions{}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.ReadIngested(time.Time{}, time.Time{}, opts, fn)
+		})
+		tr.history("1", 0, 0)
+
+		// deleted objects can be written again, and continue their history
+		tr.write(`{"id":"1","user":"carol"}`)
+		tr.read("read after write", 0, immudb.ReadOptions{}, func(opts immudb.ReadOptions, fn func([]byte) error) (string, error) {
+			return tr.repo.Read("user", "", opts, fn)
+		})
+		tr.history("1", 0, 0)
+		tr.history("2", 0, 0)
+	})
+}
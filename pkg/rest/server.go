@@ -0,0 +1,517 @@
+package rest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	immudbclient "github.com/codenotary/immudb/pkg/client"
+	log "github.com/sirupsen/logrus"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// Reads are paginated, so a single request cannot stream whole collection.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Server exposes read-only HTTP JSON API over collections:
+//
+//	GET /collections
+//	GET /collections/{collection}
+//	GET /collections/{collection}/entries
+//	GET /collections/{collection}/history/{primary key value}
+//	GET /collections/{collection}/verify/{primary key value}
+//	GET /openapi.json
+type Server struct {
+	client immudbclient.ImmuClient
+	mux    *http.ServeMux
+}
+
+func NewServer(cli immudbclient.ImmuClient) *Server {
+	s := &Server{client: cli, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/collections", s.handleCollections)
+	s.mux.HandleFunc("/collections/", s.handleCollection)
+	s.mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPI)
+	})
+
+	return s
+}
+
+// Handle registers additional handler, e.g. health endpoints.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("only GET is supported"))
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+	log.WithField("path", r.URL.Path).WithField("query", r.URL.RawQuery).WithField("duration", time.Since(start)).Debug("Served request")
+}
+
+// httpError is error with HTTP status to respond with.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(err error) error {
+	return &httpError{status: http.StatusBadRequest, err: err}
+}
+
+func notFound(err error) error {
+	return &httpError{status: http.StatusNotFound, err: err}
+}
+
+// readError responds with 400 to errors caused by query, e.g. invalid filter
+// or cursor, and with 500 to others.
+func readError(err error) error {
+	if errors.Is(err, immudb.ErrInvalidQuery) {
+		return badRequest(err)
+	}
+
+	return err
+}
+
+// keyError responds with 404 to error of missing key.
+func keyError(key string, err error) error {
+	if immudb.IsNotFound(err) {
+		return notFound(fmt.Errorf("entry %s does not exist", key))
+	}
+
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	var he *httpError
+	if errors.As(err, &he) {
+		status = he.status
+	}
+
+	if status >= http.StatusInternalServerError {
+		log.WithError(err).Error("Request failed")
+	}
+
+	b, _ := json.Marshal(ErrorResponse{Error: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+type CollectionResponse struct {
+	Name   string         `json:"name"`
+	Type   string         `json:"type"`
+	Config *immudb.Config `json:"config,omitempty"`
+}
+
+type EntriesResponse struct {
+	Entries []json.RawMessage `json:"entries"`
+	Cursor  string            `json:"cursor,omitempty"` // continues read, empty when all entries were read
+}
+
+// Revision is a version of entry. SQL rows do not expose their
+// transactions and revisions, so they are returned with entry only.
+type Revision struct {
+	TxID     uint64          `json:"tx_id,omitempty"`
+	Revision uint64          `json:"revision,omitempty"`
+	Deleted  bool            `json:"deleted,omitempty"`
+	Verified *bool           `json:"verified,omitempty"`
+	Error    string          `json:"error,omitempty"` // verification error
+	Entry    json.RawMessage `json:"entry"`
+}
+
+type HistoryResponse struct {
+	Key       string     `json:"key"`
+	Revisions []Revision `json:"revisions"`
+	Cursor    string     `json:"cursor,omitempty"`
+}
+
+type VerifyResponse struct {
+	Key       string     `json:"key"`
+	Verified  bool       `json:"verified"`
+	Revisions []Revision `json:"revisions"`
+}
+
+func (s *Server) handleCollections(w http.ResponseWriter, r *http.Request) {
+	cfgs := immudb.NewConfigs(s.client)
+	names, err := cfgs.List()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	collections := []CollectionResponse{}
+	for _, name := range names {
+		cfg, err := cfgs.Read(name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("could not read definition of %s, %w", name, err))
+			return
+		}
+
+		if !cfg.Dropped {
+			collections = append(collections, CollectionResponse{Name: name, Type: cfg.Type})
+		}
+	}
+
+	writeJSON(w, collections)
+}
+
+// handleCollection routes requests of single collection.
+func (s *Server) handleCollection(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/collections/"), "/", 3)
+	cfg, err := s.config(parts[0])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	var response interface{}
+	switch {
+	case len(parts) == 1:
+		response = CollectionResponse{Name: parts[0], Type: cfg.Type, Config: cfg}
+	case len(parts) == 2 && parts[1] == "entries":
+		response, err = s.entries(parts[0], cfg, r)
+	case len(parts) == 3 && parts[1] == "history" && parts[2] != "":
+		response, err = s.history(parts[0], cfg, parts[2], r)
+	case len(parts) == 3 && parts[1] == "verify" && parts[2] != "":
+		response, err = s.verify(parts[0], cfg, parts[2])
+	default:
+		err = notFound(fmt.Errorf("unknown path %s", r.URL.Path))
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, response)
+}
+
+func (s *Server) config(collection string) (*immudb.Config, error) {
+	cfg, err := immudb.NewConfigs(s.client).Read(collection)
+	if err != nil {
+		if immudb.IsNotFound(err) {
+			return nil, notFound(fmt.Errorf("collection %s does not exist", collection))
+		}
+
+		return nil, err
+	}
+
+	if cfg.Dropped {
+		return nil, notFound(fmt.Errorf("collection %s was dropped", collection))
+	}
+
+	return cfg, nil
+}
+
+// entries reads entries of collection. Key-value collections are read by
+// field and value prefix, or by ingestion time, SQL ones with filters.
+func (s *Server) entries(collection string, cfg *immudb.Config, r *http.Request) (interface{}, error) {
+	opts, err := readOptions(r)
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.URL.Query()
+	response := EntriesResponse{Entries: []json.RawMessage{}}
+	collect := func(object []byte) error {
+		response.Entries = append(response.Entries, immudb.EntryJSON(object))
+		return nil
+	}
+
+	switch cfg.Type {
+	case "kv":
+		jr, err := immudb.NewJsonKVRepository(s.client, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		since, err := timeParam(r, "since")
+		if err != nil {
+			return nil, err
+		}
+
+		until, err := timeParam(r, "until")
+		if err != nil {
+			return nil, err
+		}
+
+		if !since.IsZero() || !until.IsZero() {
+			if query.Get("field") != "" {
+				return nil, badRequest(errors.New("ingestion time range cannot be combined with field"))
+			}
+
+			response.Cursor, err = jr.ReadIngested(since, until, opts, collect)
+		} else {
+			response.Cursor, err = jr.Read(query.Get("field"), query.Get("value"), opts, collect)
+		}
+		if err != nil {
+			return nil, readError(err)
+		}
+	case "sql":
+		jr, err := immudb.NewJsonSQLRepository(s.client, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		filters, err := filterParams(r)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Cursor, err = jr.Read(immudb.SQLQuery{Filters: filters}, opts, collect)
+		if err != nil {
+			return nil, readError(err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+
+	return response, nil
+}
+
+// history reads revisions of entry with primary key value, within
+// transaction range given with since_tx and until_tx.
+func (s *Server) history(collection string, cfg *immudb.Config, key string, r *http.Request) (interface{}, error) {
+	sinceTx, err := uintParam(r, "since_tx")
+	if err != nil {
+		return nil, err
+	}
+
+	untilTx, err := uintParam(r, "until_tx")
+	if err != nil {
+		return nil, err
+	}
+
+	response := HistoryResponse{Key: key, Revisions: []Revision{}}
+	switch cfg.Type {
+	case "kv":
+		jr, err := immudb.NewJsonKVRepository(s.client, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		err = jr.KeyHistory(key, sinceTx, untilTx, func(h immudb.History) error {
+			response.Revisions = append(response.Revisions, revisionOf(h))
+			return nil
+		})
+		if err != nil {
+			return nil, keyError(key, err)
+		}
+	case "sql":
+		jr, err := immudb.NewJsonSQLRepository(s.client, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		opts, err := readOptions(r)
+		if err != nil {
+			return nil, err
+		}
+
+		filters, err := jr.PrimaryKeyFilters(key)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		response.Cursor, err = jr.History(immudb.SQLQuery{Filters: filters, SinceTx: sinceTx, UntilTx: untilTx}, opts, func(object []byte) error {
+			response.Revisions = append(response.Revisions, Revision{Entry: immudb.EntryJSON(object)})
+			return nil
+		})
+		if err != nil {
+			return nil, readError(err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+
+	if len(response.Revisions) == 0 && sinceTx == 0 && untilTx == 0 {
+		return nil, notFound(fmt.Errorf("entry %s does not exist", key))
+	}
+
+	return response, nil
+}
+
+// verify verifies all revisions of key-value entry, or current version of
+// SQL row, against immudb state.
+func (s *Server) verify(collection string, cfg *immudb.Config, key string) (interface{}, error) {
+	response := VerifyResponse{Key: key, Verified: true, Revisions: []Revision{}}
+	switch cfg.Type {
+	case "kv":
+		jr, err := immudb.NewJsonKVRepository(s.client, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		err = jr.KeyHistory(key, 0, 0, func(h immudb.History) error {
+			revision := revisionOf(h)
+			verified := true
+			verifyErr := jr.VerifyHistory(h)
+			if verifyErr != nil {
+				verified = false
+				revision.Error = verifyErr.Error()
+				response.Verified = false
+			}
+			revision.Verified = &verified
+
+			response.Revisions = append(response.Revisions, revision)
+			return nil
+		})
+		if err != nil {
+			return nil, keyError(key, err)
+		}
+	case "sql":
+		jr, err := immudb.NewJsonSQLRepository(s.client, collection)
+		if err != nil {
+			return nil, err
+		}
+
+		filters, err := jr.PrimaryKeyFilters(key)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		// row is read again, as failed verification does not return it
+		var object []byte
+		_, err = jr.Read(immudb.SQLQuery{Filters: filters}, immudb.ReadOptions{Limit: 1}, func(o []byte) error {
+			object = o
+			return nil
+		})
+		if err != nil {
+			return nil, readError(err)
+		}
+
+		if object != nil {
+			verified := true
+			revision := Revision{Entry: immudb.EntryJSON(object), Verified: &verified}
+			_, verifyErr := jr.VerifyRow(key)
+			if verifyErr != nil {
+				verified = false
+				revision.Error = verifyErr.Error()
+				response.Verified = false
+			}
+
+			response.Revisions = append(response.Revisions, revision)
+		}
+	default:
+		return nil, fmt.Errorf("unknown collection type %s", cfg.Type)
+	}
+
+	if len(response.Revisions) == 0 {
+		return nil, notFound(fmt.Errorf("entry %s does not exist", key))
+	}
+
+	return response, nil
+}
+
+func revisionOf(h immudb.History) Revision {
+	r := Revision{TxID: h.TxID, Revision: h.Revision, Deleted: h.Deleted, Entry: immudb.EntryJSON(h.Entry)}
+	if h.Deleted {
+		r.Entry = immudb.EntryJSON(nil)
+	}
+
+	return r
+}
+
+// readOptions parses limit, cursor, desc and as_of_tx parameters.
+func readOptions(r *http.Request) (immudb.ReadOptions, error) {
+	opts := immudb.ReadOptions{Limit: DefaultLimit, Cursor: r.URL.Query().Get("cursor")}
+	limit, err := uintParam(r, "limit")
+	if err != nil {
+		return opts, err
+	}
+
+	if limit > MaxLimit {
+		return opts, badRequest(fmt.Errorf("limit cannot exceed %d", MaxLimit))
+	}
+
+	if limit > 0 {
+		opts.Limit = limit
+	}
+
+	if v := r.URL.Query().Get("desc"); v != "" {
+		opts.Desc, err = strconv.ParseBool(v)
+		if err != nil {
+			return opts, badRequest(fmt.Errorf("invalid desc, %w", err))
+		}
+	}
+
+	opts.AsOfTx, err = uintParam(r, "as_of_tx")
+	return opts, err
+}
+
+func uintParam(r *http.Request, name string) (uint64, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	u, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, badRequest(fmt.Errorf("invalid %s, %w", name, err))
+	}
+
+	return u, nil
+}
+
+func timeParam(r *http.Request, name string) (time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := immudb.ParseTime(v)
+	if err != nil {
+		return time.Time{}, badRequest(fmt.Errorf("invalid %s, %w", name, err))
+	}
+
+	return t, nil
+}
+
+func filterParams(r *http.Request) ([]immudb.Filter, error) {
+	filters := []immudb.Filter{}
+	for _, f := range r.URL.Query()["filter"] {
+		filter, err := immudb.ParseFilter(f)
+		if err != nil {
+			return nil, badRequest(err)
+		}
+
+		filters = append(filters, filter)
+	}
+
+	return filters, nil
+}
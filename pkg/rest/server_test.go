@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/tomekkolo/immudb-play/pkg/immudbtest"
+	"github.com/tomekkolo/immudb-play/pkg/repository/immudb"
+)
+
+// newTestServer serves key-value collection kv and SQL collection sql, each
+// with entries of id 1 to 3, from immudb started for test.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	cli := immudbtest.NewT(t).Client(t)
+	err := immudb.CreateCollection(cli, "kv", immudb.Config{Type: "kv", Indexes: []string{"id", "user"}}, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = immudb.CreateCollection(cli, "sql", immudb.Config{Type: "sql", Indexes: []string{"id=INTEGER", "user=VARCHAR[64]"}, MissingFields: immudb.MissingFieldsError}, []string{"id"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kv, err := immudb.NewJsonKVRepository(cli, "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql, err := immudb.NewJsonSQLRepository(cli, "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		entry := []byte(fmt.Sprintf(`{"id":%d,"user":"user%d"}`, i, i))
+		if _, err := kv.WriteBytes(entry); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := sql.WriteBytes(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ts := httptest.NewServer(NewServer(cli))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, b
+}
+
+func TestServerStatus(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{path: "/collections", status: http.StatusOK},
+		{path: "/collections/kv/entries", status: http.StatusOK},
+		{path: "/collections/kv/entries?field=user&value=user2", status: http.StatusOK},
+		{path: "/collections/kv/history/1", status: http.StatusOK},
+		{path: "/collections/kv/verify/1", status: http.StatusOK},
+		{path: "/collections/sql/entries?filter=id>=2", status: http.StatusOK},
+		{path: "/collections/sql/history/1", status: http.StatusOK},
+		{path: "/collections/sql/verify/1", status: http.StatusOK},
+
+		{path: "/collections/missing", status: http.StatusNotFound},
+		{path: "/collections/kv/unknown", status: http.StatusNotFound},
+		{path: "/collections/kv/history/100", status: http.StatusNotFound},
+		{path: "/collections/kv/verify/100", status: http.StatusNotFound},
+		{path: "/collections/sql/history/100", status: http.StatusNotFound},
+		{path: "/collections/sql/verify/100", status: http.StatusNotFound},
+
+		{path: "/collections/kv/entries?field=unknown", status: http.StatusBadRequest},
+		{path: "/collections/kv/entries?cursor=%21", status: http.StatusBadRequest},
+		{path: "/collections/kv/entries?limit=x", status: http.StatusBadRequest},
+		{path: "/collections/sql/entries?filter=unknown=1", status: http.StatusBadRequest},
+		{path: "/collections/sql/entries?filter=id=x", status: http.StatusBadRequest},
+		{path: "/collections/sql/entries?filter=id", status: http.StatusBadRequest},
+		{path: "/collections/sql/entries?cursor=%21", status: http.StatusBadRequest},
+		{path: "/collections/sql/history/x", status: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			status, body := get(t, ts.URL+tt.path)
+			if status != tt.status {
+				t.Errorf("expected status %d, got %d, %s", tt.status, status, body)
+			}
+		})
+	}
+}
+
+func TestServerEntries(t *testing.T) {
+	ts := newTestServer(t)
+
+	for _, path := range []string{"/collections/kv/entries?limit=2", "/collections/sql/entries?limit=2"} {
+		status, body := get(t, ts.URL+path)
+		if status != http.StatusOK {
+			t.Fatalf("expected status 200 of %s, got %d, %s", path, status, body)
+		}
+
+		response := EntriesResponse{}
+		err := json.Unmarshal(body, &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(response.Entries) != 2 || response.Cursor == "" {
+			t.Fatalf("expected 2 entries with cursor from %s, got %s", path, body)
+		}
+
+		status, body = get(t, ts.URL+path+"&cursor="+response.Cursor)
+		if status != http.StatusOK {
+			t.Fatalf("expected status 200 of next page of %s, got %d, %s", path, status, body)
+		}
+
+		response = EntriesResponse{}
+		err = json.Unmarshal(body, &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(response.Entries) != 1 || response.Cursor != "" {
+			t.Fatalf("expected last entry without cursor from %s, got %s", path, body)
+		}
+	}
+}
+
+// TestServerConcurrentRequests checks requests sharing immudb session do not
+// fail each other.
+func TestServerConcurrentRequests(t *testing.T) {
+	ts := newTestServer(t)
+
+	paths := []string{
+		"/collections/sql/entries",
+		"/collections/sql/history/1",
+		"/collections/sql/verify/2",
+		"/collections/kv/entries",
+		"/collections/kv/verify/3",
+	}
+
+	wg := sync.WaitGroup{}
+	failed := make(chan string, 10*len(paths))
+	for i := 0; i < 10; i++ {
+		for _, path := range paths {
+			wg.Add(1)
+			go func(path string) {
+				defer wg.Done()
+
+				resp, err := http.Get(ts.URL + path)
+				if err != nil {
+					failed <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+
+				if resp.StatusCode != http.StatusOK {
+					b, _ := io.ReadAll(resp.Body)
+					failed <- fmt.Sprintf("%s: %d %s", path, resp.StatusCode, b)
+				}
+			}(path)
+		}
+	}
+
+	wg.Wait()
+	close(failed)
+	for f := range failed {
+		t.Error(f)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// Provenance describes origin of imported entry. It is stored in the entry
+// under provenance field.
+type Provenance struct {
+	Source     string    `json:"source"`
+	Database   string    `json:"database,omitempty"`
+	Collection string    `json:"collection,omitempty"`
+	TxID       uint64    `json:"tx_id,omitempty"`
+	Revision   uint64    `json:"revision,omitempty"`
+	ImportedAt time.Time `json:"imported_at"`
+}
+
+// ImportStats counts entries processed by import.
+type ImportStats struct {
+	Imported uint64
+	Skipped  uint64 // rejected by overwrite policy, or skipped on resume
+}
+
+type ImportService struct {
+	jsonRepository  BatchRepository
+	provenanceField string
+	batchSize       uint64
+	skip            uint64
+}
+
+// NewImportService creates import writing entries with jsonRepository, with
+// provenance stored in provenanceField, or not stored if it is empty.
+// Entries are written in transactions of batchSize entries, and the first
+// skip entries are not written, so interrupted import can be resumed.
+func NewImportService(jsonRepository BatchRepository, provenanceField string, batchSize uint64, skip uint64) *ImportService {
+	if batchSize == 0 {
+		batchSize = 1
+	}
+
+	return &ImportService{
+		jsonRepository:  jsonRepository,
+		provenanceField: provenanceField,
+		batchSize:       batchSize,
+		skip:            skip,
+	}
+}
+
+// Run imports entries streamed by read to write, in order. Entries already
+// having provenance field keep it, so the original source is preserved on
+// repeated migrations.
+func (is *ImportService) Run(read func(write func(entry []byte, p Provenance) error) error) (ImportStats, error) {
+	stats := ImportStats{}
+	n := uint64(0)      // entries read
+	stored := uint64(0) // entries skipped or stored, import can be resumed after them
+	batch := [][]byte{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		txIDs, err := is.jsonRepository.WriteBytesBatch(batch)
+		for i, txID := range txIDs {
+			if txID == 0 {
+				log.WithField("entry", stored+uint64(i)+1).Warn("Existing entry not overwritten, skipping")
+				stats.Skipped++
+			} else {
+				stats.Imported++
+			}
+		}
+		stored += uint64(len(txIDs))
+		if err != nil {
+			return fmt.Errorf("could not import entries %d-%d, %w", stored+1, n, err)
+		}
+
+		batch = [][]byte{}
+		log.WithField("entries", stored).WithField("imported", stats.Imported).Info("Imported batch")
+		return nil
+	}
+
+	err := read(func(entry []byte, p Provenance) error {
+		n++
+		if n <= is.skip {
+			stored++
+			stats.Skipped++
+			return nil
+		}
+
+		if is.provenanceField != "" && !gjson.GetBytes(entry, is.provenanceField).Exists() {
+			var err error
+			entry, err = sjson.SetBytes(entry, is.provenanceField, p)
+			if err != nil {
+				return fmt.Errorf("could not add provenance to entry %d, %w", n, err)
+			}
+		}
+
+		batch = append(batch, entry)
+		if uint64(len(batch)) < is.batchSize {
+			return nil
+		}
+
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// batches are written in single transactions, so import can be
+		// resumed after the last one stored
+		return stats, fmt.Errorf("%w, resume with skip %d", err, stored)
+	}
+
+	return stats, nil
+}
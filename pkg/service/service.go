@@ -1,13 +1,19 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/tomekkolo/immudb-play/pkg/health"
+	"github.com/tomekkolo/immudb-play/pkg/metrics"
 )
 
-type lineProvider interface {
+// LineProvider is a source of lines, returning io.EOF when there are no
+// more of them.
+type LineProvider interface {
 	ReadLine() (string, error)
 }
 
@@ -15,23 +21,44 @@ type LineParser interface {
 	Parse(line string) ([]byte, error)
 }
 
+// ErrOverwriteRejected is returned by repositories for writes of existing
+// primary key into collection which rejects overwrites.
+var ErrOverwriteRejected = errors.New("overwrite of existing entry rejected")
+
 type JsonRepository interface {
 	WriteBytes(b []byte) (uint64, error)
 }
 
+// BatchRepository writes objects in single transaction, and returns its id
+// for each of them, or 0 for objects rejected with ErrOverwriteRejected. On
+// error, ids of objects already stored are returned.
+type BatchRepository interface {
+	JsonRepository
+	WriteBytesBatch(objects [][]byte) ([]uint64, error)
+}
+
 type AuditHistoryEntry struct {
 	Entry    []byte
 	Revision uint64
 	TXID     uint64
 }
 
+// LagReporter is implemented by line providers which know how much of
+// source is not read yet.
+type LagReporter interface {
+	Lag() (int64, error)
+}
+
 type AuditService struct {
-	lineProvider   lineProvider
+	lineProvider   LineProvider
 	jsonRepository JsonRepository
 	lineParser     LineParser
+	metrics        *metrics.Pipeline
+	health         *health.Checker
+	lagReportedAt  time.Time
 }
 
-func NewAuditService(lineProvider lineProvider, lineParser LineParser, jsonRepository JsonRepository) *AuditService {
+func NewAuditService(lineProvider LineProvider, lineParser LineParser, jsonRepository JsonRepository) *AuditService {
 	return &AuditService{
 		lineProvider:   lineProvider,
 		lineParser:     lineParser,
@@ -39,28 +66,76 @@ func NewAuditService(lineProvider lineProvider, lineParser LineParser, jsonRepos
 	}
 }
 
+// WithMetrics makes service record pipeline metrics.
+func (as *AuditService) WithMetrics(m *metrics.Pipeline) *AuditService {
+	as.metrics = m
+	return as
+}
+
+// WithHealth makes service record source state and writes for health
+// probes.
+func (as *AuditService) WithHealth(h *health.Checker) *AuditService {
+	as.health = h
+	return as
+}
+
 func (as *AuditService) Run() error {
+	as.health.SourceOpened()
 	for {
 		l, err := as.lineProvider.ReadLine()
 		if err != nil {
 			if err == io.EOF {
 				log.Printf("Reached EOF")
+				as.health.SourceEOF()
 				return nil
 			}
+			as.health.SourceFailed(err)
 			return err
 		}
 
+		as.metrics.LineRead()
+		as.reportLag()
+
 		b, err := as.lineParser.Parse(l)
 		if err != nil {
 			log.WithError(err).WithField("line", l).Debug("Invalid line format, skipping")
+			as.metrics.LineSkipped(metrics.SkipInvalidLine)
 			continue
 		}
 
+		as.metrics.LineParsed()
+
+		as.health.WriteStarted()
 		id, err := as.jsonRepository.WriteBytes(b)
+		as.health.WriteDone(err)
+		if errors.Is(err, ErrOverwriteRejected) {
+			log.WithError(err).WithField("line", l).Warn("Existing entry not overwritten, skipping")
+			as.metrics.LineSkipped(metrics.SkipOverwriteRejected)
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("could not store audit entry, %w", err)
 		}
 
+		as.metrics.EntryStored(id)
 		log.WithField("TXID", id).WithField("line", l).Trace("Stored line")
 	}
 }
+
+// reportLag records lag of source, at most once a second, as it may need to
+// stat the source.
+func (as *AuditService) reportLag() {
+	lr, ok := as.lineProvider.(LagReporter)
+	if !ok || as.metrics == nil || time.Since(as.lagReportedAt) < time.Second {
+		return
+	}
+
+	as.lagReportedAt = time.Now()
+	lag, err := lr.Lag()
+	if err != nil {
+		log.WithError(err).Debug("Could not get source lag")
+		return
+	}
+
+	as.metrics.SourceLag(lag)
+}
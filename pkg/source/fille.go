@@ -3,12 +3,14 @@ package source
 import (
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/hpcloud/tail"
 )
 
 type FileTail struct {
-	t *tail.Tail
+	t    *tail.Tail
+	path string
 }
 
 func NewFileTail(path string, follow bool) (*FileTail, error) {
@@ -17,7 +19,7 @@ func NewFileTail(path string, follow bool) (*FileTail, error) {
 		return nil, fmt.Errorf("could not create file tail: %w", err)
 	}
 
-	return &FileTail{t: t}, nil
+	return &FileTail{t: t, path: path}, nil
 }
 
 func (ft *FileTail) ReadLine() (string, error) {
@@ -32,3 +34,23 @@ func (ft *FileTail) ReadLine() (string, error) {
 
 	return l.Text, nil
 }
+
+// Lag returns number of bytes of file not read yet. After rotation, it is
+// relative to the new file.
+func (ft *FileTail) Lag() (int64, error) {
+	offset, err := ft.t.Tell()
+	if err != nil {
+		return 0, fmt.Errorf("could not get file offset, %w", err)
+	}
+
+	fi, err := os.Stat(ft.path)
+	if err != nil {
+		return 0, fmt.Errorf("could not stat file, %w", err)
+	}
+
+	if fi.Size() < offset {
+		return 0, nil
+	}
+
+	return fi.Size() - offset, nil
+}
@@ -0,0 +1,84 @@
+package source
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ScriptedSource returns given lines in order, and then io.EOF, or error
+// set with ThenError. It replaces file or docker tails when testing parsers
+// and pipelines.
+type ScriptedSource struct {
+	mu    sync.Mutex
+	lines []string
+	err   error
+	read  int
+}
+
+func NewScriptedSource(lines ...string) *ScriptedSource {
+	return &ScriptedSource{lines: lines, err: io.EOF}
+}
+
+// ThenError makes source return err after all lines were read, e.g. to
+// simulate broken source.
+func (ss *ScriptedSource) ThenError(err error) *ScriptedSource {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.err = err
+	return ss
+}
+
+// Append adds lines to be read, e.g. between runs of pipeline.
+func (ss *ScriptedSource) Append(lines ...string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.lines = append(ss.lines, lines...)
+}
+
+func (ss *ScriptedSource) ReadLine() (string, error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.read >= len(ss.lines) {
+		return "", ss.err
+	}
+
+	ss.read++
+	return ss.lines[ss.read-1], nil
+}
+
+// Read returns number of lines already read.
+func (ss *ScriptedSource) Read() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.read
+}
+
+// ReaderSource returns lines of reader, e.g. of sample log opened in test,
+// and then io.EOF.
+type ReaderSource struct {
+	scanner *bufio.Scanner
+}
+
+func NewReaderSource(r io.Reader) *ReaderSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	return &ReaderSource{scanner: scanner}
+}
+
+func (rs *ReaderSource) ReadLine() (string, error) {
+	if rs.scanner.Scan() {
+		return rs.scanner.Text(), nil
+	}
+
+	if rs.scanner.Err() != nil {
+		return "", fmt.Errorf("could not read line, %w", rs.scanner.Err())
+	}
+
+	return "", io.EOF
+}